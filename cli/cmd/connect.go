@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pritunl/pritunl-client-electron/cli/service"
+	"github.com/pritunl/pritunl-client-electron/cli/sprofile"
+	"github.com/spf13/cobra"
+)
+
+const (
+	exitConnected            = 0
+	exitError                = 1
+	exitTimeout              = 2
+	exitAuthError            = 3
+	exitHandshakeTimeout     = 4
+	exitRegistrationRequired = 5
+	exitStopped              = 6
+)
+
+const defaultConnectTimeout = 5 * time.Minute
+
+type connectEventData struct {
+	Id              string `json:"id"`
+	Status          string `json:"status"`
+	ServerAddr      string `json:"server_addr"`
+	ClientAddr      string `json:"client_addr"`
+	RegistrationKey string `json:"registration_key"`
+	SsoUrl          string `json:"sso_url"`
+	Url             string `json:"url"`
+}
+
+type connectProgress struct {
+	Type            string `json:"type"`
+	ProfileId       string `json:"profile_id"`
+	Status          string `json:"status,omitempty"`
+	SsoUrl          string `json:"sso_url,omitempty"`
+	RegistrationKey string `json:"registration_key,omitempty"`
+	ServerAddr      string `json:"server_addr,omitempty"`
+	ClientAddr      string `json:"client_addr,omitempty"`
+	Result          string `json:"result,omitempty"`
+	Code            int    `json:"code"`
+	Error           string `json:"error,omitempty"`
+}
+
+type connectWaiter struct {
+	sprfl  *sprofile.Sprofile
+	status string
+	ssoUrl string
+}
+
+func (w *connectWaiter) output(prog *connectProgress) {
+	prog.ProfileId = w.sprfl.Id
+
+	if connectJson {
+		data, _ := json.Marshal(prog)
+		fmt.Println(string(data))
+		return
+	}
+
+	switch prog.Type {
+	case "status":
+		fmt.Printf("Profile status %s\n", prog.Status)
+		break
+	case "sso":
+		fmt.Println("Single sign-on authentication required, " +
+			"open link to complete authentication:")
+		fmt.Println(prog.SsoUrl)
+		break
+	case "registration":
+		fmt.Println("Device registration required, registration key:")
+		fmt.Println(prog.RegistrationKey)
+		break
+	case "result":
+		if prog.Code == exitConnected {
+			fmt.Printf("Connected client address %s server address %s\n",
+				prog.ClientAddr, prog.ServerAddr)
+		} else if prog.Error != "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog.Result, prog.Error)
+		} else {
+			fmt.Fprintf(os.Stderr, "Connection failed: %s\n", prog.Result)
+		}
+		break
+	}
+}
+
+func (w *connectWaiter) exit(result string, code int, err error) {
+	prog := &connectProgress{
+		Type:   "result",
+		Result: result,
+		Code:   code,
+	}
+	if err != nil {
+		prog.Error = err.Error()
+	}
+
+	w.output(prog)
+	os.Exit(code)
+}
+
+func (w *connectWaiter) handle(evt *service.Event) {
+	data := &connectEventData{}
+	if len(evt.Data) > 0 {
+		_ = json.Unmarshal(evt.Data, data)
+	}
+	if data.Id != w.sprfl.Id {
+		return
+	}
+
+	ssoUrl := data.SsoUrl
+	if evt.Type == "sso_auth" {
+		ssoUrl = data.Url
+	}
+	if ssoUrl != "" && ssoUrl != w.ssoUrl {
+		w.ssoUrl = ssoUrl
+		w.output(&connectProgress{
+			Type:   "sso",
+			SsoUrl: ssoUrl,
+		})
+	}
+
+	switch evt.Type {
+	case "auth_error":
+		w.exit(evt.Type, exitAuthError, nil)
+		break
+	case "handshake_timeout":
+		w.exit(evt.Type, exitHandshakeTimeout, nil)
+		break
+	case "reconnect_exhausted", "conflict_error", "configuration_error",
+		"cert_mismatch":
+		w.exit(evt.Type, exitError, nil)
+		break
+	case "registration_required":
+		w.output(&connectProgress{
+			Type:            "registration",
+			RegistrationKey: data.RegistrationKey,
+		})
+		w.exit(evt.Type, exitRegistrationRequired, nil)
+		break
+	case "update":
+		if data.Status != "" && data.Status != w.status {
+			w.status = data.Status
+			w.output(&connectProgress{
+				Type:   "status",
+				Status: data.Status,
+			})
+		}
+
+		if data.Status == "connected" {
+			w.output(&connectProgress{
+				Type:       "result",
+				Result:     data.Status,
+				Code:       exitConnected,
+				ServerAddr: data.ServerAddr,
+				ClientAddr: data.ClientAddr,
+			})
+			os.Exit(exitConnected)
+		} else if data.Status == "disconnecting" {
+			sprfl, err := sprofile.Match(w.sprfl.Id)
+			if err == nil && !sprfl.State {
+				w.exit("stopped", exitStopped, nil)
+			}
+		}
+		break
+	}
+}
+
+var ConnectCmd = &cobra.Command{
+	Use:   "connect [profile_id]",
+	Short: "Start profile and optionally wait for connection",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cobra.CheckErr("cmd: Missing profile ID")
+		}
+
+		if !connectWait {
+			err := sprofile.Start(args[0], mode, password, passwordPrompt,
+				getCredentialHelper())
+			cobra.CheckErr(err)
+			return
+		}
+
+		sprfl, err := sprofile.Match(args[0])
+		cobra.CheckErr(err)
+
+		waiter := &connectWaiter{
+			sprfl: sprfl,
+		}
+
+		if sprfl.Profile != nil && sprfl.Profile.Status == "connected" {
+			waiter.output(&connectProgress{
+				Type:       "result",
+				Result:     sprfl.Profile.Status,
+				Code:       exitConnected,
+				ServerAddr: sprfl.Profile.ServerAddr,
+				ClientAddr: sprfl.Profile.ClientAddr,
+			})
+			return
+		}
+
+		var timeout <-chan time.Time
+		if connectTimeout > 0 {
+			timeout = time.After(connectTimeout)
+		}
+
+		opened := make(chan bool, 1)
+		events := make(chan *service.Event, 64)
+		go service.WatchEvents(func(evt *service.Event) {
+			if evt.Type == "open" {
+				select {
+				case opened <- true:
+				default:
+				}
+				return
+			}
+			events <- evt
+		})
+
+		select {
+		case <-opened:
+		case <-timeout:
+			waiter.exit("timeout", exitTimeout, nil)
+		}
+
+		err = sprfl.Start(mode, password, passwordPrompt,
+			getCredentialHelper())
+		if err != nil {
+			waiter.exit("error", exitError, err)
+		}
+
+		for {
+			select {
+			case evt := <-events:
+				waiter.handle(evt)
+			case <-timeout:
+				waiter.exit("timeout", exitTimeout, nil)
+			}
+		}
+	},
+}
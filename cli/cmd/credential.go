@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pritunl/pritunl-client-electron/cli/sprofile"
+	"github.com/spf13/cobra"
+)
+
+func getCredentialHelper() string {
+	if credentialHelper != "" {
+		return credentialHelper
+	}
+	return os.Getenv("PRITUNL_CREDENTIAL_HELPER")
+}
+
+var CredentialCmd = &cobra.Command{
+	Use:   "credential [profile_id]",
+	Short: "Show or set service credential helper for profile",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cobra.CheckErr("cmd: Missing profile ID")
+		}
+
+		sprfl, err := sprofile.Match(args[0])
+		cobra.CheckErr(err)
+
+		helper := sprfl.CredentialHelper
+
+		if credentialClear {
+			helper = ""
+		}
+		if cmd.Flags().Changed("helper") {
+			helper = credentialHelper
+		}
+
+		if !credentialClear && cmd.Flags().NFlag() == 0 {
+			fmt.Printf("Credential Helper: %s\n", helper)
+			return
+		}
+
+		err = sprofile.SetCredentialHelper(sprfl.Id, helper)
+		cobra.CheckErr(err)
+	},
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pritunl/pritunl-client-electron/cli/devicekey"
+	"github.com/pritunl/pritunl-client-electron/cli/terminal"
+	"github.com/spf13/cobra"
+)
+
+func printDeviceKey(status *devicekey.Status) {
+	fmt.Printf("Backend: %s\n", status.Backend)
+	if status.Locked {
+		fmt.Println("Public Key: Locked")
+	} else if status.Error != "" {
+		fmt.Printf("Error: %s\n", status.Error)
+	} else {
+		fmt.Printf("Public Key: %s\n", status.PublicKey)
+	}
+}
+
+func readPassphrase(confirm bool) string {
+	passphrase := terminal.ReadPassword("Device Key Passphrase")
+	if passphrase == "" {
+		cobra.CheckErr("cmd: Missing device key passphrase")
+	}
+
+	if confirm {
+		passphrase2 := terminal.ReadPassword("Confirm Passphrase")
+		if passphrase != passphrase2 {
+			cobra.CheckErr("cmd: Device key passphrases do not match")
+		}
+	}
+
+	return passphrase
+}
+
+var DeviceKeyCmd = &cobra.Command{
+	Use:   "device-key",
+	Short: "Show device authentication key",
+	Run: func(cmd *cobra.Command, args []string) {
+		status, err := devicekey.Get()
+		cobra.CheckErr(err)
+
+		printDeviceKey(status)
+	},
+}
+
+var DeviceKeyEnrollCmd = &cobra.Command{
+	Use:   "enroll",
+	Short: "Create device authentication key",
+	Run: func(cmd *cobra.Command, args []string) {
+		backend := deviceKeyBackend
+		if backend == "" {
+			status, err := devicekey.Get()
+			cobra.CheckErr(err)
+			backend = status.Backend
+		}
+
+		passphrase := ""
+		if backend == "software" {
+			passphrase = readPassphrase(true)
+		}
+
+		status, err := devicekey.Enroll(deviceKeyBackend, passphrase,
+			deviceKeyForce)
+		cobra.CheckErr(err)
+
+		printDeviceKey(status)
+	},
+}
+
+var DeviceKeyUnlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Unlock software device authentication key",
+	Run: func(cmd *cobra.Command, args []string) {
+		status, err := devicekey.Unlock(readPassphrase(false))
+		cobra.CheckErr(err)
+
+		printDeviceKey(status)
+	},
+}
+
+func init() {
+	DeviceKeyCmd.AddCommand(DeviceKeyEnrollCmd)
+	DeviceKeyCmd.AddCommand(DeviceKeyUnlockCmd)
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pritunl/pritunl-client-electron/cli/errortypes"
+	"github.com/pritunl/pritunl-client-electron/cli/sprofile"
+	"github.com/spf13/cobra"
+)
+
+var HistoryCmd = &cobra.Command{
+	Use:   "history [profile_id]",
+	Short: "Show connection history for profile",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cobra.CheckErr("cmd: Missing profile ID")
+		}
+
+		sprfl, err := sprofile.Match(args[0])
+		cobra.CheckErr(err)
+
+		sessions, err := sprfl.GetHistory()
+		cobra.CheckErr(err)
+
+		if jsonFormat || jsonFormated {
+			var output []byte
+			if jsonFormated {
+				output, err = json.MarshalIndent(sessions, "", "  ")
+				if err != nil {
+					err = &errortypes.ParseError{
+						errors.Wrap(err, "utils: Failed to marshal history"),
+					}
+					cobra.CheckErr(err)
+				}
+			} else {
+				output, err = json.Marshal(sessions)
+				if err != nil {
+					err = &errortypes.ParseError{
+						errors.Wrap(err, "utils: Failed to marshal history"),
+					}
+					cobra.CheckErr(err)
+				}
+			}
+
+			fmt.Println(string(output))
+		} else {
+			table := tablewriter.NewWriter(os.Stdout)
+
+			table.SetHeader([]string{
+				"Start",
+				"Duration",
+				"Mode",
+				"Remote",
+				"Server Address",
+				"Client Address",
+				"Received",
+				"Sent",
+				"Auth",
+				"Reason",
+			})
+			table.SetBorder(true)
+
+			for i := len(sessions) - 1; i >= 0; i-- {
+				sess := sessions[i]
+
+				reason := sess.Reason
+				if len(sess.Events) > 0 {
+					if reason != "" {
+						reason += ", "
+					}
+					reason += strings.Join(sess.Events, ", ")
+				}
+
+				table.Append([]string{
+					sess.FormatedStart(),
+					sess.FormatedDuration(),
+					sess.Mode,
+					valueOrDash(sess.Remote),
+					valueOrDash(sess.ServerAddr),
+					valueOrDash(sess.ClientAddr),
+					sess.FormatedRx(),
+					sess.FormatedTx(),
+					valueOrDash(sess.Auth),
+					valueOrDash(reason),
+				})
+			}
+
+			table.Render()
+		}
+	},
+}
+
+func valueOrDash(val string) string {
+	if val == "" {
+		return "-"
+	}
+	return val
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pritunl/pritunl-client-electron/cli/sprofile"
+	"github.com/spf13/cobra"
+)
+
+var HooksCmd = &cobra.Command{
+	Use:   "hooks [profile_id]",
+	Short: "Show or set connect and disconnect hooks for profile",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cobra.CheckErr("cmd: Missing profile ID")
+		}
+
+		sprfl, err := sprofile.Match(args[0])
+		cobra.CheckErr(err)
+
+		preConnect := sprfl.PreConnectHook
+		postConnect := sprfl.PostConnectHook
+		preDisconnect := sprfl.PreDisconnectHook
+		postDisconnect := sprfl.PostDisconnectHook
+		timeout := sprfl.HookTimeout
+
+		if hookClear {
+			preConnect = ""
+			postConnect = ""
+			preDisconnect = ""
+			postDisconnect = ""
+			timeout = 0
+		}
+		if cmd.Flags().Changed("pre-connect") {
+			preConnect = hookPreConn
+		}
+		if cmd.Flags().Changed("post-connect") {
+			postConnect = hookPostConn
+		}
+		if cmd.Flags().Changed("pre-disconnect") {
+			preDisconnect = hookPreDisc
+		}
+		if cmd.Flags().Changed("post-disconnect") {
+			postDisconnect = hookPostDisc
+		}
+		if cmd.Flags().Changed("timeout") {
+			timeout = hookTimeout
+		}
+
+		if !hookClear && cmd.Flags().NFlag() == 0 {
+			fmt.Printf("Pre Connect: %s\n", preConnect)
+			fmt.Printf("Post Connect: %s\n", postConnect)
+			fmt.Printf("Pre Disconnect: %s\n", preDisconnect)
+			fmt.Printf("Post Disconnect: %s\n", postDisconnect)
+			if timeout > 0 {
+				fmt.Printf("Timeout: %ds\n", timeout)
+			} else {
+				fmt.Println("Timeout: 30s")
+			}
+			return
+		}
+
+		err = sprofile.SetHooks(sprfl.Id, preConnect, postConnect,
+			preDisconnect, postDisconnect, timeout)
+		cobra.CheckErr(err)
+	},
+}
@@ -31,6 +31,12 @@ func init() {
 	RootCmd.AddCommand(LogsCmd)
 	RootCmd.AddCommand(ListCmd)
 	RootCmd.AddCommand(StartCmd)
+	RootCmd.AddCommand(ConnectCmd)
 	RootCmd.AddCommand(StopCmd)
 	RootCmd.AddCommand(WatchCmd)
+	RootCmd.AddCommand(SplitCmd)
+	RootCmd.AddCommand(HooksCmd)
+	RootCmd.AddCommand(CredentialCmd)
+	RootCmd.AddCommand(HistoryCmd)
+	RootCmd.AddCommand(DeviceKeyCmd)
 }
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pritunl/pritunl-client-electron/cli/sprofile"
+	"github.com/spf13/cobra"
+)
+
+var SplitCmd = &cobra.Command{
+	Use:   "split [profile_id]",
+	Short: "Show or set split tunnel applications for profile",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cobra.CheckErr("cmd: Missing profile ID")
+		}
+
+		sprfl, err := sprofile.Match(args[0])
+		cobra.CheckErr(err)
+
+		include := sprfl.SplitInclude
+		exclude := sprfl.SplitExclude
+
+		if splitClear {
+			include = []string{}
+			exclude = []string{}
+		}
+		if cmd.Flags().Changed("include") {
+			include = splitInclude
+		}
+		if cmd.Flags().Changed("exclude") {
+			exclude = splitExclude
+		}
+
+		if !splitClear && !cmd.Flags().Changed("include") &&
+			!cmd.Flags().Changed("exclude") {
+
+			fmt.Printf("Include: %s\n", strings.Join(include, ", "))
+			fmt.Printf("Exclude: %s\n", strings.Join(exclude, ", "))
+			return
+		}
+
+		err = sprofile.SetSplit(sprfl.Id, include, exclude)
+		cobra.CheckErr(err)
+	},
+}
@@ -1,20 +1,55 @@
 package cmd
 
+import (
+	"time"
+)
+
 var (
-	mode           string
-	password       string
-	passwordPrompt bool
-	jsonFormat     bool
-	jsonFormated   bool
+	mode             string
+	password         string
+	passwordPrompt   bool
+	jsonFormat       bool
+	jsonFormated     bool
+	splitInclude     []string
+	splitExclude     []string
+	splitClear       bool
+	connectWait      bool
+	connectTimeout   time.Duration
+	connectJson      bool
+	hookPreConn      string
+	hookPostConn     string
+	hookPreDisc      string
+	hookPostDisc     string
+	hookTimeout      int
+	hookClear        bool
+	deviceKeyBackend string
+	deviceKeyForce   bool
+	credentialHelper string
+	credentialClear  bool
 )
 
 func init() {
+	DeviceKeyEnrollCmd.Flags().StringVarP(
+		&deviceKeyBackend,
+		"backend",
+		"b",
+		"",
+		"Device key backend (tpm, pkcs11, software)",
+	)
+	DeviceKeyEnrollCmd.Flags().BoolVarP(
+		&deviceKeyForce,
+		"force",
+		"f",
+		false,
+		"Replace existing software device key",
+	)
+
 	StartCmd.Flags().StringVarP(
 		&mode,
 		"mode",
 		"m",
 		"",
-		"VPN mode (ovpn, wg)",
+		"VPN mode (ovpn, wg, wg-userspace)",
 	)
 	StartCmd.Flags().StringVarP(
 		&password,
@@ -30,6 +65,61 @@ func init() {
 		false,
 		"Prompt for VPN password",
 	)
+	StartCmd.Flags().StringVar(
+		&credentialHelper,
+		"credential-helper",
+		"",
+		"Command to read VPN password from credential helper",
+	)
+
+	ConnectCmd.Flags().StringVarP(
+		&mode,
+		"mode",
+		"m",
+		"",
+		"VPN mode (ovpn, wg, wg-userspace)",
+	)
+	ConnectCmd.Flags().StringVarP(
+		&password,
+		"password",
+		"p",
+		"",
+		"VPN password",
+	)
+	ConnectCmd.Flags().BoolVarP(
+		&passwordPrompt,
+		"password-read",
+		"r",
+		false,
+		"Prompt for VPN password",
+	)
+	ConnectCmd.Flags().StringVar(
+		&credentialHelper,
+		"credential-helper",
+		"",
+		"Command to read VPN password from credential helper",
+	)
+	ConnectCmd.Flags().BoolVarP(
+		&connectWait,
+		"wait",
+		"w",
+		false,
+		"Wait for connection and exit with connection result",
+	)
+	ConnectCmd.Flags().DurationVarP(
+		&connectTimeout,
+		"timeout",
+		"t",
+		defaultConnectTimeout,
+		"Maximum time to wait for connection, 0 to wait indefinitely",
+	)
+	ConnectCmd.Flags().BoolVarP(
+		&connectJson,
+		"json",
+		"j",
+		false,
+		"Output progress as JSON lines",
+	)
 
 	ListCmd.Flags().BoolVarP(
 		&jsonFormat,
@@ -46,4 +136,103 @@ func init() {
 		false,
 		"Format output in indented JSON",
 	)
+
+	HistoryCmd.Flags().BoolVarP(
+		&jsonFormat,
+		"json",
+		"j",
+		false,
+		"Format output in JSON",
+	)
+
+	HistoryCmd.Flags().BoolVarP(
+		&jsonFormated,
+		"json-formatted",
+		"f",
+		false,
+		"Format output in indented JSON",
+	)
+
+	SplitCmd.Flags().StringSliceVarP(
+		&splitInclude,
+		"include",
+		"i",
+		nil,
+		"Executables or systemd units to route through the tunnel",
+	)
+
+	SplitCmd.Flags().StringSliceVarP(
+		&splitExclude,
+		"exclude",
+		"e",
+		nil,
+		"Executables or systemd units to route outside the tunnel",
+	)
+
+	SplitCmd.Flags().BoolVarP(
+		&splitClear,
+		"clear",
+		"c",
+		false,
+		"Clear split tunnel applications",
+	)
+
+	HooksCmd.Flags().StringVar(
+		&hookPreConn,
+		"pre-connect",
+		"",
+		"Command to run before connecting",
+	)
+
+	HooksCmd.Flags().StringVar(
+		&hookPostConn,
+		"post-connect",
+		"",
+		"Command to run after connection is established",
+	)
+
+	HooksCmd.Flags().StringVar(
+		&hookPreDisc,
+		"pre-disconnect",
+		"",
+		"Command to run before disconnecting",
+	)
+
+	HooksCmd.Flags().StringVar(
+		&hookPostDisc,
+		"post-disconnect",
+		"",
+		"Command to run after disconnecting",
+	)
+
+	HooksCmd.Flags().IntVarP(
+		&hookTimeout,
+		"timeout",
+		"t",
+		0,
+		"Hook timeout in seconds (default 30)",
+	)
+
+	HooksCmd.Flags().BoolVarP(
+		&hookClear,
+		"clear",
+		"c",
+		false,
+		"Clear profile hooks",
+	)
+
+	CredentialCmd.Flags().StringVar(
+		&credentialHelper,
+		"helper",
+		"",
+		"Credential helper command run by the service",
+	)
+
+	CredentialCmd.Flags().BoolVarP(
+		&credentialClear,
+		"clear",
+		"c",
+		false,
+		"Clear profile credential helper",
+	)
 }
@@ -0,0 +1,77 @@
+// Runs credential helpers as the user, the helper input and the parsing
+// of the helper output are handled by the service credential package
+package credential
+
+import (
+	"bytes"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/cli/errortypes"
+)
+
+const (
+	defaultTimeout = 60 * time.Second
+)
+
+func helperCommand(helper string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "windows":
+		return exec.Command("cmd.exe", "/C", helper+" get")
+	default:
+		return exec.Command("/bin/sh", "-c", helper+" get")
+	}
+}
+
+// Run runs the credential helper with the input from the service and
+// returns the unparsed helper output
+func Run(helper, input string) (output string, err error) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	cmd := helperCommand(helper)
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = 3 * time.Second
+
+	err = cmd.Start()
+	if err != nil {
+		err = errortypes.ExecError{
+			errors.Wrap(err, "credential: Failed to start helper"),
+		}
+		return
+	}
+
+	waiter := make(chan error, 1)
+	go func() {
+		waiter <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-waiter:
+		if err != nil {
+			err = errortypes.ExecError{
+				errors.Wrapf(err, "credential: Helper failed '%s'",
+					strings.TrimSpace(stderr.String())),
+			}
+			return
+		}
+		break
+	case <-time.After(defaultTimeout):
+		_ = cmd.Process.Kill()
+		<-waiter
+		err = errortypes.ExecError{
+			errors.Newf("credential: Helper timed out after %s",
+				defaultTimeout),
+		}
+		return
+	}
+
+	output = stdout.String()
+
+	return
+}
@@ -0,0 +1,128 @@
+package devicekey
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"runtime"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/cli/errortypes"
+	"github.com/pritunl/pritunl-client-electron/cli/service"
+)
+
+type Status struct {
+	Backend   string `json:"backend"`
+	PublicKey string `json:"public_key"`
+	Locked    bool   `json:"locked"`
+	Error     string `json:"error"`
+}
+
+type keyData struct {
+	Backend    string `json:"backend"`
+	Passphrase string `json:"passphrase"`
+	Force      bool   `json:"force"`
+}
+
+func request(method, pth string, input interface{}) (
+	status *Status, err error) {
+
+	reqUrl := service.GetAddress() + pth
+
+	authKey, err := service.GetAuthKey()
+	if err != nil {
+		return
+	}
+
+	var body io.Reader
+	if input != nil {
+		data, e := json.Marshal(input)
+		if e != nil {
+			err = errortypes.RequestError{
+				errors.Wrap(e, "devicekey: Json marshal error"),
+			}
+			return
+		}
+		body = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequest(method, reqUrl, body)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "devicekey: Request failed"),
+		}
+		return
+	}
+
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		req.Host = "unix"
+	}
+	req.Header.Set("Auth-Key", authKey)
+	req.Header.Set("User-Agent", "pritunl")
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := service.GetClient().Do(req)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "devicekey: Request failed"),
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 403 {
+		err = errortypes.RequestError{
+			errors.New("devicekey: Permission denied"),
+		}
+		return
+	}
+
+	if resp.StatusCode == 401 {
+		err = errortypes.RequestError{
+			errors.New("devicekey: Invalid device key passphrase"),
+		}
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = errortypes.RequestError{
+			errors.Newf("devicekey: Unknown request error %d",
+				resp.StatusCode),
+		}
+		return
+	}
+
+	status = &Status{}
+	err = json.NewDecoder(resp.Body).Decode(status)
+	if err != nil {
+		err = errortypes.ParseError{
+			errors.Wrap(err, "devicekey: Failed to parse response"),
+		}
+		return
+	}
+
+	return
+}
+
+func Get() (status *Status, err error) {
+	return request("GET", "/device_key", nil)
+}
+
+func Enroll(backend, passphrase string, force bool) (
+	status *Status, err error) {
+
+	return request("POST", "/device_key/enroll", &keyData{
+		Backend:    backend,
+		Passphrase: passphrase,
+		Force:      force,
+	})
+}
+
+func Unlock(passphrase string) (status *Status, err error) {
+	return request("POST", "/device_key/unlock", &keyData{
+		Passphrase: passphrase,
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/pritunl/pritunl-client-electron/cli/service"
 	"github.com/pritunl/pritunl-client-electron/cli/sprofile"
 	"github.com/pritunl/tools/logger"
 )
@@ -32,12 +33,20 @@ var (
 
 type TickMsg time.Time
 
+type EventMsg *service.Event
+
 func TickInterval() tea.Cmd {
 	return tea.Tick(1*time.Second, func(t time.Time) tea.Msg {
 		return TickMsg(t)
 	})
 }
 
+func WaitEvent(events chan *service.Event) tea.Cmd {
+	return func() tea.Msg {
+		return EventMsg(<-events)
+	}
+}
+
 type Model struct {
 	listDelegate *ListDelegate
 	profiles     list.Model
@@ -48,6 +57,8 @@ type Model struct {
 	winWidth     int
 	winHeight    int
 	ready        bool
+	sprfls       []*sprofile.Sprofile
+	events       chan *service.Event
 
 	showDialog     bool
 	dialog         Dialog
@@ -56,7 +67,7 @@ type Model struct {
 }
 
 func (m Model) Init() tea.Cmd {
-	return TickInterval()
+	return tea.Batch(TickInterval(), WaitEvent(m.events))
 }
 
 func (m *Model) ConnectCallback(prompts []sprofile.Prompt,
@@ -260,6 +271,10 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		return m, nil
 	case TickMsg:
+		m.refresh()
+
+		return m, TickInterval()
+	case EventMsg:
 		err := m.Sync()
 		if err != nil {
 			logger.WithFields(logger.Fields{
@@ -267,7 +282,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}).Error("iface: Failed to sync profiles")
 		}
 
-		return m, TickInterval()
+		return m, WaitEvent(m.events)
 	}
 
 	profiles, cmd := m.profiles.Update(msg)
@@ -379,14 +394,21 @@ func (m Model) View() string {
 }
 
 func (m *Model) Sync() (err error) {
-	items := []list.Item{}
-
 	sprfls, err := sprofile.GetAll()
 	if err != nil {
 		return
 	}
 
-	for _, sprfl := range sprfls {
+	m.sprfls = sprfls
+	m.refresh()
+
+	return
+}
+
+func (m *Model) refresh() {
+	items := []list.Item{}
+
+	for _, sprfl := range m.sprfls {
 		statusLabel, status := sprfl.FormatedStatus()
 
 		if sprfl.Profile != nil {
@@ -434,8 +456,6 @@ func (m *Model) Sync() (err error) {
 	}
 
 	m.profiles.SetItems(items)
-
-	return
 }
 
 func NewModel() Model {
@@ -460,9 +480,17 @@ func NewModel() Model {
 		showDialog:   false,
 		dialog:       Dialog{},
 		dialogResult: "",
+		events:       make(chan *service.Event, 1),
 	}
 
 	_ = model.Sync()
 
+	go service.WatchEvents(func(evt *service.Event) {
+		select {
+		case model.events <- evt:
+		default:
+		}
+	})
+
 	return model
 }
@@ -32,6 +32,7 @@ type Profile struct {
 	MacAddr       string   `json:"mac_addr"`
 	MacAddrs      []string `json:"mac_addrs"`
 	SsoUrl        string   `json:"sso_url"`
+	ReconnectNext int64    `json:"reconnect_next"`
 }
 
 func (p *Profile) Uptime() int64 {
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/cli/errortypes"
+)
+
+var httpStreamClient = &http.Client{}
+
+var unixStreamClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", "/var/run/pritunl.sock")
+		},
+	},
+}
+
+type Event struct {
+	Id   string          `json:"id"`
+	Seq  uint64          `json:"seq"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func getStreamClient() *http.Client {
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		return unixStreamClient
+	} else {
+		return httpStreamClient
+	}
+}
+
+func streamEvents(lastSeq uint64, handler func(*Event)) (
+	seq uint64, err error) {
+
+	seq = lastSeq
+	reqUrl := GetAddress() + "/events/stream"
+
+	authKey, err := GetAuthKey()
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest("GET", reqUrl, nil)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "service: Events request failed"),
+		}
+		return
+	}
+
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		req.Host = "unix"
+	}
+	req.Header.Set("Auth-Key", authKey)
+	req.Header.Set("User-Agent", "pritunl")
+	req.Header.Set("Accept", "text/event-stream")
+	if seq != 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(seq, 10))
+	}
+
+	resp, err := getStreamClient().Do(req)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "service: Events request failed"),
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		err = errortypes.RequestError{
+			errors.Newf("service: Unknown events error %d",
+				resp.StatusCode),
+		}
+		return
+	}
+
+	handler(&Event{
+		Type: "open",
+	})
+
+	data := ""
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, e := reader.ReadString('\n')
+		if e != nil {
+			err = errortypes.ReadError{
+				errors.Wrap(e, "service: Events stream closed"),
+			}
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if data == "" {
+				continue
+			}
+
+			evt := &Event{}
+			e = json.Unmarshal([]byte(data), evt)
+			data = ""
+			if e != nil {
+				continue
+			}
+
+			if evt.Seq != 0 {
+				seq = evt.Seq
+			} else if evt.Type == "reset" {
+				seq = 0
+			}
+
+			handler(evt)
+		} else if strings.HasPrefix(line, "data:") {
+			data += strings.TrimSpace(line[5:])
+		}
+	}
+}
+
+// WatchEvents streams service events in order, reconnecting and resuming
+// from the last received event id.
+func WatchEvents(handler func(*Event)) {
+	seq := uint64(0)
+
+	for {
+		seq, _ = streamEvents(seq, handler)
+
+		handler(&Event{
+			Type: "close",
+		})
+
+		time.Sleep(1 * time.Second)
+	}
+}
@@ -0,0 +1,123 @@
+package sprofile
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/cli/errortypes"
+	"github.com/pritunl/pritunl-client-electron/cli/service"
+)
+
+type Session struct {
+	Id         string   `json:"id"`
+	Mode       string   `json:"mode"`
+	Start      int64    `json:"start"`
+	End        int64    `json:"end"`
+	Connected  int64    `json:"connected"`
+	Remote     string   `json:"remote"`
+	ClientAddr string   `json:"client_addr"`
+	ServerAddr string   `json:"server_addr"`
+	RxBytes    int64    `json:"rx_bytes"`
+	TxBytes    int64    `json:"tx_bytes"`
+	Auth       string   `json:"auth"`
+	Reason     string   `json:"reason"`
+	Events     []string `json:"events"`
+}
+
+func (s *Session) FormatedStart() string {
+	return time.Unix(s.Start, 0).Format("2006-01-02 15:04:05")
+}
+
+func (s *Session) FormatedDuration() string {
+	if s.Connected == 0 || s.End == 0 {
+		return "-"
+	}
+
+	duration := time.Duration(s.End-s.Connected) * time.Second
+	if duration < 0 {
+		duration = 0
+	}
+
+	return duration.String()
+}
+
+func formatBytes(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value := float64(size)
+	units := []string{"KB", "MB", "GB", "TB"}
+	unit := ""
+	for _, unit = range units {
+		value /= 1024
+		if value < 1024 {
+			break
+		}
+	}
+
+	return fmt.Sprintf("%.1f %s", value, unit)
+}
+
+func (s *Session) FormatedRx() string {
+	return formatBytes(s.RxBytes)
+}
+
+func (s *Session) FormatedTx() string {
+	return formatBytes(s.TxBytes)
+}
+
+func (s *Sprofile) GetHistory() (sessions []*Session, err error) {
+	reqUrl := service.GetAddress() + "/sprofile/" + s.Id + "/history"
+
+	authKey, err := service.GetAuthKey()
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest("GET", reqUrl, nil)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Get request failed"),
+		}
+		return
+	}
+
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		req.Host = "unix"
+	}
+	req.Header.Set("Auth-Key", authKey)
+	req.Header.Set("User-Agent", "pritunl")
+
+	resp, err := service.GetClient().Do(req)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Request failed"),
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		err = errortypes.RequestError{
+			errors.Newf("sprofile: Unknown request error %d",
+				resp.StatusCode),
+		}
+		return
+	}
+
+	sessions = []*Session{}
+	err = json.NewDecoder(resp.Body).Decode(&sessions)
+	if err != nil {
+		err = errortypes.ParseError{
+			errors.Wrap(err, "sprofile: Failed to parse response"),
+		}
+		return
+	}
+
+	return
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/dropbox/godropbox/errors"
 	"github.com/pritunl/pritunl-client-electron/cli/errortypes"
@@ -37,6 +38,15 @@ type Sprofile struct {
 	DisableDns         bool                  `json:"disable_dns"`
 	RestrictClient     bool                  `json:"restrict_client"`
 	ForceDns           bool                  `json:"force_dns"`
+	Lockdown           bool                  `json:"lockdown"`
+	SplitInclude       []string              `json:"split_include"`
+	SplitExclude       []string              `json:"split_exclude"`
+	PreConnectHook     string                `json:"pre_connect_hook"`
+	PostConnectHook    string                `json:"post_connect_hook"`
+	PreDisconnectHook  string                `json:"pre_disconnect_hook"`
+	PostDisconnectHook string                `json:"post_disconnect_hook"`
+	HookTimeout        int                   `json:"hook_timeout"`
+	CredentialHelper   string                `json:"credential_helper"`
 	SsoAuth            bool                  `json:"sso_auth"`
 	PasswordMode       string                `json:"password_mode"`
 	Token              bool                  `json:"token"`
@@ -48,6 +58,7 @@ type Sprofile struct {
 	SyncToken          string                `json:"sync_token"`
 	ServerPublicKey    []string              `json:"server_public_key"`
 	ServerBoxPublicKey string                `json:"server_box_public_key"`
+	ServerSpkiHash     []string              `json:"server_spki_hash"`
 	RegistrationKey    string                `json:"registration_key"`
 	OvpnData           string                `json:"ovpn_data"`
 	Password           string                `json:"password"`
@@ -99,6 +110,13 @@ func (s *Sprofile) FormatedStatus() (label, status string) {
 		return "Status", "Disconnected"
 	}
 
+	if s.Profile.Status == "" || s.Profile.Status == "disconnected" {
+		retry := s.Profile.ReconnectNext - time.Now().Unix()
+		if s.State && retry > 0 {
+			return "Status", fmt.Sprintf("Retrying in %ds", retry)
+		}
+	}
+
 	if s.Profile.Status == "" {
 		if s.State {
 			return "Status", "Connecting"
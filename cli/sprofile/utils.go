@@ -16,6 +16,7 @@ import (
 
 	"github.com/dropbox/godropbox/container/set"
 	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/cli/credential"
 	"github.com/pritunl/pritunl-client-electron/cli/errortypes"
 	"github.com/pritunl/pritunl-client-electron/cli/profile"
 	"github.com/pritunl/pritunl-client-electron/cli/service"
@@ -67,6 +68,7 @@ type SprofileData struct {
 	TokenTtl           int    `json:"token_ttl"`
 	Reconnect          bool   `json:"reconnect"`
 	Timeout            bool   `json:"timeout"`
+	CredentialOutput   string `json:"credential_output"`
 }
 
 func Match(sprflId string) (sprfl *Sprofile, err error) {
@@ -424,17 +426,48 @@ func PasswordPrompts(sprfl *Sprofile) (prompts []Prompt) {
 	return
 }
 
-func Start(sprflId, mode, password string, passwordPrompt bool) (err error) {
+func Start(sprflId, mode, password string, passwordPrompt bool,
+	credHelper string) (err error) {
+
 	sprfl, err := Match(sprflId)
 	if err != nil {
 		return
 	}
 
+	err = sprfl.Start(mode, password, passwordPrompt, credHelper)
+	if err != nil {
+		return
+	}
+
+	if sprfl.SsoAuth {
+		for i := 0; i < 50; i++ {
+			prfl, e := profile.Get(sprfl.Id)
+			if e != nil {
+				break
+			}
+
+			if prfl != nil && prfl.SsoUrl != "" {
+				fmt.Println("Single sign-on authentication required, " +
+					"open link to complete authentication:")
+				fmt.Println(prfl.SsoUrl)
+				break
+			}
+
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	return
+}
+
+func (s *Sprofile) Start(mode, password string, passwordPrompt bool,
+	credHelper string) (err error) {
+
 	if mode == "" {
-		if sprfl.HideOvpn {
+		if s.HideOvpn && s.LastMode != "wg-userspace" {
 			mode = "wg"
 		} else {
-			mode = sprfl.LastMode
+			mode = s.LastMode
 			if mode == "" {
 				mode = "ovpn"
 			}
@@ -442,7 +475,7 @@ func Start(sprflId, mode, password string, passwordPrompt bool) (err error) {
 	}
 
 	switch mode {
-	case "ovpn", "wg":
+	case "ovpn", "wg", "wg-userspace":
 		break
 	default:
 		err = errortypes.NotFoundError{
@@ -453,8 +486,22 @@ func Start(sprflId, mode, password string, passwordPrompt bool) (err error) {
 
 	reqUrl := service.GetAddress() + "/profile"
 
-	if passwordPrompt {
-		password, err = PasswordPrompt(sprfl)
+	credOutput := ""
+	if password == "" && credHelper != "" &&
+		(passwordPrompt || s.PasswordMode != "") {
+
+		credInput, e := getCredentialInput(s.Id)
+		if e != nil {
+			err = e
+			return
+		}
+
+		credOutput, err = credential.Run(credHelper, credInput)
+		if err != nil {
+			return
+		}
+	} else if passwordPrompt {
+		password, err = PasswordPrompt(s)
 		if err != nil {
 			return
 		}
@@ -466,9 +513,10 @@ func Start(sprflId, mode, password string, passwordPrompt bool) (err error) {
 	}
 
 	data, err := json.Marshal(&SprofileData{
-		Id:       sprfl.Id,
-		Mode:     mode,
-		Password: password,
+		Id:               s.Id,
+		Mode:             mode,
+		Password:         password,
+		CredentialOutput: credOutput,
 	})
 	if err != nil {
 		err = errortypes.RequestError{
@@ -511,24 +559,6 @@ func Start(sprflId, mode, password string, passwordPrompt bool) (err error) {
 		return
 	}
 
-	if sprfl.SsoAuth {
-		for i := 0; i < 50; i++ {
-			prfl, e := profile.Get(sprfl.Id)
-			if e != nil {
-				break
-			}
-
-			if prfl != nil && prfl.SsoUrl != "" {
-				fmt.Println("Single sign-on authentication required, " +
-					"open link to complete authentication:")
-				fmt.Println(prfl.SsoUrl)
-				break
-			}
-
-			time.Sleep(100 * time.Millisecond)
-		}
-	}
-
 	return
 }
 
@@ -562,7 +592,7 @@ func StartCallback(sprflId, mode string, callback Callback) {
 	}
 
 	switch mode {
-	case "ovpn", "wg":
+	case "ovpn", "wg", "wg-userspace":
 		break
 	default:
 		err = errortypes.NotFoundError{
@@ -763,6 +793,274 @@ func SetState(sprflId string, state bool) (err error) {
 	return
 }
 
+type splitData struct {
+	SplitInclude []string `json:"split_include"`
+	SplitExclude []string `json:"split_exclude"`
+}
+
+func SetSplit(sprflId string, include, exclude []string) (err error) {
+	sprfl, err := Match(sprflId)
+	if err != nil {
+		return
+	}
+
+	if include == nil {
+		include = []string{}
+	}
+	if exclude == nil {
+		exclude = []string{}
+	}
+
+	reqUrl := service.GetAddress() + "/sprofile/" + sprfl.Id + "/split"
+
+	authKey, err := service.GetAuthKey()
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(&splitData{
+		SplitInclude: include,
+		SplitExclude: exclude,
+	})
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Json marshal error"),
+		}
+		return
+	}
+
+	body := bytes.NewBuffer(data)
+
+	req, err := http.NewRequest("PUT", reqUrl, body)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Put request failed"),
+		}
+		return
+	}
+
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		req.Host = "unix"
+	}
+	req.Header.Set("Auth-Key", authKey)
+	req.Header.Set("User-Agent", "pritunl")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := service.GetClient().Do(req)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Request failed"),
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		err = errortypes.RequestError{
+			errors.Newf("sprofile: Unknown request error %d",
+				resp.StatusCode),
+		}
+		return
+	}
+
+	return
+}
+
+type hooksData struct {
+	PreConnectHook     string `json:"pre_connect_hook"`
+	PostConnectHook    string `json:"post_connect_hook"`
+	PreDisconnectHook  string `json:"pre_disconnect_hook"`
+	PostDisconnectHook string `json:"post_disconnect_hook"`
+	HookTimeout        int    `json:"hook_timeout"`
+}
+
+func SetHooks(sprflId, preConnect, postConnect, preDisconnect,
+	postDisconnect string, timeout int) (err error) {
+
+	sprfl, err := Match(sprflId)
+	if err != nil {
+		return
+	}
+
+	reqUrl := service.GetAddress() + "/sprofile/" + sprfl.Id + "/hooks"
+
+	authKey, err := service.GetAuthKey()
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(&hooksData{
+		PreConnectHook:     preConnect,
+		PostConnectHook:    postConnect,
+		PreDisconnectHook:  preDisconnect,
+		PostDisconnectHook: postDisconnect,
+		HookTimeout:        timeout,
+	})
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Json marshal error"),
+		}
+		return
+	}
+
+	body := bytes.NewBuffer(data)
+
+	req, err := http.NewRequest("PUT", reqUrl, body)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Put request failed"),
+		}
+		return
+	}
+
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		req.Host = "unix"
+	}
+	req.Header.Set("Auth-Key", authKey)
+	req.Header.Set("User-Agent", "pritunl")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := service.GetClient().Do(req)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Request failed"),
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		err = errortypes.RequestError{
+			errors.Newf("sprofile: Unknown request error %d",
+				resp.StatusCode),
+		}
+		return
+	}
+
+	return
+}
+
+type credentialData struct {
+	CredentialHelper string `json:"credential_helper"`
+}
+
+type credentialInput struct {
+	Input string `json:"input"`
+}
+
+func getCredentialInput(sprflId string) (input string, err error) {
+	reqUrl := service.GetAddress() + "/sprofile/" + sprflId + "/credential"
+
+	authKey, err := service.GetAuthKey()
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest("GET", reqUrl, nil)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Get request failed"),
+		}
+		return
+	}
+
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		req.Host = "unix"
+	}
+	req.Header.Set("Auth-Key", authKey)
+	req.Header.Set("User-Agent", "pritunl")
+
+	resp, err := service.GetClient().Do(req)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Request failed"),
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		err = errortypes.RequestError{
+			errors.Newf("sprofile: Unknown request error %d",
+				resp.StatusCode),
+		}
+		return
+	}
+
+	data := &credentialInput{}
+	err = json.NewDecoder(resp.Body).Decode(data)
+	if err != nil {
+		err = errortypes.ParseError{
+			errors.Wrap(err, "sprofile: Failed to parse response"),
+		}
+		return
+	}
+
+	input = data.Input
+
+	return
+}
+
+func SetCredentialHelper(sprflId, helper string) (err error) {
+	sprfl, err := Match(sprflId)
+	if err != nil {
+		return
+	}
+
+	reqUrl := service.GetAddress() + "/sprofile/" + sprfl.Id + "/credential"
+
+	authKey, err := service.GetAuthKey()
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(&credentialData{
+		CredentialHelper: helper,
+	})
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Json marshal error"),
+		}
+		return
+	}
+
+	body := bytes.NewBuffer(data)
+
+	req, err := http.NewRequest("PUT", reqUrl, body)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Put request failed"),
+		}
+		return
+	}
+
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		req.Host = "unix"
+	}
+	req.Header.Set("Auth-Key", authKey)
+	req.Header.Set("User-Agent", "pritunl")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := service.GetClient().Do(req)
+	if err != nil {
+		err = errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Request failed"),
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		err = errortypes.RequestError{
+			errors.Newf("sprofile: Unknown request error %d",
+				resp.StatusCode),
+		}
+		return
+	}
+
+	return
+}
+
 func Import(data string) (err error) {
 	proflId, err := utils.RandStr(16)
 	if err != nil {
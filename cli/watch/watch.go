@@ -2,6 +2,7 @@ package watch
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/dropbox/godropbox/errors"
@@ -9,11 +10,44 @@ import (
 	"github.com/gizak/termui/v3/widgets"
 	"github.com/pritunl/pritunl-client-electron/cli/constants"
 	"github.com/pritunl/pritunl-client-electron/cli/errortypes"
+	"github.com/pritunl/pritunl-client-electron/cli/service"
 	"github.com/pritunl/pritunl-client-electron/cli/sprofile"
 )
 
+var (
+	sprfls     []*sprofile.Sprofile
+	sprflsErr  error
+	sprflsLock sync.Mutex
+	updated    = make(chan bool, 1)
+)
+
+func update() {
+	data, err := sprofile.GetAll()
+
+	sprflsLock.Lock()
+	sprfls = data
+	sprflsErr = err
+	sprflsLock.Unlock()
+
+	select {
+	case updated <- true:
+	default:
+	}
+}
+
+func watchEvents() {
+	service.WatchEvents(func(evt *service.Event) {
+		update()
+	})
+}
+
 func refresh() {
 	for {
+		sprflsLock.Lock()
+		sprfls := sprfls
+		err := sprflsErr
+		sprflsLock.Unlock()
+
 		grid := termui.NewGrid()
 
 		termW, termH := termui.TerminalDimensions()
@@ -21,7 +55,6 @@ func refresh() {
 
 		table := widgets.NewTable()
 
-		sprfls, err := sprofile.GetAll()
 		if err != nil {
 			termui.Clear()
 
@@ -90,7 +123,10 @@ func refresh() {
 			termui.Render(grid)
 		}
 
-		time.Sleep(1 * time.Second)
+		select {
+		case <-updated:
+		case <-time.After(1 * time.Second):
+		}
 	}
 }
 
@@ -104,6 +140,9 @@ func Init() (err error) {
 	}
 	defer termui.Close()
 
+	update()
+
+	go watchEvents()
 	go refresh()
 
 	uiEvents := termui.PollEvents()
@@ -0,0 +1,210 @@
+package certpin
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+)
+
+const (
+	handshakeTimeout = 8 * time.Second
+)
+
+var (
+	store     = map[string]map[string]string{}
+	storeLock = sync.Mutex{}
+)
+
+// Pin verifies the leaf certificate of servers against the pinned hashes
+// from the server configuration, when none are configured each host is
+// pinned to the first certificate it presents
+type Pin struct {
+	lock       sync.Mutex
+	hashes     []string
+	hostHashes map[string]string
+	OnCapture  func(host, hash string)
+	OnMismatch func(host, hash string)
+}
+
+func (p *Pin) Hashes() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	hashes := make([]string, len(p.hashes))
+	copy(hashes, p.hashes)
+
+	return hashes
+}
+
+func (p *Pin) HostHashes() map[string]string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return copyHostHashes(p.hostHashes)
+}
+
+func (p *Pin) verify(host string, rawCerts [][]byte) (err error) {
+	if len(rawCerts) == 0 {
+		err = &errortypes.CertificateError{
+			errors.New("certpin: Server did not present a certificate"),
+		}
+		return
+	}
+
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		err = &errortypes.CertificateError{
+			errors.Wrap(err, "certpin: Failed to parse certificate"),
+		}
+		return
+	}
+	certHash := Hash(cert)
+
+	p.lock.Lock()
+	pinned := p.hashes
+	if len(pinned) == 0 {
+		hostHash := p.hostHashes[host]
+		if hostHash == "" {
+			if p.hostHashes == nil {
+				p.hostHashes = map[string]string{}
+			}
+			p.hostHashes[host] = certHash
+			p.lock.Unlock()
+
+			if p.OnCapture != nil {
+				p.OnCapture(host, certHash)
+			}
+			return
+		}
+		pinned = []string{hostHash}
+	}
+
+	for _, hash := range pinned {
+		if subtle.ConstantTimeCompare(
+			[]byte(hash), []byte(certHash)) == 1 {
+
+			p.lock.Unlock()
+			return
+		}
+	}
+	p.lock.Unlock()
+
+	if p.OnMismatch != nil {
+		p.OnMismatch(host, certHash)
+	}
+
+	err = &errortypes.CertificateError{
+		errors.Newf("certpin: Server certificate hash '%s' for '%s' does "+
+			"not match pinned hash", certHash, host),
+	}
+	return
+}
+
+func (p *Pin) TlsConfig(host string) *tls.Config {
+	return &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte,
+			_ [][]*x509.Certificate) error {
+
+			return p.verify(host, rawCerts)
+		},
+		MinVersion: tls.VersionTLS12,
+		MaxVersion: tls.VersionTLS13,
+	}
+}
+
+// DialTls is used as the transport DialTLSContext to verify each
+// connection against the pin of the host being dialed
+func (p *Pin) DialTls(ctx context.Context, network, addr string) (
+	conn net.Conn, err error) {
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "certpin: Failed to parse address"),
+		}
+		return
+	}
+
+	dialer := &net.Dialer{}
+	rawConn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return
+	}
+
+	handshakeCtx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	tlsConn := tls.Client(rawConn, p.TlsConfig(host))
+	err = tlsConn.HandshakeContext(handshakeCtx)
+	if err != nil {
+		_ = rawConn.Close()
+		return
+	}
+
+	conn = tlsConn
+	return
+}
+
+func New(hashes []string, hostHashes map[string]string) (pin *Pin) {
+	pin = &Pin{
+		hostHashes: copyHostHashes(hostHashes),
+	}
+	for _, hash := range hashes {
+		if hash != "" {
+			pin.hashes = append(pin.hashes, hash)
+		}
+	}
+
+	return
+}
+
+func Hash(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func copyHostHashes(hostHashes map[string]string) (
+	hostHashesCopy map[string]string) {
+
+	hostHashesCopy = map[string]string{}
+	for host, hash := range hostHashes {
+		hostHashesCopy[host] = hash
+	}
+
+	return
+}
+
+func Get(prflId string) (hostHashes map[string]string) {
+	storeLock.Lock()
+	hostHashes = copyHostHashes(store[prflId])
+	storeLock.Unlock()
+	return
+}
+
+func Set(prflId, host, hash string) {
+	storeLock.Lock()
+	hostHashes := store[prflId]
+	if hostHashes == nil {
+		hostHashes = map[string]string{}
+		store[prflId] = hostHashes
+	}
+	hostHashes[host] = hash
+	storeLock.Unlock()
+}
+
+func Clear(prflId string) {
+	storeLock.Lock()
+	delete(store, prflId)
+	storeLock.Unlock()
+}
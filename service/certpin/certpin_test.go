@@ -0,0 +1,96 @@
+package certpin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newTestCert(t *testing.T, name string) (raw []byte, hash string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: name,
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+	}
+
+	raw, err = x509.CreateCertificate(rand.Reader, tmpl, tmpl,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash = Hash(cert)
+	return
+}
+
+func TestVerifyLeafOnly(t *testing.T) {
+	leaf, _ := newTestCert(t, "leaf")
+	pinned, pinnedHash := newTestCert(t, "pinned")
+
+	pin := New([]string{pinnedHash}, nil)
+
+	err := pin.verify("host", [][]byte{leaf, pinned})
+	if err == nil {
+		t.Fatal("certpin: Expected mismatch with appended pinned cert")
+	}
+
+	err = pin.verify("host", [][]byte{pinned, leaf})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyHostCapture(t *testing.T) {
+	cert1, hash1 := newTestCert(t, "host1")
+	cert2, hash2 := newTestCert(t, "host2")
+
+	captured := map[string]string{}
+	pin := New(nil, nil)
+	pin.OnCapture = func(host, hash string) {
+		captured[host] = hash
+	}
+
+	err := pin.verify("host1", [][]byte{cert1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = pin.verify("host2", [][]byte{cert2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if captured["host1"] != hash1 || captured["host2"] != hash2 {
+		t.Fatal("certpin: Unexpected captured host hashes")
+	}
+
+	err = pin.verify("host1", [][]byte{cert2})
+	if err == nil {
+		t.Fatal("certpin: Expected mismatch for changed host cert")
+	}
+
+	hostHashes := pin.HostHashes()
+	if len(hostHashes) != 2 || hostHashes["host1"] != hash1 {
+		t.Fatal("certpin: Unexpected host hashes")
+	}
+}
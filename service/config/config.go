@@ -7,6 +7,7 @@ import (
 
 	"github.com/dropbox/godropbox/errors"
 	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/types"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -18,16 +19,38 @@ var (
 )
 
 type ConfigData struct {
-	path              string `json:"-"`
-	loaded            bool   `json:"-"`
-	DisableDnsWatch   bool   `json:"disable_dns_watch"`
-	EnableDnsRefresh  bool   `json:"enable_dns_refresh"`
-	DisableWakeWatch  bool   `json:"disable_wake_watch"`
-	DisableNetClean   bool   `json:"disable_net_clean"`
-	DisableWgDns      bool   `json:"disable_wg_dns"`
-	ForceLocalTpm     bool   `json:"force_local_tpm"`
-	InterfaceMetric   int    `json:"interface_metric"`
-	EnclavePrivateKey string `json:"enclave_private_key"`
+	path              string                 `json:"-"`
+	loaded            bool                   `json:"-"`
+	DisableDnsWatch   bool                   `json:"disable_dns_watch"`
+	EnableDnsRefresh  bool                   `json:"enable_dns_refresh"`
+	DisableWakeWatch  bool                   `json:"disable_wake_watch"`
+	DisableNetWatch   bool                   `json:"disable_net_watch"`
+	DisableNetClean   bool                   `json:"disable_net_clean"`
+	DisableWgDns      bool                   `json:"disable_wg_dns"`
+	EnableDnsProxy    bool                   `json:"enable_dns_proxy"`
+	DnsProxyAddress   string                 `json:"dns_proxy_address"`
+	ForceLocalTpm     bool                   `json:"force_local_tpm"`
+	DeviceKeyBackend  string                 `json:"device_key_backend"`
+	DeviceKeyPath     string                 `json:"device_key_path"`
+	DeviceKeyPassPath string                 `json:"device_key_pass_path"`
+	Pkcs11Module      string                 `json:"pkcs11_module"`
+	Pkcs11Token       string                 `json:"pkcs11_token"`
+	Pkcs11Pin         string                 `json:"pkcs11_pin"`
+	Pkcs11KeyLabel    string                 `json:"pkcs11_key_label"`
+	InterfaceMetric   int                    `json:"interface_metric"`
+	ConflictPolicy    string                 `json:"conflict_policy"`
+	WgHandshakeStale  int                    `json:"wg_handshake_stale"`
+	ReconnectPolicy   *types.ReconnectPolicy `json:"reconnect_policy"`
+	CredentialHelper  string                 `json:"credential_helper"`
+	AdminGroup        string                 `json:"admin_group"`
+	LogJson           bool                   `json:"log_json"`
+	LogMaxSize        int                    `json:"log_max_size"`
+	LogJsonMaxSize    int                    `json:"log_json_max_size"`
+	LogMaxFiles       int                    `json:"log_max_files"`
+	ProfilePlaintext  bool                   `json:"profile_plaintext"`
+	EnclavePrivateKey string                 `json:"enclave_private_key"`
+	TokenSecret       string                 `json:"token_secret"`
+	ProfileSecret     string                 `json:"profile_secret"`
 }
 
 func (c *ConfigData) Save() (err error) {
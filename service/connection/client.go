@@ -9,7 +9,6 @@ import (
 	"crypto/rsa"
 	"crypto/sha512"
 	"crypto/subtle"
-	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
@@ -25,11 +24,13 @@ import (
 	"time"
 
 	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/certpin"
 	"github.com/pritunl/pritunl-client-electron/service/config"
 	"github.com/pritunl/pritunl-client-electron/service/constants"
 	"github.com/pritunl/pritunl-client-electron/service/errortypes"
 	"github.com/pritunl/pritunl-client-electron/service/event"
 	"github.com/pritunl/pritunl-client-electron/service/sprofile"
+	"github.com/pritunl/pritunl-client-electron/service/token"
 	"github.com/pritunl/pritunl-client-electron/service/tpm"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
 	"github.com/sirupsen/logrus"
@@ -41,21 +42,15 @@ const (
 	GlobalTimeoutPreAuth = 180 * time.Second
 )
 
-var (
-	clientTransport = &http.Transport{
-		DisableKeepAlives:   true,
-		TLSHandshakeTimeout: 8 * time.Second,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-			MinVersion:         tls.VersionTLS12,
-			MaxVersion:         tls.VersionTLS13,
+func newClient(pin *certpin.Pin) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			DialTLSContext:    pin.DialTls,
 		},
+		Timeout: 40 * time.Second,
 	}
-	clientInsecure = &http.Client{
-		Transport: clientTransport,
-		Timeout:   40 * time.Second,
-	}
-)
+}
 
 type ReqBox struct {
 	DeviceId       string   `json:"device_id"`
@@ -140,7 +135,12 @@ type Client struct {
 	disconnect        bool
 	disconnected      bool
 	disconnectWaiters []chan bool
+	hooksLock         sync.Mutex
+	hooksConnected    bool
 	startTime         time.Time
+	remote            string
+	pin               *certpin.Pin
+	httpClient        *http.Client
 }
 
 func (c *Client) Fields() logrus.Fields {
@@ -150,13 +150,52 @@ func (c *Client) Fields() logrus.Fields {
 		"client_disconnect_waiters": len(c.disconnectWaiters),
 		"client_provider":           c.prov != nil,
 		"client_startime":           utils.SinceFormatted(c.startTime),
+		"client_remote":             c.remote,
+	}
+}
+
+func (c *Client) initPin() {
+	hostHashes := certpin.Get(c.conn.Profile.Id)
+	for host, hash := range c.conn.Profile.HostSpkiHash {
+		hostHashes[host] = hash
+	}
+
+	c.pin = certpin.New(c.conn.Profile.ServerSpkiHash, hostHashes)
+	c.pin.OnCapture = func(host, hash string) {
+		logrus.WithFields(c.conn.Fields(logrus.Fields{
+			"host": host,
+			"hash": hash,
+		})).Info("profile: Pinned server certificate")
+
+		certpin.Set(c.conn.Profile.Id, host, hash)
+
+		if c.conn.Profile.SystemProfile {
+			err := sprofile.SetHostSpkiHash(c.conn.Profile.Id, host, hash)
+			if err != nil {
+				logrus.WithFields(c.conn.Fields(logrus.Fields{
+					"error": err,
+				})).Error("profile: Failed to store server certificate pin")
+			}
+		}
+	}
+	c.pin.OnMismatch = func(host, hash string) {
+		logrus.WithFields(c.conn.Fields(logrus.Fields{
+			"host": host,
+			"hash": hash,
+		})).Error("profile: Server certificate does not match pin")
+
+		c.conn.Data.SendProfileEvent("cert_mismatch")
 	}
+
+	c.httpClient = newClient(c.pin)
 }
 
 func (c *Client) Start(prov Provider) (err error) {
 	c.prov = prov
 	c.startTime = time.Now()
 
+	c.initPin()
+
 	GlobalStore.UnsetAuthConnect(c.conn.Id)
 
 	err = c.prov.PreConnect()
@@ -170,6 +209,8 @@ func (c *Client) Start(prov Provider) (err error) {
 		return
 	}
 
+	c.conn.runHook(HookPreConnect)
+
 	c.conn.Data.UpdateEvent()
 
 	err = c.conn.Data.ParseProfile()
@@ -178,12 +219,19 @@ func (c *Client) Start(prov Provider) (err error) {
 		return
 	}
 
+	err = c.conn.updateLockdown()
+	if err != nil {
+		c.conn.State.SetStop()
+		c.conn.State.Close()
+		return
+	}
+
 	if c.conn.State.IsStop() {
 		c.conn.State.Close()
 		return
 	}
 
-	if c.conn.Profile.Mode == WgMode ||
+	if c.conn.Profile.IsWg() ||
 		c.conn.Profile.DynamicFirewall ||
 		c.conn.Profile.SsoAuth ||
 		c.conn.Profile.DeviceAuth {
@@ -233,7 +281,7 @@ func (c *Client) Start(prov Provider) (err error) {
 func (c *Client) globalTimeout(timeout time.Duration) {
 	for i := 0; i < int(timeout.Seconds()); i++ {
 		time.Sleep(1 * time.Second)
-		if c.conn.Data.Status == Connected ||
+		if c.conn.Data.GetStatus() == Connected ||
 			c.conn.State.IsStop() {
 
 			break
@@ -244,7 +292,7 @@ func (c *Client) globalTimeout(timeout time.Duration) {
 		return
 	}
 
-	if c.conn.Data.Status != Connected {
+	if c.conn.Data.GetStatus() != Connected {
 		logrus.WithFields(c.conn.Fields(logrus.Fields{
 			"global_timeout": timeout.Seconds(),
 		})).Error("profile: Global connection timeout")
@@ -298,6 +346,8 @@ func (c *Client) connectPreAuth() (err error) {
 				break
 			}
 		} else {
+			c.remote = remote.Host
+			c.conn.State.SetSessionRemote(remote.Host)
 			break
 		}
 
@@ -314,6 +364,9 @@ func (c *Client) connectPreAuth() (err error) {
 
 	if len(connErrors) > 0 && data == nil {
 		if evt != nil {
+			if evt.Type == "offline_error" {
+				c.conn.State.SetReconnectReason(ReconnectOffline)
+			}
 			evt.Init()
 		} else {
 			c.conn.Data.SendProfileEvent("connection_error")
@@ -329,6 +382,7 @@ func (c *Client) connectPreAuth() (err error) {
 		logrus.Error("profile: All connection requests failed, " +
 			"view previous errors for each attempt")
 
+		c.conn.State.SetSessionAuth(AuthFailed)
 		c.conn.State.Close()
 
 		err = connErrors[len(connErrors)-1].Error
@@ -364,6 +418,7 @@ func (c *Client) connectPreAuth() (err error) {
 
 			c.conn.Data.RegistrationKey = data.RegKey
 			c.conn.State.NoReconnect("client_device_registration")
+			c.conn.State.SetSessionAuth(AuthRegistrationRequired)
 
 			if c.conn.Profile.SystemProfile {
 				sprofile.Deactivate(c.conn.Profile.Id)
@@ -390,6 +445,7 @@ func (c *Client) connectPreAuth() (err error) {
 			})).Error("profile: Failed to authenticate")
 
 			c.conn.State.NoReconnect("client_auth_error")
+			c.conn.State.SetSessionAuth(AuthDenied)
 			c.conn.Data.SendProfileEvent("auth_error")
 
 			if c.conn.Profile.SystemProfile {
@@ -414,6 +470,8 @@ func (c *Client) connectPreAuth() (err error) {
 			"remote6": data.Remote6,
 		})).Info("connection: Authorization successful")
 
+		c.conn.State.SetSessionAuth(AuthAllowed)
+
 		c.conn.Data.RegistrationKey = ""
 		if c.conn.Profile.SystemProfile &&
 			c.conn.Profile.RegistrationKey != "" {
@@ -543,7 +601,7 @@ func (c *Client) authorize(host string, ssoToken string,
 		return
 	}
 
-	reqBx.Password = c.conn.Profile.Password
+	reqBx.Password = c.conn.credentialPassword()
 	reqBx.Token = tokn.Token
 	reqBx.Nonce = tokn.Nonce
 	reqBx.SsoToken = ssoToken
@@ -573,8 +631,9 @@ func (c *Client) authorize(host string, ssoToken string,
 	if res.StatusCode == 428 && ssoToken != "" {
 		if time.Since(ssoStart) > SingleSignOnTimeout {
 			evt = &event.Event{
-				Type: "timeout_error",
-				Data: c.conn.Data,
+				Type:      "timeout_error",
+				Data:      c.conn.Data,
+				ProfileId: c.conn.Id,
 			}
 
 			err = &errortypes.RequestError{
@@ -599,8 +658,9 @@ func (c *Client) authorize(host string, ssoToken string,
 
 	if res.StatusCode == 429 {
 		evt = &event.Event{
-			Type: "offline_error",
-			Data: c.conn.Data,
+			Type:      "offline_error",
+			Data:      c.conn.Data,
+			ProfileId: c.conn.Id,
 		}
 
 		err = &errortypes.RequestError{
@@ -641,6 +701,7 @@ func (c *Client) authorize(host string, ssoToken string,
 			evt2.Init()
 
 			c.conn.State.NoReconnect("client_auth_error")
+			c.conn.State.SetSessionAuth(AuthSsoRequired)
 			c.conn.Data.SendProfileEvent("sso_interactive")
 
 			if c.conn.Profile.SystemProfile {
@@ -657,7 +718,8 @@ func (c *Client) authorize(host string, ssoToken string,
 		}
 
 		evt2 := &event.Event{
-			Type: "sso_auth",
+			Type:      "sso_auth",
+			ProfileId: c.conn.Profile.Id,
 			Data: &SsoEventData{
 				Id:  c.conn.Profile.Id,
 				Url: respBx.SsoUrl,
@@ -669,7 +731,7 @@ func (c *Client) authorize(host string, ssoToken string,
 			c.conn.Data.SsoUrl = respBx.SsoUrl
 		}
 
-		c.conn.Data.Status = "authenticating"
+		c.conn.Data.SetStatus("authenticating")
 		c.conn.Data.UpdateEvent()
 
 		data, _, evt, err = c.authorize(
@@ -690,7 +752,7 @@ func (c *Client) authorize(host string, ssoToken string,
 		final = true
 		return
 	} else if ssoToken != "" {
-		c.conn.Data.Status = "connecting"
+		c.conn.Data.SetStatus("connecting")
 		c.conn.Data.UpdateEvent()
 	}
 
@@ -699,11 +761,12 @@ func (c *Client) authorize(host string, ssoToken string,
 		return
 	}
 
-	data = &ConnData{}
-	err = c.DecryptRespBox(ciph, respBx, data)
+	connData := &ConnData{}
+	err = c.DecryptRespBox(ciph, respBx, connData)
 	if err != nil {
 		return
 	}
+	data = connData
 
 	return
 }
@@ -719,12 +782,7 @@ func (c *Client) encryptReqBox(method string, reqPath string,
 		return
 	}
 
-	var tp tpm.TpmCaller
-	if runtime.GOOS == "darwin" && !config.Config.ForceLocalTpm {
-		tp = &tpm.Remote{}
-	} else {
-		tp = &tpm.Tpm{}
-	}
+	tp := tpm.GetCaller()
 
 	if c.conn.Profile.DeviceAuth && method == "POST" {
 		err = tp.Open(config.Config.EnclavePrivateKey)
@@ -835,6 +893,9 @@ func (c *Client) encryptReqBox(method string, reqPath string,
 			if err != nil {
 				return
 			}
+
+			token.Rekey()
+			sprofile.Rekey()
 		}
 	}
 
@@ -1006,7 +1067,7 @@ func (c *Client) EncRequest(ctx context.Context, method string,
 	req.Header.Set("Auth-Nonce", encReqData.Nonce)
 	req.Header.Set("Auth-Signature", encReqData.Signature)
 
-	resp, err = clientInsecure.Do(req)
+	resp, err = c.httpClient.Do(req)
 	if err != nil {
 		err = &errortypes.RequestError{
 			errors.Wrap(err, "profile: Request put error"),
@@ -1038,7 +1099,7 @@ func (c *Client) Disconnect() {
 	logrus.WithFields(c.conn.Fields(nil)).Error(
 		"connection: Disconnecting")
 
-	c.conn.Data.Status = "disconnecting"
+	c.conn.Data.SetStatus("disconnecting")
 	c.conn.Data.UpdateEvent()
 
 	c.CancelRequest()
@@ -1050,10 +1111,16 @@ func (c *Client) Disconnect() {
 		time.Sleep(1 * time.Second)
 	}
 
+	hooksConnected := c.hookDisconnect()
+
 	if c.prov != nil {
 		c.prov.Disconnect()
 	}
 
+	c.conn.clearSplitTunnel()
+	c.conn.clearDnsProxy()
+	c.conn.State.updateSession()
+
 	time.Sleep(1 * time.Second)
 
 	if runtime.GOOS == "darwin" && !config.Config.DisableWgDns {
@@ -1067,7 +1134,11 @@ func (c *Client) Disconnect() {
 
 	c.conn.State.RemovePaths()
 
-	c.conn.Data.Status = "disconnected"
+	if hooksConnected {
+		c.conn.runHookBackground(HookPostDisconnect)
+	}
+
+	c.conn.Data.SetStatus("disconnected")
 	c.conn.Data.Clear()
 	c.conn.Data.UpdateEvent()
 
@@ -1088,7 +1159,7 @@ func (c *Client) Disconnected() {
 	if c.conn.State.IsReconnect() {
 		logrus.WithFields(c.conn.Fields(nil)).Info(
 			"profile: Disconnected with restart")
-		go c.conn.Restart()
+		go c.conn.Reconnect(c.conn.State.ReconnectReason())
 	} else {
 		logrus.WithFields(c.conn.Fields(nil)).Info(
 			"profile: Disconnected without restart")
@@ -0,0 +1,325 @@
+package connection
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestAuthorizeAllow(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeServer(t)
+	conn := newTestConnection(t, srv, WgMode, Options{Interactive: true})
+	prov := newFakeProvider(conn)
+
+	err := conn.Client.Start(prov)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := prov.waitConnected(t)
+	if !data.Allow {
+		t.Fatal("connection: Expected allow")
+	}
+	if data.Configuration == nil ||
+		data.Configuration.Gateway != "127.0.0.1" ||
+		data.Configuration.WebPort != srv.Port() {
+
+		t.Fatalf("connection: Unexpected configuration %#v",
+			data.Configuration)
+	}
+
+	reqs := srv.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("connection: Expected 1 request, got %d", len(reqs))
+	}
+	if reqs[0].Handle != WgMode || reqs[0].Method != "POST" {
+		t.Fatalf("connection: Unexpected request %s %s",
+			reqs[0].Method, reqs[0].Path)
+	}
+	if reqs[0].Box.WgPublicKey != prov.publicKey {
+		t.Fatal("connection: Public key not sent")
+	}
+	if reqs[0].Box.Password != "password" {
+		t.Fatal("connection: Password not sent")
+	}
+	if reqs[0].Box.DeviceId != srv.UserId {
+		t.Fatal("connection: Device ID not sent")
+	}
+	if reqs[0].Box.Token == "" || reqs[0].Box.Nonce == "" {
+		t.Fatal("connection: Auth token not sent")
+	}
+
+	conn.Stop()
+	prov.waitDisconnected(t)
+}
+
+func TestAuthorizeDeny(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeServer(t)
+	srv.Allow = false
+	srv.Reason = "denied"
+
+	conn := newTestConnection(t, srv, WgMode, Options{Interactive: true})
+	prov := newFakeProvider(conn)
+
+	rec := newEventRecorder(conn.Id)
+	defer rec.Close()
+
+	err := conn.Client.Start(prov)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rec.has("auth_error") {
+		t.Fatal("connection: Missing auth_error event")
+	}
+	waitClosed(t, conn)
+	if len(prov.connected) != 0 {
+		t.Fatal("connection: Provider connected after deny")
+	}
+	conn.State.lock.Lock()
+	noReconnect := conn.State.noReconnect
+	conn.State.lock.Unlock()
+	if !noReconnect {
+		t.Fatal("connection: Reconnect not disabled after deny")
+	}
+}
+
+func TestAuthorizeRegistrationKey(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeServer(t)
+	srv.Allow = false
+	srv.Reason = "registration required"
+	srv.RegKey = "reg-key"
+
+	conn := newTestConnection(t, srv, WgMode, Options{Interactive: true})
+	prov := newFakeProvider(conn)
+
+	rec := newEventRecorder(conn.Id)
+	defer rec.Close()
+
+	err := conn.Client.Start(prov)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rec.has("registration_required") {
+		t.Fatal("connection: Missing registration_required event")
+	}
+	if conn.Data.RegistrationKey != "reg-key" {
+		t.Fatalf("connection: Unexpected registration key '%s'",
+			conn.Data.RegistrationKey)
+	}
+	if len(prov.connected) != 0 {
+		t.Fatal("connection: Provider connected without registration")
+	}
+}
+
+func TestAuthorizeSsoPolling(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeServer(t)
+	srv.SsoUrl = "https://sso.example.com/auth"
+	srv.SsoPolls = 3
+
+	conn := newTestConnection(t, srv, OvpnMode, Options{Interactive: true})
+	conn.Profile.SsoAuth = true
+	prov := newFakeProvider(conn)
+
+	rec := newEventRecorder(conn.Id)
+	defer rec.Close()
+
+	err := conn.Client.Start(prov)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := prov.waitConnected(t)
+	if !data.Allow {
+		t.Fatal("connection: Expected allow")
+	}
+	if data.Token == "" {
+		t.Fatal("connection: Missing ovpn token")
+	}
+
+	if !rec.has("sso_auth") {
+		t.Fatal("connection: Missing sso_auth event")
+	}
+	if srv.Polls() != 3 {
+		t.Fatalf("connection: Expected 3 polls, got %d", srv.Polls())
+	}
+
+	reqs := srv.Requests()
+	if len(reqs) != 5 {
+		t.Fatalf("connection: Expected 5 requests, got %d", len(reqs))
+	}
+	if reqs[0].Handle != "ovpn" || reqs[0].Box.SsoToken != "" {
+		t.Fatal("connection: Unexpected initial request")
+	}
+	for _, req := range reqs[1:] {
+		if req.Handle != "ovpn_wait" || req.Box.SsoToken == "" {
+			t.Fatal("connection: Unexpected poll request")
+		}
+	}
+
+	conn.Stop()
+	prov.waitDisconnected(t)
+}
+
+func TestAuthorizeSsoNonInteractive(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeServer(t)
+	srv.SsoUrl = "https://sso.example.com/auth"
+
+	conn := newTestConnection(t, srv, OvpnMode, Options{})
+	conn.Profile.SsoAuth = true
+	prov := newFakeProvider(conn)
+
+	rec := newEventRecorder(conn.Id)
+	defer rec.Close()
+
+	_ = conn.Client.Start(prov)
+
+	if !rec.has("sso_interactive") {
+		t.Fatal("connection: Missing sso_interactive event")
+	}
+	if len(prov.connected) != 0 {
+		t.Fatal("connection: Provider connected without single sign-on")
+	}
+	if srv.Polls() != 0 {
+		t.Fatal("connection: Unexpected single sign-on poll")
+	}
+}
+
+func TestAuthorizeSignatureMismatch(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeServer(t)
+	srv.BadSignature = true
+
+	conn := newTestConnection(t, srv, WgMode, Options{Interactive: true})
+	prov := newFakeProvider(conn)
+
+	err := conn.Client.Start(prov)
+	if err == nil {
+		t.Fatal("connection: Expected signature error")
+	}
+	if !strings.Contains(err.Error(), "Response signature invalid") {
+		t.Fatalf("connection: Unexpected error %s", err)
+	}
+	if len(prov.connected) != 0 {
+		t.Fatal("connection: Provider connected with invalid signature")
+	}
+}
+
+func TestAuthorizeRequestSignature(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeServer(t)
+
+	conn := newTestConnection(t, srv, WgMode, Options{Interactive: true})
+	conn.Profile.SyncSecret = "invalid"
+	prov := newFakeProvider(conn)
+
+	err := conn.Client.Start(prov)
+	if err == nil {
+		t.Fatal("connection: Expected request error")
+	}
+	if len(srv.Requests()) != 0 {
+		t.Fatal("connection: Server accepted invalid signature")
+	}
+	if len(prov.connected) != 0 {
+		t.Fatal("connection: Provider connected with invalid signature")
+	}
+}
+
+func TestDecryptRespBox(t *testing.T) {
+	serverPubKey, serverPrivKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	senderPubKey, senderPrivKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := "sync-secret"
+	client := &Client{
+		conn: &Connection{
+			Profile: &Profile{
+				SyncSecret: secret,
+			},
+		},
+	}
+	ciph := &Cipher{
+		serverPubKey:  serverPubKey,
+		senderPubKey:  senderPubKey,
+		senderPrivKey: senderPrivKey,
+	}
+
+	seal := func(data interface{}, key *[32]byte) (respBx *RespBox) {
+		plaintext, _ := json.Marshal(data)
+
+		var nonce [24]byte
+		_, _ = rand.Read(nonce[:])
+
+		respBx = &RespBox{
+			Data: base64.StdEncoding.EncodeToString(
+				box.Seal([]byte{}, plaintext, &nonce, senderPubKey, key)),
+			Nonce: base64.StdEncoding.EncodeToString(nonce[:]),
+		}
+
+		hashFunc := hmac.New(sha512.New, []byte(secret))
+		hashFunc.Write([]byte(respBx.Data + "&" + respBx.Nonce))
+		respBx.Signature = base64.StdEncoding.EncodeToString(
+			hashFunc.Sum(nil))
+
+		return
+	}
+
+	data := &PingData{}
+	err = client.DecryptRespBox(ciph, seal(&PingData{
+		Status:    true,
+		Timestamp: 10,
+	}, serverPrivKey), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !data.Status || data.Timestamp != 10 {
+		t.Fatalf("connection: Unexpected data %#v", data)
+	}
+
+	respBx := seal(&PingData{}, serverPrivKey)
+	respBx.Nonce = base64.StdEncoding.EncodeToString(make([]byte, 24))
+	err = client.DecryptRespBox(ciph, respBx, &PingData{})
+	if err == nil ||
+		!strings.Contains(err.Error(), "Response signature invalid") {
+
+		t.Fatalf("connection: Expected signature error, got %v", err)
+	}
+
+	_, otherPrivKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.DecryptRespBox(ciph, seal(&PingData{}, otherPrivKey),
+		&PingData{})
+	if err == nil ||
+		!strings.Contains(err.Error(), "Failed to decrypt response") {
+
+		t.Fatalf("connection: Expected decrypt error, got %v", err)
+	}
+}
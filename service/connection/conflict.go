@@ -0,0 +1,394 @@
+package connection
+
+import (
+	"fmt"
+	"net"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/dnsproxy"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ConflictRoute        = "route"
+	ConflictDns          = "dns"
+	ConflictSearchDomain = "search_domain"
+
+	ConflictLog          = ""
+	ConflictReject       = "reject"
+	ConflictPreferNewer  = "prefer_newer"
+	ConflictPreferMetric = "prefer_metric"
+)
+
+var ConflictPolicies = []string{
+	ConflictLog,
+	ConflictReject,
+	ConflictPreferNewer,
+	ConflictPreferMetric,
+}
+
+type Conflict struct {
+	Type           string `json:"type"`
+	Id             string `json:"id"`
+	Value          string `json:"value"`
+	Metric         int    `json:"metric"`
+	ConflictId     string `json:"conflict_id"`
+	ConflictValue  string `json:"conflict_value"`
+	ConflictMetric int    `json:"conflict_metric"`
+}
+
+type ConflictsData struct {
+	Policy    string      `json:"policy"`
+	Conflicts []*Conflict `json:"conflicts"`
+}
+
+type netConf struct {
+	Id            string
+	Routes        []*Route
+	DnsServers    []string
+	SearchDomains []string
+	SplitDns      bool
+}
+
+func (n *netConf) metric() (metric int) {
+	for _, route := range n.Routes {
+		if route.Metric > metric {
+			metric = route.Metric
+		}
+	}
+	return
+}
+
+func (c *Connection) netConf(routes, routes6 []*Route,
+	dnsServers, searchDomains []string) (conf *netConf) {
+
+	conf = &netConf{
+		Id:     c.Id,
+		Routes: []*Route{},
+	}
+
+	for _, route := range routes {
+		if !route.NetGateway {
+			conf.Routes = append(conf.Routes, route)
+		}
+	}
+	for _, route := range routes6 {
+		if !route.NetGateway {
+			conf.Routes = append(conf.Routes, route)
+		}
+	}
+
+	if !c.Profile.DisableDns {
+		conf.DnsServers = dnsServers
+		conf.SearchDomains = searchDomains
+		conf.SplitDns = dnsproxy.IsRunning() && !c.Profile.ForceDns &&
+			len(searchDomains) > 0
+	}
+
+	return
+}
+
+func routesOverlap(x, y string) bool {
+	_, xNet, err := net.ParseCIDR(x)
+	if err != nil {
+		return false
+	}
+
+	_, yNet, err := net.ParseCIDR(y)
+	if err != nil {
+		return false
+	}
+
+	return xNet.Contains(yNet.IP) || yNet.Contains(xNet.IP)
+}
+
+func sameItems(x, y []string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+
+	xSorted := append([]string{}, x...)
+	ySorted := append([]string{}, y...)
+	sort.Strings(xSorted)
+	sort.Strings(ySorted)
+
+	for i := range xSorted {
+		if xSorted[i] != ySorted[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func analyzeConflicts(conf, other *netConf) (conflicts []*Conflict) {
+	conflicts = []*Conflict{}
+
+	for _, route := range conf.Routes {
+		for _, otherRoute := range other.Routes {
+			if !routesOverlap(route.Network, otherRoute.Network) {
+				continue
+			}
+
+			conflicts = append(conflicts, &Conflict{
+				Type:           ConflictRoute,
+				Id:             conf.Id,
+				Value:          route.Network,
+				Metric:         route.Metric,
+				ConflictId:     other.Id,
+				ConflictValue:  otherRoute.Network,
+				ConflictMetric: otherRoute.Metric,
+			})
+		}
+	}
+
+	// split dns routed servers only receive queries for the search
+	// domains, the servers only conflict when both claim the default
+	// resolver
+	if len(conf.DnsServers) > 0 && len(other.DnsServers) > 0 &&
+		!conf.SplitDns && !other.SplitDns &&
+		!sameItems(conf.DnsServers, other.DnsServers) {
+
+		conflicts = append(conflicts, &Conflict{
+			Type:           ConflictDns,
+			Id:             conf.Id,
+			Value:          strings.Join(conf.DnsServers, ","),
+			Metric:         conf.metric(),
+			ConflictId:     other.Id,
+			ConflictValue:  strings.Join(other.DnsServers, ","),
+			ConflictMetric: other.metric(),
+		})
+	}
+
+	for _, domain := range conf.SearchDomains {
+		for _, otherDomain := range other.SearchDomains {
+			if !strings.EqualFold(domain, otherDomain) {
+				continue
+			}
+
+			conflicts = append(conflicts, &Conflict{
+				Type:           ConflictSearchDomain,
+				Id:             conf.Id,
+				Value:          domain,
+				Metric:         conf.metric(),
+				ConflictId:     other.Id,
+				ConflictValue:  otherDomain,
+				ConflictMetric: other.metric(),
+			})
+		}
+	}
+
+	return
+}
+
+func GetConflicts() (data *ConflictsData) {
+	data = &ConflictsData{
+		Policy:    config.Config.ConflictPolicy,
+		Conflicts: []*Conflict{},
+	}
+
+	conns := []*Connection{}
+	for _, conn := range GlobalStore.GetAll() {
+		conns = append(conns, conn)
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].Id < conns[j].Id
+	})
+
+	for i, conn := range conns {
+		conf := conn.netConf(conn.Data.GetNetwork())
+
+		for _, other := range conns[i+1:] {
+			otherConf := other.netConf(other.Data.GetNetwork())
+
+			data.Conflicts = append(data.Conflicts,
+				analyzeConflicts(conf, otherConf)...)
+		}
+	}
+
+	return
+}
+
+func (c *Connection) stopConflict() {
+	defer func() {
+		panc := recover()
+		if panc != nil {
+			logrus.WithFields(c.Fields(logrus.Fields{
+				"trace": string(debug.Stack()),
+				"panic": panc,
+			})).Error("connection: Conflict stop panic")
+		}
+	}()
+
+	c.State.NoReconnect("conflict")
+	c.Data.SendProfileEvent("conflict_error")
+	c.StopWait()
+}
+
+// resolveConflicts compares the network configuration against the other
+// active connections and applies the conflict policy, returns false if
+// this connection should not continue
+func (c *Connection) resolveConflicts(routes, routes6 []*Route,
+	dnsServers, searchDomains []string) bool {
+
+	conf := c.netConf(routes, routes6, dnsServers, searchDomains)
+
+	conflicts := []*Conflict{}
+	conflictConns := map[string]*Connection{}
+
+	for _, conn := range GlobalStore.GetAll() {
+		if conn == c || conn.Id == c.Id || conn.State.IsStop() {
+			continue
+		}
+
+		otherConf := conn.netConf(conn.Data.GetNetwork())
+
+		connConflicts := analyzeConflicts(conf, otherConf)
+		if len(connConflicts) > 0 {
+			conflicts = append(conflicts, connConflicts...)
+			conflictConns[conn.Id] = conn
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return true
+	}
+
+	policy := config.Config.ConflictPolicy
+
+	for _, conflict := range conflicts {
+		logrus.WithFields(c.Fields(logrus.Fields{
+			"conflict_type":   conflict.Type,
+			"conflict_policy": policy,
+			"value":           conflict.Value,
+			"metric":          conflict.Metric,
+			"conflict_id":     conflict.ConflictId,
+			"conflict_value":  conflict.ConflictValue,
+			"conflict_metric": conflict.ConflictMetric,
+		})).Warn("connection: Network conflict with active connection")
+	}
+
+	replace := false
+	switch policy {
+	case ConflictReject:
+		replace = false
+		break
+	case ConflictPreferNewer:
+		replace = true
+		break
+	case ConflictPreferMetric:
+		replace = true
+		for _, conflict := range conflicts {
+			if conflict.Metric <= conflict.ConflictMetric {
+				replace = false
+				break
+			}
+		}
+		break
+	default:
+		return true
+	}
+
+	if !replace {
+		logrus.WithFields(c.Fields(logrus.Fields{
+			"conflict_policy": policy,
+		})).Error("connection: Rejecting connection due to network conflict")
+
+		c.State.NoReconnect("conflict")
+		c.Data.SendProfileEvent("conflict_error")
+		return false
+	}
+
+	for _, conn := range conflictConns {
+		logrus.WithFields(conn.Fields(logrus.Fields{
+			"conflict_policy": policy,
+			"conflict_id":     c.Id,
+		})).Warn("connection: Stopping connection due to network conflict")
+
+		conn.stopConflict()
+	}
+
+	return true
+}
+
+func parseRouteMetric(fields []string, index int) (metric int) {
+	if len(fields) > index {
+		metric, _ = strconv.Atoi(fields[index])
+	}
+	return
+}
+
+func parsePushRoutes(line string) (routes, routes6 []*Route) {
+	routes = []*Route{}
+	routes6 = []*Route{}
+
+	for _, opt := range strings.Split(line, ",") {
+		fields := strings.Fields(strings.Trim(opt, "' "))
+		if len(fields) < 1 {
+			continue
+		}
+
+		switch fields[0] {
+		case "redirect-gateway", "redirect-private":
+			if fields[0] == "redirect-gateway" {
+				routes = append(routes, &Route{
+					Network: "0.0.0.0/0",
+				})
+			}
+			for _, flag := range fields[1:] {
+				if flag == "ipv6" {
+					routes6 = append(routes6, &Route{
+						Network: "::/0",
+					})
+				}
+			}
+			break
+		case "route":
+			if len(fields) < 2 {
+				break
+			}
+
+			mask := net.IPv4Mask(255, 255, 255, 255)
+			if len(fields) > 2 {
+				maskIp := net.ParseIP(fields[2]).To4()
+				if maskIp == nil {
+					break
+				}
+				mask = net.IPMask(maskIp)
+			}
+
+			ip := net.ParseIP(fields[1]).To4()
+			if ip == nil {
+				break
+			}
+
+			ones, _ := mask.Size()
+			routes = append(routes, &Route{
+				Network: fmt.Sprintf("%s/%d", ip.Mask(mask), ones),
+				Metric:  parseRouteMetric(fields, 4),
+			})
+			break
+		case "route-ipv6":
+			if len(fields) < 2 {
+				break
+			}
+
+			_, network, err := net.ParseCIDR(fields[1])
+			if err != nil {
+				break
+			}
+
+			routes6 = append(routes6, &Route{
+				Network: network.String(),
+				Metric:  parseRouteMetric(fields, 3),
+			})
+			break
+		}
+	}
+
+	return
+}
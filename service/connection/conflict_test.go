@@ -0,0 +1,93 @@
+package connection
+
+import (
+	"testing"
+)
+
+func TestParsePushRoutes(t *testing.T) {
+	routes, routes6 := parsePushRoutes("PUSH: Received control message: " +
+		"'PUSH_REPLY,redirect-gateway def1 ipv6,route 10.8.0.0 " +
+		"255.255.255.0 10.8.0.1 200,route 192.168.1.10,route-ipv6 " +
+		"fd00:8::/64,dhcp-option DNS 10.8.0.1,ifconfig 10.8.0.6 " +
+		"255.255.255.0'")
+
+	expected := []string{"0.0.0.0/0", "10.8.0.0/24", "192.168.1.10/32"}
+	if len(routes) != len(expected) {
+		t.Fatalf("connection: Unexpected routes count %d", len(routes))
+	}
+	for i, route := range routes {
+		if route.Network != expected[i] {
+			t.Errorf("connection: Unexpected route %s", route.Network)
+		}
+	}
+	if routes[1].Metric != 200 {
+		t.Errorf("connection: Unexpected route metric %d", routes[1].Metric)
+	}
+
+	if len(routes6) != 2 || routes6[0].Network != "::/0" ||
+		routes6[1].Network != "fd00:8::/64" {
+
+		t.Fatal("connection: Unexpected ipv6 routes")
+	}
+}
+
+func TestAnalyzeConflicts(t *testing.T) {
+	conf := &netConf{
+		Id: "a",
+		Routes: []*Route{
+			{Network: "0.0.0.0/0", Metric: 10},
+			{Network: "10.1.0.0/16", Metric: 10},
+		},
+		DnsServers:    []string{"10.1.0.1"},
+		SearchDomains: []string{"corp.example.com"},
+	}
+	other := &netConf{
+		Id: "b",
+		Routes: []*Route{
+			{Network: "10.1.2.0/24", Metric: 20},
+		},
+		DnsServers:    []string{"10.2.0.1"},
+		SearchDomains: []string{"CORP.example.com", "lab.example.com"},
+	}
+
+	conflicts := analyzeConflicts(conf, other)
+
+	counts := map[string]int{}
+	for _, conflict := range conflicts {
+		counts[conflict.Type] += 1
+		if conflict.Id != "a" || conflict.ConflictId != "b" {
+			t.Fatal("connection: Unexpected conflict ids")
+		}
+	}
+
+	if counts[ConflictRoute] != 2 || counts[ConflictDns] != 1 ||
+		counts[ConflictSearchDomain] != 1 {
+
+		t.Fatalf("connection: Unexpected conflicts %v", counts)
+	}
+
+	conf.SplitDns = true
+	for _, conflict := range analyzeConflicts(conf, other) {
+		if conflict.Type == ConflictDns {
+			t.Fatal("connection: Unexpected dns conflict with split dns")
+		}
+	}
+	conf.SplitDns = false
+
+	other.Routes = []*Route{
+		{Network: "10.2.0.0/16"},
+	}
+	other.DnsServers = []string{"10.1.0.1"}
+	other.SearchDomains = nil
+
+	conflicts = analyzeConflicts(&netConf{
+		Id: "a",
+		Routes: []*Route{
+			{Network: "10.1.0.0/16"},
+		},
+		DnsServers: []string{"10.1.0.1"},
+	}, other)
+	if len(conflicts) != 0 {
+		t.Fatalf("connection: Unexpected conflicts %d", len(conflicts))
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/pritunl/pritunl-client-electron/service/config"
 	"github.com/pritunl/pritunl-client-electron/service/event"
+	"github.com/pritunl/pritunl-client-electron/service/metrics"
 	"github.com/pritunl/pritunl-client-electron/service/sprofile"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
 	"github.com/sirupsen/logrus"
@@ -108,6 +109,7 @@ func (c *Connection) Start(opts Options) (err error) {
 	}
 
 	GlobalStore.Add(c.Id, c)
+	metrics.ConnectAttempt.Inc(c.Profile.Mode)
 
 	if c.State.IsStop() {
 		c.State.Close()
@@ -121,7 +123,7 @@ func (c *Connection) Start(opts Options) (err error) {
 		return
 	}
 
-	if c.Profile.Mode == WgMode {
+	if c.Profile.IsWg() {
 		err = c.Wg.Start()
 	} else {
 		err = c.Ovpn.Start()
@@ -139,7 +141,7 @@ func (c *Connection) Start(opts Options) (err error) {
 
 func (c *Connection) Restart() {
 	c.State.NoReconnect("restart")
-	c.StopWait()
+	c.stopWait("restart", true)
 
 	newConn, err := NewConnection(c.Profile)
 	if err != nil {
@@ -161,12 +163,23 @@ func (c *Connection) Restart() {
 func (c *Connection) Stop() {
 	c.State.NoReconnect("stop")
 	c.Client.Disconnect()
+	c.clearLockdown()
 }
 
 func (c *Connection) StopWait() {
-	c.State.NoReconnect("stop_wait")
+	c.stopWait("stop_wait", false)
+}
+
+// stopWait disconnects and waits for the connection to close, lockdown
+// rules are only kept when the connection is immediately restarted
+func (c *Connection) stopWait(reason string, keepLockdown bool) {
+	c.State.NoReconnect(reason)
 	c.Client.Disconnect()
 	c.State.CloseWait()
+
+	if !keepLockdown {
+		c.clearLockdown()
+	}
 }
 
 func (c *Connection) StopBackground() {
@@ -184,6 +197,7 @@ func (c *Connection) StopBackground() {
 		c.State.NoReconnect("stop_background")
 		c.Client.Disconnect()
 		c.State.CloseWait()
+		c.clearLockdown()
 	}()
 }
 
@@ -14,7 +14,9 @@ const (
 	SingleSignOnTimeout = 90 * time.Second
 	OvpnMode            = "ovpn"
 	WgMode              = "wg"
+	WgUserspaceMode     = "wg-userspace"
 	NmOvpnUser          = "nm-openvpn"
+	LatencySort         = "latency"
 )
 
 var (
@@ -0,0 +1,46 @@
+package connection
+
+import (
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/credential"
+	"github.com/pritunl/pritunl-client-electron/service/sprofile"
+	"github.com/sirupsen/logrus"
+)
+
+func (c *Connection) credentialHelper(sprfl *sprofile.Sprofile) string {
+	if sprfl.CredentialHelper != "" {
+		return sprfl.CredentialHelper
+	}
+	return config.Config.CredentialHelper
+}
+
+// credentialPassword returns the password from the credential helper for
+// system profiles that require input and were started without a password
+func (c *Connection) credentialPassword() (password string) {
+	password = c.Profile.Password
+	if password != "" || !c.Profile.SystemProfile {
+		return
+	}
+
+	sprfl := sprofile.Get(c.Profile.Id)
+	if sprfl == nil || sprfl.PasswordMode == "" {
+		return
+	}
+
+	helper := c.credentialHelper(sprfl)
+	if helper == "" {
+		return
+	}
+
+	pass, err := credential.Get(helper, sprfl.CredentialRequest())
+	if err != nil {
+		logrus.WithFields(c.Fields(logrus.Fields{
+			"error": err,
+		})).Error("connection: Credential helper failed")
+		return
+	}
+
+	password = pass
+
+	return
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/pritunl/pritunl-client-electron/service/errortypes"
 	"github.com/pritunl/pritunl-client-electron/service/event"
 	"github.com/pritunl/pritunl-client-electron/service/geosort"
+	"github.com/pritunl/pritunl-client-electron/service/metrics"
 	"github.com/pritunl/pritunl-client-electron/service/token"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
 	"github.com/sirupsen/logrus"
@@ -36,11 +37,21 @@ var (
 		"connection_error":  30 * time.Second,
 		"timeout_error":     30 * time.Second,
 		"handshake_timeout": 10 * time.Second,
+		"cert_mismatch":     30 * time.Second,
 	}
+	failureEvents = set.NewSet(
+		"auth_error",
+		"handshake_timeout",
+		"connection_error",
+		"registration_required",
+		"conflict_error",
+	)
 )
 
 type Data struct {
 	conn             *Connection `json:"-"`
+	statusLock       sync.Mutex  `json:"-"`
+	networkLock      sync.Mutex  `json:"-"`
 	Id               string      `json:"id"`
 	Mode             string      `json:"mode"`
 	Iface            string      `json:"iface"`
@@ -60,6 +71,8 @@ type Data struct {
 	PingTimeoutWg    int         `json:"ping_timeout_wg"`
 	WebPort          int         `json:"web_port"`
 	WebNoSsl         bool        `json:"web_no_ssl"`
+	RxBytes          int64       `json:"rx_bytes"`
+	TxBytes          int64       `json:"tx_bytes"`
 	RegistrationKey  string      `json:"registration_key"`
 	SsoUrl           string      `json:"sso_url"`
 	DeviceId         string      `json:"-"`
@@ -92,16 +105,57 @@ func (d *Data) Fields() logrus.Fields {
 		"data_mode":      d.Mode,
 		"data_iface":     d.Iface,
 		"data_tun_iface": d.WgTunIface,
-		"data_status":    d.Status,
+		"data_status":    d.GetStatus(),
 		"data_timestamp": d.Timestamp,
 		"data_remotes":   remotes,
 	}
 }
 
+func (d *Data) SetStatus(status string) {
+	d.statusLock.Lock()
+	d.Status = status
+	d.statusLock.Unlock()
+}
+
+func (d *Data) GetStatus() string {
+	d.statusLock.Lock()
+	defer d.statusLock.Unlock()
+	return d.Status
+}
+
+// SetNetwork sets the routes and dns configuration, the slices are
+// replaced and not modified after being set
+func (d *Data) SetNetwork(routes, routes6 []*Route,
+	dnsServers, searchDomains []string) {
+
+	d.networkLock.Lock()
+	d.Routes = routes
+	d.Routes6 = routes6
+	d.DnsServers = dnsServers
+	d.SearchDomains = searchDomains
+	d.networkLock.Unlock()
+}
+
+// GetNetwork returns a snapshot of the routes and dns configuration for
+// access from other connections
+func (d *Data) GetNetwork() (routes, routes6 []*Route,
+	dnsServers, searchDomains []string) {
+
+	d.networkLock.Lock()
+	routes = d.Routes
+	routes6 = d.Routes6
+	dnsServers = d.DnsServers
+	searchDomains = d.SearchDomains
+	d.networkLock.Unlock()
+
+	return
+}
+
 func (d *Data) UpdateEvent() {
 	evt := event.Event{
-		Type: "update",
-		Data: d,
+		Type:      "update",
+		Data:      d,
+		ProfileId: d.Id,
 	}
 	evt.Init()
 
@@ -124,6 +178,8 @@ func (d *Data) Clear() {
 	d.ServerAddr = ""
 	d.GatewayAddr = ""
 	d.GatewayAddr6 = ""
+	d.RxBytes = 0
+	d.TxBytes = 0
 }
 
 func (d *Data) GetMacAddrs() (addrs []string, err error) {
@@ -321,9 +377,7 @@ func (d *Data) ParseProfile() (err error) {
 
 		sortMethod = "geo"
 
-		for _, remote := range remotes {
-			remote.Lookup()
-		}
+		remotes.Lookup()
 
 		remoteHosts := geosort.SortRemotes(
 			d.PublicAddr, d.PublicAddr6, remotes.GetAddrs(),
@@ -348,6 +402,22 @@ func (d *Data) ParseProfile() (err error) {
 		}
 
 		remotes = newRemotes
+	} else if d.conn.Profile.IsLatencySort() {
+		sortMethod = "latency"
+		newSyncRemotes := Remotes{}
+		newRemotes := Remotes{}
+
+		for _, i := range mathrand.Perm(len(syncRemotes)) {
+			newSyncRemotes = append(newSyncRemotes, syncRemotes[i])
+		}
+
+		for _, i := range mathrand.Perm(len(remotes)) {
+			newRemotes = append(newRemotes, remotes[i])
+		}
+
+		wg := d.conn.Profile.IsWg()
+		remotes = append(newSyncRemotes.SortLatency(wg),
+			newRemotes.SortLatency(wg)...)
 	} else {
 		sortMethod = "random"
 		newRemotes := Remotes{}
@@ -391,7 +461,7 @@ func (t *AuthToken) Reset() {
 
 func (t *AuthToken) Validate() {
 	if t.tokn != nil {
-		t.tokn.Valid = true
+		t.tokn.Validate()
 	}
 }
 
@@ -483,6 +553,12 @@ func (d *Data) GetAuthToken() (authToken *AuthToken, err error) {
 }
 
 func (d *Data) SendProfileEvent(evtType string) {
+	d.conn.State.addSessionEvent(evtType)
+
+	if failureEvents.Contains(evtType) {
+		metrics.ConnectFailure.Inc(evtType)
+	}
+
 	eventLock.Lock()
 	limit := eventLimits[evtType]
 	if limit != 0 {
@@ -495,8 +571,9 @@ func (d *Data) SendProfileEvent(evtType string) {
 	eventLock.Unlock()
 
 	evt := &event.Event{
-		Type: evtType,
-		Data: d,
+		Type:      evtType,
+		Data:      d,
+		ProfileId: d.Id,
 	}
 	evt.Init()
 }
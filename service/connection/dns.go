@@ -0,0 +1,54 @@
+package connection
+
+import (
+	"strings"
+
+	"github.com/pritunl/pritunl-client-electron/service/dnsproxy"
+	"github.com/sirupsen/logrus"
+)
+
+func parsePushDns(line string) (servers, domains []string) {
+	servers = []string{}
+	domains = []string{}
+
+	for _, opt := range strings.Split(line, ",") {
+		fields := strings.Fields(strings.Trim(opt, "' "))
+		if len(fields) < 3 || fields[0] != "dhcp-option" {
+			continue
+		}
+
+		switch fields[1] {
+		case "DNS", "DNS6":
+			servers = append(servers, fields[2])
+			break
+		case "DOMAIN", "DOMAIN-SEARCH":
+			domains = append(domains, fields[2])
+			break
+		}
+	}
+
+	return
+}
+
+func (c *Connection) updateDnsProxy() {
+	if c.Profile.DisableDns || !dnsproxy.IsRunning() {
+		return
+	}
+
+	err := dnsproxy.Set(c.Id, c.Data.DnsServers, c.Data.SearchDomains,
+		c.Profile.ForceDns)
+	if err != nil {
+		logrus.WithFields(c.Fields(logrus.Fields{
+			"error": err,
+		})).Error("connection: Failed to update DNS proxy")
+	}
+}
+
+func (c *Connection) clearDnsProxy() {
+	err := dnsproxy.Remove(c.Id)
+	if err != nil {
+		logrus.WithFields(c.Fields(logrus.Fields{
+			"error": err,
+		})).Error("connection: Failed to remove DNS proxy route")
+	}
+}
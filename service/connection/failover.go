@@ -0,0 +1,302 @@
+package connection
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/event"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/pritunl/pritunl-client-electron/service/wireguard"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	wgHandshakeStaleDefault = 300
+	failoverTimeout         = 15 * time.Second
+)
+
+type FailoverEventData struct {
+	Id        string `json:"id"`
+	OldRemote string `json:"old_remote"`
+	NewRemote string `json:"new_remote"`
+}
+
+// handshakeStaleTimeout returns the seconds since the last handshake
+// after which the peer is considered unreachable, WireGuard handshakes
+// every two minutes while the keepalive ping keeps traffic flowing
+func handshakeStaleTimeout() int64 {
+	if config.Config.WgHandshakeStale > 0 {
+		return int64(config.Config.WgHandshakeStale)
+	}
+	return wgHandshakeStaleDefault
+}
+
+func (w *Wg) handshakeStale() bool {
+	lastHandshake := w.getLastHandshake()
+	if lastHandshake == 0 {
+		return false
+	}
+
+	return time.Now().Unix()-int64(lastHandshake) > handshakeStaleTimeout()
+}
+
+func (w *Wg) failoverRemotes() (remotes Remotes) {
+	remotes = Remotes{}
+	current := w.conn.Client.remote
+
+	index := -1
+	for i, remote := range w.conn.Data.Remotes {
+		if remote.Host == current {
+			index = i
+			break
+		}
+	}
+
+	count := len(w.conn.Data.Remotes)
+	for i := 1; i <= count; i++ {
+		remote := w.conn.Data.Remotes[(index+i+count)%count]
+		if remote.Host == current {
+			continue
+		}
+		remotes = append(remotes, remote)
+	}
+
+	return
+}
+
+func (w *Wg) allowedIps() (allowedIps []string) {
+	allowedIps = []string{}
+
+	for _, route := range w.conn.Data.Routes {
+		if route.NetGateway {
+			continue
+		}
+		allowedIps = append(allowedIps, route.Network)
+	}
+	for _, route := range w.conn.Data.Routes6 {
+		if route.NetGateway {
+			continue
+		}
+		allowedIps = append(allowedIps, route.Network)
+	}
+
+	return
+}
+
+func (w *Wg) setPeer(data *WgConf) (err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	endpoint := fmt.Sprintf("%s:%d", data.Hostname, data.Port)
+	allowedIps := w.allowedIps()
+
+	if runtime.GOOS == "linux" {
+		routes := []*wireguard.Route{}
+		for _, allowedIp := range allowedIps {
+			routes = append(routes, &wireguard.Route{
+				Network: allowedIp,
+			})
+		}
+
+		err = wgSetPeer(&wireguard.Config{
+			Iface:     w.conn.Data.Iface,
+			PublicKey: data.PublicKey,
+			Endpoint:  endpoint,
+			Routes:    routes,
+		})
+		if err != nil {
+			return
+		}
+	} else {
+		iface := w.conn.Data.Iface
+		if runtime.GOOS == "darwin" {
+			iface = w.conn.Data.WgTunIface
+		}
+
+		_, err = utils.ExecCombinedOutputLogged(
+			nil,
+			w.wgPath, "set", iface,
+			"peer", data.PublicKey,
+			"endpoint", endpoint,
+			"allowed-ips", strings.Join(allowedIps, ","),
+		)
+		if err != nil {
+			return
+		}
+
+		if w.serverPubKey != "" && w.serverPubKey != data.PublicKey {
+			_, err = utils.ExecCombinedOutputLogged(
+				nil,
+				w.wgPath, "set", iface,
+				"peer", w.serverPubKey, "remove",
+			)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	w.serverPubKey = data.PublicKey
+	w.serverConf = data
+	w.setLastHandshake(0)
+	w.conn.Data.ServerAddr = data.Hostname
+	w.conn.Data.GatewayAddr = data.Gateway
+	w.conn.Data.GatewayAddr6 = data.Gateway6
+	w.conn.Data.WebPort = data.WebPort
+	w.conn.Data.WebNoSsl = data.WebNoSsl
+
+	return
+}
+
+// restorePeer restores the peer that was active before a failed
+// failover attempt
+func (w *Wg) restorePeer(data *WgConf) {
+	if data == nil {
+		return
+	}
+
+	err := w.setPeer(data)
+	if err != nil {
+		logrus.WithFields(w.conn.Fields(logrus.Fields{
+			"error": err,
+		})).Error("connection: Failed to restore peer after failover")
+	}
+}
+
+func (w *Wg) waitFailover() bool {
+	start := time.Now()
+
+	for time.Since(start) < failoverTimeout {
+		if w.conn.State.IsStop() {
+			return false
+		}
+
+		err := w.updateHandshake()
+		if err == nil && w.getLastHandshake() != 0 {
+			break
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	if w.getLastHandshake() == 0 {
+		return false
+	}
+
+	data, _, err := w.ping()
+	if err != nil || data == nil || !data.Status {
+		return false
+	}
+
+	return true
+}
+
+func (w *Wg) failover() (ok bool) {
+	remotes := w.failoverRemotes()
+	if len(remotes) == 0 {
+		return
+	}
+
+	if w.conn.Profile.SsoAuth {
+		tokn, err := w.conn.Data.GetAuthToken()
+		if err != nil || !tokn.Validated {
+			logrus.WithFields(w.conn.Fields(nil)).Info(
+				"connection: Skipping failover for single sign-on profile")
+			return
+		}
+	}
+
+	oldRemote := w.conn.Client.remote
+	oldConf := w.serverConf
+	clientAddr := w.conn.Data.ClientAddr
+
+	for _, remote := range remotes {
+		if w.conn.State.IsStop() {
+			return
+		}
+
+		logrus.WithFields(w.conn.Fields(logrus.Fields{
+			"old_remote": oldRemote,
+			"new_remote": remote.GetFormatted(),
+		})).Info("connection: Attempting remote failover")
+
+		data, final, _, err := w.conn.Client.authorize(
+			remote.Host, "", time.Time{})
+		if err != nil {
+			logrus.WithFields(w.conn.Fields(logrus.Fields{
+				"remote": remote.GetFormatted(),
+				"error":  err,
+			})).Warn("connection: Failover authorize failed")
+
+			if final {
+				return
+			}
+			continue
+		}
+
+		if !data.Allow {
+			logrus.WithFields(w.conn.Fields(logrus.Fields{
+				"remote": remote.GetFormatted(),
+				"reason": data.Reason,
+			})).Error("connection: Failover authorization denied")
+			return
+		}
+
+		if data.Configuration == nil ||
+			data.Configuration.Address != clientAddr {
+
+			logrus.WithFields(w.conn.Fields(logrus.Fields{
+				"remote": remote.GetFormatted(),
+			})).Warn("connection: Failover remote configuration mismatch")
+			continue
+		}
+
+		err = w.setPeer(data.Configuration)
+		if err != nil {
+			logrus.WithFields(w.conn.Fields(logrus.Fields{
+				"remote": remote.GetFormatted(),
+				"error":  err,
+			})).Error("connection: Failed to update failover peer")
+			w.restorePeer(oldConf)
+			continue
+		}
+
+		if !w.waitFailover() {
+			logrus.WithFields(w.conn.Fields(logrus.Fields{
+				"remote": remote.GetFormatted(),
+			})).Warn("connection: Failover remote handshake failed")
+			w.restorePeer(oldConf)
+			continue
+		}
+
+		w.conn.Client.remote = remote.Host
+		w.conn.State.SetSessionRemote(remote.Host)
+		w.conn.State.addSessionEvent("remote_failover")
+		w.conn.Data.UpdateEvent()
+		w.conn.updateNetworkPath()
+
+		evt := &event.Event{
+			Type:      "remote_failover",
+			ProfileId: w.conn.Id,
+			Data: &FailoverEventData{
+				Id:        w.conn.Id,
+				OldRemote: oldRemote,
+				NewRemote: remote.Host,
+			},
+		}
+		evt.Init()
+
+		logrus.WithFields(w.conn.Fields(logrus.Fields{
+			"old_remote": oldRemote,
+			"new_remote": remote.GetFormatted(),
+		})).Info("connection: Remote failover complete")
+
+		ok = true
+		return
+	}
+
+	return
+}
@@ -0,0 +1,231 @@
+package connection
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pritunl/pritunl-client-electron/service/event"
+	"github.com/pritunl/pritunl-client-electron/service/fakeserver"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+)
+
+const (
+	testTimeout = 30 * time.Second
+)
+
+type fakeProvider struct {
+	conn         *Connection
+	publicKey    string
+	prefix       string
+	watch        func() error
+	connected    chan *ConnData
+	disconnected chan bool
+}
+
+func (p *fakeProvider) GetPublicKey() string {
+	return p.publicKey
+}
+
+func (p *fakeProvider) GetReqPrefix() string {
+	return p.prefix
+}
+
+func (p *fakeProvider) PreConnect() (err error) {
+	return
+}
+
+func (p *fakeProvider) Connect(data *ConnData) (err error) {
+	if data.Configuration != nil {
+		p.conn.Data.GatewayAddr = data.Configuration.Gateway
+		p.conn.Data.WebPort = data.Configuration.WebPort
+		p.conn.Data.WebNoSsl = data.Configuration.WebNoSsl
+	}
+
+	p.connected <- data
+
+	return
+}
+
+func (p *fakeProvider) WatchConnection() (err error) {
+	if p.watch != nil {
+		err = p.watch()
+	}
+	return
+}
+
+func (p *fakeProvider) Disconnect() {
+	select {
+	case p.disconnected <- true:
+	default:
+	}
+}
+
+func (p *fakeProvider) waitConnected(t *testing.T) (data *ConnData) {
+	t.Helper()
+
+	select {
+	case data = <-p.connected:
+	case <-time.After(testTimeout):
+		t.Fatal("connection: Timeout waiting for provider connect")
+	}
+
+	return
+}
+
+func (p *fakeProvider) waitDisconnected(t *testing.T) {
+	t.Helper()
+
+	select {
+	case <-p.disconnected:
+	case <-time.After(testTimeout):
+		t.Fatal("connection: Timeout waiting for provider disconnect")
+	}
+}
+
+func newFakeProvider(conn *Connection) (prov *fakeProvider) {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+
+	prefix := OvpnMode
+	if conn.Profile.Mode == WgMode {
+		prefix = WgMode
+	}
+
+	prov = &fakeProvider{
+		conn:         conn,
+		publicKey:    base64.StdEncoding.EncodeToString(key),
+		prefix:       prefix,
+		connected:    make(chan *ConnData, 1),
+		disconnected: make(chan bool, 1),
+	}
+
+	return
+}
+
+type eventRecorder struct {
+	connId   string
+	lock     sync.Mutex
+	types    []string
+	listener *event.Listener
+	done     chan bool
+}
+
+func (r *eventRecorder) has(typ string) bool {
+	start := time.Now()
+
+	for time.Since(start) < testTimeout {
+		r.lock.Lock()
+		for _, evtType := range r.types {
+			if evtType == typ {
+				r.lock.Unlock()
+				return true
+			}
+		}
+		r.lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return false
+}
+
+func (r *eventRecorder) Close() {
+	r.listener.Close()
+	close(r.done)
+}
+
+func newEventRecorder(connId string) (rec *eventRecorder) {
+	rec = &eventRecorder{
+		connId:   connId,
+		listener: event.NewListener(),
+		done:     make(chan bool),
+	}
+
+	stream := rec.listener.Listen()
+	go func() {
+		for {
+			var evt *event.Event
+			select {
+			case evt = <-stream:
+			case <-rec.done:
+				return
+			}
+
+			match := false
+			switch data := evt.Data.(type) {
+			case *Data:
+				match = data.Id == rec.connId
+			case *SsoEventData:
+				match = data.Id == rec.connId
+			case *FailoverEventData:
+				match = data.Id == rec.connId
+			}
+
+			if match {
+				rec.lock.Lock()
+				rec.types = append(rec.types, evt.Type)
+				rec.lock.Unlock()
+			}
+		}
+	}()
+
+	return
+}
+
+func newFakeServer(t *testing.T) (srv *fakeserver.Server) {
+	t.Helper()
+
+	srv, err := fakeserver.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	srv.Configuration = map[string]interface{}{
+		"address":       "10.150.0.2/24",
+		"gateway":       "127.0.0.1",
+		"hostname":      "127.0.0.1",
+		"port":          1194,
+		"web_port":      srv.Port(),
+		"ping_interval": 1,
+		"ping_timeout":  5,
+		"public_key":    "server-public-key",
+	}
+
+	return
+}
+
+func newTestConnection(t *testing.T, srv *fakeserver.Server, mode string,
+	opts Options) (conn *Connection) {
+
+	t.Helper()
+
+	conn, err := NewConnection(&Profile{
+		Id:                 utils.Uuid(),
+		Mode:               mode,
+		OrgId:              srv.OrgId,
+		UserId:             srv.UserId,
+		ServerId:           srv.ServerId,
+		SyncHosts:          []string{srv.URL()},
+		SyncToken:          srv.SyncToken,
+		SyncSecret:         srv.SyncSecret,
+		Data:               srv.ProfileData(),
+		Password:           "password",
+		ServerBoxPublicKey: srv.BoxPublicKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.State.Init(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	GlobalStore.Add(conn.Id, conn)
+
+	return
+}
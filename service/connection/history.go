@@ -0,0 +1,118 @@
+package connection
+
+import (
+	"time"
+
+	"github.com/pritunl/pritunl-client-electron/service/sprofile"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	AuthAllowed              = "allowed"
+	AuthDenied               = "denied"
+	AuthRegistrationRequired = "registration_required"
+	AuthSsoRequired          = "sso_required"
+	AuthFailed               = "failed"
+)
+
+func (s *State) initSession() {
+	s.sessionLock.Lock()
+	s.session = &sprofile.Session{
+		Id:     s.id,
+		Mode:   s.conn.Profile.Mode,
+		Start:  s.startTime.Unix(),
+		Events: []string{},
+	}
+	s.sessionLock.Unlock()
+}
+
+func (s *State) SetSessionRemote(remote string) {
+	s.sessionLock.Lock()
+	if s.session != nil {
+		s.session.Remote = remote
+	}
+	s.sessionLock.Unlock()
+}
+
+func (s *State) SetSessionAuth(auth string) {
+	s.sessionLock.Lock()
+	if s.session != nil {
+		s.session.Auth = auth
+	}
+	s.sessionLock.Unlock()
+}
+
+func (s *State) setSessionReason(reason string) {
+	s.sessionLock.Lock()
+	if s.session != nil && s.session.Reason == "" {
+		s.session.Reason = reason
+	}
+	s.sessionLock.Unlock()
+}
+
+func (s *State) addSessionEvent(evtType string) {
+	s.sessionLock.Lock()
+	if s.session != nil {
+		for _, typ := range s.session.Events {
+			if typ == evtType {
+				s.sessionLock.Unlock()
+				return
+			}
+		}
+		s.session.Events = append(s.session.Events, evtType)
+	}
+	s.sessionLock.Unlock()
+}
+
+func (s *State) updateSession() {
+	data := s.conn.Data
+
+	s.sessionLock.Lock()
+	defer s.sessionLock.Unlock()
+
+	if s.session == nil {
+		return
+	}
+
+	if data.Timestamp != 0 {
+		s.session.Connected = data.Timestamp
+		if s.session.Auth == "" {
+			s.session.Auth = AuthAllowed
+		}
+	}
+	if data.ClientAddr != "" {
+		s.session.ClientAddr = data.ClientAddr
+	}
+	if data.ServerAddr != "" {
+		s.session.ServerAddr = data.ServerAddr
+	}
+	if data.RxBytes != 0 || data.TxBytes != 0 {
+		s.session.RxBytes = data.RxBytes
+		s.session.TxBytes = data.TxBytes
+	}
+}
+
+func (s *State) commitSession() {
+	s.sessionLock.Lock()
+	sess := s.session
+	s.session = nil
+	s.sessionLock.Unlock()
+
+	if sess == nil || !s.conn.Profile.SystemProfile {
+		return
+	}
+
+	sess.End = time.Now().Unix()
+
+	sprfl := sprofile.Get(s.conn.Profile.Id)
+	if sprfl == nil {
+		return
+	}
+
+	err := sprfl.PushHistory(sess)
+	if err != nil {
+		logrus.WithFields(s.conn.Fields(logrus.Fields{
+			"error": err,
+		})).Error("connection: Failed to store session history")
+	}
+}
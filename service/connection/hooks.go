@@ -0,0 +1,239 @@
+package connection
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/command"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/log"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	HookPreConnect     = "pre_connect"
+	HookPostConnect    = "post_connect"
+	HookPreDisconnect  = "pre_disconnect"
+	HookPostDisconnect = "post_disconnect"
+	hookTimeoutDefault = 30 * time.Second
+	hookStopTimeoutMax = 30 * time.Second
+)
+
+func (c *Connection) hookScript(hookType string) string {
+	switch hookType {
+	case HookPreConnect:
+		return c.Profile.PreConnectHook
+	case HookPostConnect:
+		return c.Profile.PostConnectHook
+	case HookPreDisconnect:
+		return c.Profile.PreDisconnectHook
+	case HookPostDisconnect:
+		return c.Profile.PostDisconnectHook
+	}
+	return ""
+}
+
+// hookTimeout caps the synchronous pre disconnect hook to avoid blocking
+// the connection stop for the full configured timeout
+func (c *Connection) hookTimeout(hookType string) (timeout time.Duration) {
+	timeout = hookTimeoutDefault
+	if c.Profile.HookTimeout > 0 {
+		timeout = time.Duration(c.Profile.HookTimeout) * time.Second
+	}
+
+	if hookType == HookPreDisconnect && timeout > hookStopTimeoutMax {
+		timeout = hookStopTimeoutMax
+	}
+
+	return
+}
+
+func (c *Connection) hookEnv(hookType string) (env []string) {
+	routes := []string{}
+	for _, route := range c.Data.Routes {
+		routes = append(routes, route.Network)
+	}
+
+	routes6 := []string{}
+	for _, route := range c.Data.Routes6 {
+		routes6 = append(routes6, route.Network)
+	}
+
+	env = []string{
+		"PRITUNL_HOOK=" + hookType,
+		"PRITUNL_PROFILE_ID=" + c.Id,
+		"PRITUNL_MODE=" + c.Data.Mode,
+		"PRITUNL_STATUS=" + c.Data.GetStatus(),
+		"PRITUNL_IFACE=" + c.Data.Iface,
+		"PRITUNL_TUN_IFACE=" + c.Data.WgTunIface,
+		"PRITUNL_SERVER_ADDR=" + c.Data.ServerAddr,
+		"PRITUNL_CLIENT_ADDR=" + c.Data.ClientAddr,
+		"PRITUNL_GATEWAY_ADDR=" + c.Data.GatewayAddr,
+		"PRITUNL_GATEWAY_ADDR6=" + c.Data.GatewayAddr6,
+		"PRITUNL_DNS_SERVERS=" + strings.Join(c.Data.DnsServers, " "),
+		"PRITUNL_SEARCH_DOMAINS=" + strings.Join(c.Data.SearchDomains, " "),
+		"PRITUNL_ROUTES=" + strings.Join(routes, " "),
+		"PRITUNL_ROUTES6=" + strings.Join(routes6, " "),
+		"PRITUNL_TIMESTAMP=" + strconv.FormatInt(c.Data.Timestamp, 10),
+	}
+
+	return
+}
+
+func (c *Connection) pushHookOutput(hookType, output string) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if line == "" {
+			continue
+		}
+
+		err := log.ProfilePushLog(c.Id, fmt.Sprintf("hook %s: %s",
+			hookType, line))
+		if err != nil {
+			logrus.WithFields(c.Fields(logrus.Fields{
+				"hook":  hookType,
+				"error": err,
+			})).Error("connection: Failed to push hook output")
+			return
+		}
+	}
+}
+
+func hookCommand(script string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "windows":
+		return command.Command("cmd.exe", "/C", script)
+	default:
+		return command.Command("/bin/sh", "-c", script)
+	}
+}
+
+func execHook(script string, env []string, timeout time.Duration) (
+	output string, err error) {
+
+	buf := &bytes.Buffer{}
+
+	cmd := hookCommand(script)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = buf
+	cmd.Stderr = buf
+	cmd.WaitDelay = 3 * time.Second
+
+	err = cmd.Start()
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "connection: Failed to start hook"),
+		}
+		return
+	}
+
+	waiter := make(chan error, 1)
+	go func() {
+		waiter <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-waiter:
+		if err != nil {
+			err = &errortypes.ExecError{
+				errors.Wrap(err, "connection: Hook failed"),
+			}
+		}
+		break
+	case <-time.After(timeout):
+		_ = cmd.Process.Kill()
+		<-waiter
+		err = &errortypes.ExecError{
+			errors.Newf("connection: Hook timed out after %s", timeout),
+		}
+		break
+	}
+
+	output = buf.String()
+
+	return
+}
+
+func (c *Connection) finishHook(hookType, output string, err error) {
+	c.pushHookOutput(hookType, output)
+
+	if err != nil {
+		c.pushHookOutput(hookType, err.Error())
+
+		logrus.WithFields(c.Fields(logrus.Fields{
+			"hook":  hookType,
+			"error": err,
+		})).Error("connection: Profile hook failed")
+	}
+}
+
+func (c *Connection) runHook(hookType string) (err error) {
+	script := strings.TrimSpace(c.hookScript(hookType))
+	if script == "" {
+		return
+	}
+
+	output, err := execHook(script, c.hookEnv(hookType),
+		c.hookTimeout(hookType))
+	c.finishHook(hookType, output, err)
+
+	return
+}
+
+func (c *Connection) runHookBackground(hookType string) {
+	script := strings.TrimSpace(c.hookScript(hookType))
+	if script == "" {
+		return
+	}
+
+	env := c.hookEnv(hookType)
+	timeout := c.hookTimeout(hookType)
+
+	go func() {
+		defer func() {
+			panc := recover()
+			if panc != nil {
+				logrus.WithFields(c.Fields(logrus.Fields{
+					"trace": string(debug.Stack()),
+					"panic": panc,
+				})).Error("connection: Profile hook panic")
+			}
+		}()
+
+		output, err := execHook(script, env, timeout)
+		c.finishHook(hookType, output, err)
+	}()
+}
+
+func (c *Client) hookConnected() {
+	c.hooksLock.Lock()
+	if c.hooksConnected {
+		c.hooksLock.Unlock()
+		return
+	}
+	c.hooksConnected = true
+	c.hooksLock.Unlock()
+
+	c.conn.runHookBackground(HookPostConnect)
+}
+
+func (c *Client) hookDisconnect() (connected bool) {
+	c.hooksLock.Lock()
+	connected = c.hooksConnected
+	c.hooksConnected = false
+	c.hooksLock.Unlock()
+
+	if connected {
+		c.conn.runHook(HookPreDisconnect)
+	}
+
+	return
+}
@@ -0,0 +1,96 @@
+package connection
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+)
+
+func TestHookEnv(t *testing.T) {
+	conn, err := NewConnection(&Profile{
+		Id:              utils.Uuid(),
+		Mode:            WgMode,
+		PostConnectHook: "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Data.Iface = "pritunl0"
+	conn.Data.ClientAddr = "10.8.0.6"
+	conn.Data.DnsServers = []string{"10.8.0.1", "10.8.0.2"}
+	conn.Data.Routes = []*Route{
+		{Network: "10.0.0.0/8"},
+		{Network: "172.16.0.0/12"},
+	}
+
+	if conn.hookScript(HookPostConnect) != "true" ||
+		conn.hookScript(HookPreConnect) != "" {
+
+		t.Fatal("connection: Unexpected hook script")
+	}
+	if conn.hookTimeout(HookPostConnect) != hookTimeoutDefault {
+		t.Fatalf("connection: Unexpected hook timeout %s",
+			conn.hookTimeout(HookPostConnect))
+	}
+
+	conn.Profile.HookTimeout = 600
+	if conn.hookTimeout(HookPostConnect) != 600*time.Second {
+		t.Fatalf("connection: Unexpected hook timeout %s",
+			conn.hookTimeout(HookPostConnect))
+	}
+	if conn.hookTimeout(HookPreDisconnect) != hookStopTimeoutMax {
+		t.Fatalf("connection: Unexpected pre disconnect hook timeout %s",
+			conn.hookTimeout(HookPreDisconnect))
+	}
+
+	env := strings.Join(conn.hookEnv(HookPostConnect), "\n") + "\n"
+	for _, val := range []string{
+		"PRITUNL_HOOK=post_connect\n",
+		"PRITUNL_PROFILE_ID=" + conn.Id + "\n",
+		"PRITUNL_IFACE=pritunl0\n",
+		"PRITUNL_CLIENT_ADDR=10.8.0.6\n",
+		"PRITUNL_DNS_SERVERS=10.8.0.1 10.8.0.2\n",
+		"PRITUNL_ROUTES=10.0.0.0/8 172.16.0.0/12\n",
+	} {
+		if !strings.Contains(env, val) {
+			t.Errorf("connection: Missing hook env %q", val)
+		}
+	}
+}
+
+func TestExecHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("connection: Hook scripts use sh")
+	}
+
+	output, err := execHook("echo $PRITUNL_CLIENT_ADDR; echo err 1>&2",
+		[]string{"PRITUNL_CLIENT_ADDR=10.8.0.6"}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "10.8.0.6\nerr\n" {
+		t.Fatalf("connection: Unexpected hook output %q", output)
+	}
+
+	_, err = execHook("exit 3", nil, 5*time.Second)
+	if err == nil {
+		t.Fatal("connection: Expected hook exit error")
+	}
+
+	start := time.Now()
+	output, err = execHook("echo start; sleep 10", nil,
+		500*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("connection: Expected hook timeout, got %v", err)
+	}
+	if output != "start\n" {
+		t.Fatalf("connection: Unexpected hook output %q", output)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("connection: Hook timeout not enforced")
+	}
+}
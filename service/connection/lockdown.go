@@ -0,0 +1,42 @@
+package connection
+
+import (
+	"github.com/pritunl/pritunl-client-electron/service/lockdown"
+	"github.com/sirupsen/logrus"
+)
+
+func (c *Connection) updateLockdown() (err error) {
+	if !c.Profile.Lockdown {
+		return
+	}
+
+	ifaces := []string{}
+	if c.Data.Iface != "" {
+		ifaces = append(ifaces, c.Data.Iface)
+	}
+
+	addrs := c.Data.Remotes.GetAddrs()
+
+	err = lockdown.Set(c.Id, ifaces, addrs)
+	if err != nil {
+		logrus.WithFields(c.Fields(logrus.Fields{
+			"error": err,
+		})).Error("connection: Failed to apply lockdown rules")
+		return
+	}
+
+	return
+}
+
+func (c *Connection) clearLockdown() {
+	if !lockdown.IsActive(c.Id) {
+		return
+	}
+
+	err := lockdown.Remove(c.Id)
+	if err != nil {
+		logrus.WithFields(c.Fields(logrus.Fields{
+			"error": err,
+		})).Error("connection: Failed to remove lockdown rules")
+	}
+}
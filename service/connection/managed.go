@@ -0,0 +1,77 @@
+package connection
+
+import (
+	"runtime/debug"
+	"time"
+
+	"github.com/pritunl/pritunl-client-electron/service/sprofile"
+	"github.com/pritunl/pritunl-client-electron/service/token"
+	"github.com/sirupsen/logrus"
+)
+
+func ReconcileManagedProfiles() (err error) {
+	removed, err := sprofile.ReconcileManaged()
+	if err != nil {
+		return
+	}
+
+	for _, prflId := range removed {
+		logrus.WithFields(logrus.Fields{
+			"profile_id": prflId,
+		}).Info("profile: Removing managed profile")
+
+		GlobalStore.SetStop(prflId)
+
+		conn := GlobalStore.Get(prflId)
+		if conn != nil {
+			conn.Stop()
+		}
+
+		sprofile.Remove(prflId)
+		token.Clear(prflId)
+	}
+
+	return
+}
+
+func watchManagedProfiles() {
+	defer func() {
+		panc := recover()
+		if panc != nil {
+			logrus.WithFields(logrus.Fields{
+				"trace": string(debug.Stack()),
+				"panic": panc,
+			}).Error("profile: Watch managed profiles panic")
+			time.Sleep(5 * time.Second)
+			go watchManagedProfiles()
+		}
+	}()
+
+	lastSig := ""
+	first := true
+
+	for {
+		if Shutdown {
+			return
+		}
+
+		sig := sprofile.ManagedSignature()
+		if first || sig != lastSig {
+			err := ReconcileManagedProfiles()
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": err,
+				}).Error("profile: Failed to reconcile managed profiles")
+			} else {
+				lastSig = sig
+				first = false
+			}
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func WatchManagedProfiles() {
+	go watchManagedProfiles()
+}
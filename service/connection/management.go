@@ -0,0 +1,417 @@
+package connection
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	managementBytecount = 3
+	managementAttempts  = 50
+)
+
+type management struct {
+	ovpn   *Ovpn
+	sock   net.Conn
+	reader *bufio.Reader
+	lock   sync.Mutex
+}
+
+func newManagement(o *Ovpn) *management {
+	return &management{
+		ovpn: o,
+	}
+}
+
+func (m *management) Open() (err error) {
+	sock, err := net.DialTimeout(
+		"tcp",
+		fmt.Sprintf("127.0.0.1:%d", m.ovpn.managementPort),
+		3*time.Second,
+	)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "management: Failed to open socket"),
+		}
+		return
+	}
+
+	m.sock = sock
+	m.reader = bufio.NewReader(sock)
+
+	err = sock.SetDeadline(time.Now().Add(3 * time.Second))
+	if err != nil {
+		m.Close()
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "management: Failed set deadline"),
+		}
+		return
+	}
+
+	err = m.Command(m.ovpn.managementPass)
+	if err != nil {
+		m.Close()
+		return
+	}
+
+	for {
+		line, e := m.reader.ReadString('\n')
+		if e != nil {
+			m.Close()
+			err = &errortypes.ReadError{
+				errors.Wrap(e, "management: Failed to read password reply"),
+			}
+			return
+		}
+
+		if strings.Contains(line, "SUCCESS:") {
+			break
+		} else if strings.Contains(line, "ERROR:") {
+			m.Close()
+			err = &errortypes.ReadError{
+				errors.Newf("management: Password rejected '%s'",
+					strings.TrimSpace(line)),
+			}
+			return
+		}
+	}
+
+	err = sock.SetDeadline(time.Time{})
+	if err != nil {
+		m.Close()
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "management: Failed clear deadline"),
+		}
+		return
+	}
+
+	return
+}
+
+func (m *management) Command(cmd string) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.sock == nil {
+		err = &errortypes.WriteError{
+			errors.New("management: Socket not open"),
+		}
+		return
+	}
+
+	err = m.sock.SetWriteDeadline(time.Now().Add(3 * time.Second))
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "management: Failed set deadline"),
+		}
+		return
+	}
+
+	_, err = m.sock.Write([]byte(cmd + "\n"))
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "management: Failed to write socket command"),
+		}
+		return
+	}
+
+	return
+}
+
+func (m *management) Subscribe() (err error) {
+	cmds := []string{
+		"state on",
+		"state",
+		fmt.Sprintf("bytecount %d", managementBytecount),
+		"log on",
+	}
+
+	for _, cmd := range cmds {
+		err = m.Command(cmd)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (m *management) Close() {
+	m.lock.Lock()
+	sock := m.sock
+	m.lock.Unlock()
+
+	if sock != nil {
+		_ = sock.Close()
+	}
+}
+
+func (m *management) watch() {
+	for {
+		line, err := m.reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		m.parseLine(line)
+	}
+}
+
+func (m *management) parseLine(line string) {
+	if !strings.HasPrefix(line, ">") {
+		if strings.HasPrefix(line, "ERROR:") {
+			logrus.WithFields(m.ovpn.conn.Fields(logrus.Fields{
+				"line": line,
+			})).Error("management: Command error")
+		} else if !strings.HasPrefix(line, "SUCCESS:") &&
+			line != "END" {
+
+			// Reply to the "state" command has no prefix
+			m.parseState(line)
+		}
+		return
+	}
+
+	split := strings.SplitN(line[1:], ":", 2)
+	if len(split) != 2 {
+		return
+	}
+	msg := split[1]
+
+	switch split[0] {
+	case "STATE":
+		m.parseState(msg)
+		break
+	case "BYTECOUNT":
+		m.parseBytecount(msg)
+		break
+	case "PASSWORD":
+		m.parsePassword(msg)
+		break
+	case "LOG":
+		m.parseLog(msg)
+		break
+	case "FATAL":
+		logrus.WithFields(m.ovpn.conn.Fields(logrus.Fields{
+			"message": msg,
+		})).Error("management: Ovpn fatal error")
+		break
+	}
+}
+
+func (m *management) parseState(msg string) {
+	o := m.ovpn
+	fields := strings.Split(msg, ",")
+	if len(fields) < 5 {
+		return
+	}
+
+	timestamp, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return
+	}
+
+	if o.conn.State.IsStop() {
+		return
+	}
+
+	state := fields[1]
+	localAddr := fields[3]
+	remoteAddr := fields[4]
+
+	switch state {
+	case "ASSIGN_IP":
+		if localAddr != "" {
+			o.conn.Data.ClientAddr = localAddr
+			o.conn.Data.UpdateEvent()
+		}
+		break
+	case "CONNECTED":
+		if localAddr != "" {
+			o.conn.Data.ClientAddr = localAddr
+		}
+		if remoteAddr != "" {
+			o.conn.Data.ServerAddr = remoteAddr
+		}
+		o.setConnected(timestamp)
+		break
+	case "RECONNECTING":
+		if o.connected {
+			o.connected = false
+			o.conn.Data.SetStatus(Connecting)
+			o.conn.Data.Timestamp = 0
+			o.conn.Data.UpdateEvent()
+		}
+		break
+	default:
+		if remoteAddr != "" {
+			o.conn.Data.ServerAddr = remoteAddr
+			o.conn.Data.UpdateEvent()
+		}
+		break
+	}
+}
+
+func (m *management) parseBytecount(msg string) {
+	fields := strings.Split(msg, ",")
+	if len(fields) != 2 {
+		return
+	}
+
+	rxBytes, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return
+	}
+
+	txBytes, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return
+	}
+
+	m.ovpn.conn.Data.RxBytes = rxBytes
+	m.ovpn.conn.Data.TxBytes = txBytes
+}
+
+func (m *management) parsePassword(msg string) {
+	o := m.ovpn
+
+	if strings.HasPrefix(msg, "Verification Failed") {
+		if !o.authFailed && !o.conn.State.IsStop() {
+			o.authFailure()
+		}
+	} else if strings.HasPrefix(msg, "Need ") {
+		logrus.WithFields(o.conn.Fields(logrus.Fields{
+			"message": msg,
+		})).Warn("management: Unexpected credential request")
+	}
+}
+
+func (m *management) parseLog(msg string) {
+	fields := strings.SplitN(msg, ",", 3)
+	if len(fields) != 3 {
+		return
+	}
+
+	if strings.Contains(fields[1], "F") {
+		logrus.WithFields(m.ovpn.conn.Fields(logrus.Fields{
+			"message": fields[2],
+		})).Error("management: Ovpn fatal log")
+	}
+}
+
+func (o *Ovpn) isManaged() bool {
+	o.managementLock.Lock()
+	managed := o.management != nil
+	o.managementLock.Unlock()
+	return managed
+}
+
+func (o *Ovpn) watchManagement() {
+	defer func() {
+		panc := recover()
+		if panc != nil {
+			logrus.WithFields(o.conn.Fields(logrus.Fields{
+				"trace": string(debug.Stack()),
+				"panic": panc,
+			})).Error("profile: Watch management panic")
+		}
+	}()
+
+	if o.managementPort == 0 {
+		return
+	}
+
+	mgmt := newManagement(o)
+
+	var err error
+	for i := 0; i < managementAttempts; i++ {
+		if o.conn.State.IsStop() || o.running != 1 {
+			return
+		}
+
+		err = mgmt.Open()
+		if err == nil {
+			break
+		}
+
+		time.Sleep(200 * time.Millisecond)
+	}
+	if err != nil {
+		logrus.WithFields(o.conn.Fields(logrus.Fields{
+			"error": err,
+		})).Error("profile: Failed to open management session")
+		return
+	}
+
+	o.managementLock.Lock()
+	o.management = mgmt
+	o.managementLock.Unlock()
+
+	err = mgmt.Subscribe()
+	if err != nil {
+		logrus.WithFields(o.conn.Fields(logrus.Fields{
+			"error": err,
+		})).Error("profile: Failed to subscribe management session")
+	}
+
+	mgmt.watch()
+
+	o.managementLock.Lock()
+	if o.management == mgmt {
+		o.management = nil
+	}
+	o.managementLock.Unlock()
+
+	mgmt.Close()
+}
+
+func (o *Ovpn) closeManagement() {
+	o.managementLock.Lock()
+	mgmt := o.management
+	o.management = nil
+	o.managementLock.Unlock()
+
+	if mgmt != nil {
+		mgmt.Close()
+	}
+}
+
+func (o *Ovpn) sendManagementCommand(cmd string) (err error) {
+	o.managementLock.Lock()
+	mgmt := o.management
+	o.managementLock.Unlock()
+
+	if mgmt != nil {
+		err = mgmt.Command(cmd)
+		return
+	}
+
+	mgmt = newManagement(o)
+	err = mgmt.Open()
+	if err != nil {
+		return
+	}
+	defer mgmt.Close()
+
+	err = mgmt.Command(cmd)
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -0,0 +1,188 @@
+package connection
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+)
+
+func newTestManagement(t *testing.T) (o *Ovpn, lstn net.Listener) {
+	t.Helper()
+
+	conn, err := NewConnection(&Profile{
+		Id:   utils.Uuid(),
+		Mode: OvpnMode,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.State.Init(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lstn, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		lstn.Close()
+	})
+
+	o = conn.Ovpn
+	o.managementPort = lstn.Addr().(*net.TCPAddr).Port
+	o.managementPass = "management-pass"
+	o.running = 1
+
+	return
+}
+
+func acceptManagement(t *testing.T, lstn net.Listener, pass string) (
+	sock net.Conn, reader *bufio.Reader, ok bool) {
+
+	sock, err := lstn.Accept()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	reader = bufio.NewReader(sock)
+
+	_, _ = sock.Write([]byte("ENTER PASSWORD:"))
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if strings.TrimSpace(line) != pass {
+		_, _ = sock.Write([]byte("ERROR: bad password\r\n"))
+		sock.Close()
+		return
+	}
+
+	_, _ = sock.Write([]byte("SUCCESS: password is correct\r\n"))
+	ok = true
+
+	return
+}
+
+func waitCondition(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	timeout := time.After(testTimeout)
+	for !cond() {
+		select {
+		case <-timeout:
+			t.Fatal("timeout waiting for condition")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+func TestManagementSession(t *testing.T) {
+	o, lstn := newTestManagement(t)
+
+	cmds := make(chan []string, 1)
+	release := make(chan bool)
+	go func() {
+		sock, reader, ok := acceptManagement(t, lstn, o.managementPass)
+		if !ok {
+			return
+		}
+		defer sock.Close()
+
+		received := []string{}
+		for i := 0; i < 4; i++ {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			received = append(received, strings.TrimSpace(line))
+		}
+		cmds <- received
+		<-release
+
+		_, _ = sock.Write([]byte(
+			"SUCCESS: real-time state notification set to ON\r\n" +
+				"1700000000,WAIT,,,198.51.100.1,1194,,\r\n" +
+				"END\r\n" +
+				">STATE:1700000001,ASSIGN_IP,,10.8.0.6,,,,\r\n" +
+				">STATE:1700000002,CONNECTED,SUCCESS,10.8.0.6," +
+				"198.51.100.1,1194,,\r\n" +
+				">BYTECOUNT:1024,2048\r\n",
+		))
+	}()
+
+	watchDone := make(chan bool)
+	go func() {
+		o.watchManagement()
+		close(watchDone)
+	}()
+
+	select {
+	case received := <-cmds:
+		expected := []string{
+			"state on",
+			"state",
+			"bytecount 3",
+			"log on",
+		}
+		if strings.Join(received, "|") != strings.Join(expected, "|") {
+			t.Fatalf("unexpected management commands %v", received)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("timeout waiting for management commands")
+	}
+
+	if !o.isManaged() {
+		t.Error("expected management session")
+	}
+
+	close(release)
+
+	select {
+	case <-watchDone:
+	case <-time.After(testTimeout):
+		t.Fatal("timeout waiting for management session end")
+	}
+
+	data := o.conn.Data
+	if data.Status != Connected {
+		t.Errorf("unexpected status %s", data.Status)
+	}
+	if data.Timestamp != 1700000002 {
+		t.Errorf("unexpected timestamp %d", data.Timestamp)
+	}
+	if data.ClientAddr != "10.8.0.6" {
+		t.Errorf("unexpected client addr %s", data.ClientAddr)
+	}
+	if data.ServerAddr != "198.51.100.1" {
+		t.Errorf("unexpected server addr %s", data.ServerAddr)
+	}
+	if data.RxBytes != 1024 || data.TxBytes != 2048 {
+		t.Errorf("unexpected bytes %d %d", data.RxBytes, data.TxBytes)
+	}
+	if o.isManaged() {
+		t.Error("expected management session closed")
+	}
+}
+
+func TestManagementPasswordRejected(t *testing.T) {
+	o, lstn := newTestManagement(t)
+
+	go acceptManagement(t, lstn, "other-pass")
+
+	mgmt := newManagement(o)
+	err := mgmt.Open()
+	if err == nil {
+		mgmt.Close()
+		t.Fatal("expected password error")
+	}
+}
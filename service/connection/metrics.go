@@ -0,0 +1,79 @@
+package connection
+
+import (
+	"time"
+
+	"github.com/pritunl/pritunl-client-electron/service/metrics"
+)
+
+func init() {
+	metrics.Register(collectMetrics)
+}
+
+func collectMetrics(w *metrics.Writer) {
+	conns := GlobalStore.GetAll()
+
+	statuses := map[string]int{
+		Connecting:    0,
+		Connected:     0,
+		Disconnecting: 0,
+		Disconnected:  0,
+	}
+	for _, conn := range conns {
+		statuses[conn.Data.GetStatus()] += 1
+	}
+
+	w.Header("pritunl_client_connections",
+		"Active connections by status.", "gauge")
+	for _, status := range []string{
+		Connecting, Connected, Disconnecting, Disconnected} {
+
+		w.Sample("pritunl_client_connections",
+			float64(statuses[status]), "status", status)
+	}
+
+	w.Header("pritunl_client_connection_uptime_seconds",
+		"Seconds since the connection was established.", "gauge")
+	for _, conn := range conns {
+		if conn.Data.GetStatus() != Connected || conn.Data.Timestamp == 0 {
+			continue
+		}
+
+		w.Sample("pritunl_client_connection_uptime_seconds",
+			float64(time.Now().Unix()-conn.Data.Timestamp),
+			"profile_id", conn.Id, "mode", conn.Profile.Mode)
+	}
+
+	w.Header("pritunl_client_wg_handshake_age_seconds",
+		"Seconds since the last WireGuard handshake.", "gauge")
+	for _, conn := range conns {
+		if !conn.Profile.IsWg() {
+			continue
+		}
+
+		lastHandshake := conn.Wg.getLastHandshake()
+		if lastHandshake == 0 {
+			continue
+		}
+
+		w.Sample("pritunl_client_wg_handshake_age_seconds",
+			float64(time.Now().Unix()-int64(lastHandshake)),
+			"profile_id", conn.Id)
+	}
+
+	w.Header("pritunl_client_ping_latency_seconds",
+		"Latency of the last successful WireGuard keepalive ping.", "gauge")
+	for _, conn := range conns {
+		if !conn.Profile.IsWg() {
+			continue
+		}
+
+		pingLatency := conn.Wg.getPingLatency()
+		if pingLatency == 0 {
+			continue
+		}
+
+		w.Sample("pritunl_client_ping_latency_seconds",
+			pingLatency.Seconds(), "profile_id", conn.Id)
+	}
+}
@@ -0,0 +1,155 @@
+package connection
+
+import (
+	"net"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"github.com/pritunl/pritunl-client-electron/service/netmon"
+	"github.com/pritunl/pritunl-client-electron/service/wireguard"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	netPaths     = map[string]string{}
+	netPathsLock = sync.Mutex{}
+)
+
+func (c *Connection) networkPath() (path string) {
+	addr := c.Data.ServerAddr
+	if addr == "" {
+		return
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		for _, remote := range c.Data.Remotes {
+			if remote.Equal(addr) || remote.Host == addr {
+				addr4, addr6 := remote.GetAddrs()
+				if addr4 != "" {
+					ip = net.ParseIP(addr4)
+				} else if addr6 != "" {
+					ip = net.ParseIP(addr6)
+				}
+				break
+			}
+		}
+	}
+	if ip == nil {
+		ips, err := net.LookupIP(addr)
+		if err != nil || len(ips) == 0 {
+			return
+		}
+		ip = ips[0]
+	}
+
+	mark := 0
+	if c.Profile.IsWg() && c.Data.Iface != "" {
+		mark = wireguard.GetMark(c.Data.Iface)
+	}
+
+	path, err := netmon.Path(ip, mark)
+	if err != nil {
+		logrus.WithFields(c.Fields(logrus.Fields{
+			"error": err,
+		})).Warn("connection: Failed to get network path")
+		path = ""
+		return
+	}
+
+	return
+}
+
+func (c *Connection) updateNetworkPath() {
+	if runtime.GOOS != "linux" {
+		return
+	}
+
+	path := c.networkPath()
+	if path == "" {
+		return
+	}
+
+	netPathsLock.Lock()
+	netPaths[c.State.id] = path
+	netPathsLock.Unlock()
+}
+
+func (c *Connection) checkNetworkPath() (changed bool) {
+	path := c.networkPath()
+	if path == "" {
+		return
+	}
+
+	netPathsLock.Lock()
+	prevPath := netPaths[c.State.id]
+	netPaths[c.State.id] = path
+	netPathsLock.Unlock()
+
+	if prevPath == "" || prevPath == path {
+		return
+	}
+
+	logrus.WithFields(c.Fields(logrus.Fields{
+		"previous_path": prevPath,
+		"path":          path,
+	})).Warn("connection: Network path changed")
+
+	changed = true
+	return
+}
+
+func HandleNetworkChange() {
+	conns := GlobalStore.GetAll()
+
+	stateIds := map[string]bool{}
+	for _, conn := range conns {
+		stateIds[conn.State.id] = true
+	}
+
+	netPathsLock.Lock()
+	for stateId := range netPaths {
+		if !stateIds[stateId] {
+			delete(netPaths, stateId)
+		}
+	}
+	netPathsLock.Unlock()
+
+	if !GlobalStore.IsConnected() {
+		_, _ = GetPublicAddress4()
+		_, _ = GetPublicAddress6()
+	}
+
+	for _, conn := range conns {
+		if conn.State.IsStop() {
+			continue
+		}
+
+		go conn.handleNetworkChange()
+	}
+}
+
+// handleNetworkChange runs on a separate goroutine to keep the remote
+// lookups from blocking the network monitor handler
+func (c *Connection) handleNetworkChange() {
+	defer func() {
+		panc := recover()
+		if panc != nil {
+			logrus.WithFields(logrus.Fields{
+				"trace": string(debug.Stack()),
+				"panic": panc,
+			}).Error("connection: Network change restart panic")
+		}
+	}()
+
+	c.Data.Remotes.Refresh()
+
+	if c.State.IsStop() || c.Data.GetStatus() != Connected ||
+		!c.checkNetworkPath() {
+
+		return
+	}
+
+	c.Reconnect(ReconnectNetworkChange)
+}
@@ -13,7 +13,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -25,6 +24,7 @@ import (
 
 	"github.com/dropbox/godropbox/errors"
 	"github.com/pritunl/pritunl-client-electron/service/command"
+	"github.com/pritunl/pritunl-client-electron/service/dnsproxy"
 	"github.com/pritunl/pritunl-client-electron/service/errortypes"
 	"github.com/pritunl/pritunl-client-electron/service/log"
 	"github.com/pritunl/pritunl-client-electron/service/parser"
@@ -46,6 +46,7 @@ type Ovpn struct {
 	managementPort int
 	managementPass string
 	managementLock sync.Mutex
+	management     *management
 	authFailed     bool
 	lastAuthFailed time.Time
 	remotes        parser.Remotes
@@ -77,6 +78,7 @@ func (o *Ovpn) Fields() logrus.Fields {
 		"ovpn_tap_iface":        o.tapIface,
 		"ovpn_management_port":  o.managementPort,
 		"ovpn_management_pass":  o.managementPass != "",
+		"ovpn_managed":          o.management != nil,
 		"ovpn_auth_failed":      o.authFailed,
 		"ovpn_last_auth_failed": utils.SinceFormatted(o.lastAuthFailed),
 		"ovpn_cmd":              o.cmd != nil,
@@ -407,6 +409,7 @@ func (o *Ovpn) Connect(data *ConnData) (err error) {
 	o.running = 1
 	go o.watchCmd()
 	go o.waitCmd()
+	go o.watchManagement()
 
 	return
 }
@@ -439,9 +442,8 @@ func (o *Ovpn) write(data *ConnData) (
 	pth = filepath.Join(rootDir, o.conn.Id)
 	prflData := o.parsedPrfl.Export("")
 
-	if runtime.GOOS == "windows" {
-		o.managementPort = ManagementPortAcquire()
-
+	o.managementPort = ManagementPortAcquire()
+	if o.managementPort != 0 {
 		managementPassPath, e := o.writeManagementPass()
 		if e != nil {
 			err = e
@@ -668,7 +670,7 @@ func (o *Ovpn) writeUp() (pth string, err error) {
 	script := ""
 	switch runtime.GOOS {
 	case "darwin":
-		if o.conn.Profile.DisableDns {
+		if o.conn.Profile.DisableDns || dnsproxy.IsRunning() {
 			script = blockScript
 		} else if o.conn.Profile.ForceDns {
 			DnsForced = true
@@ -679,7 +681,7 @@ func (o *Ovpn) writeUp() (pth string, err error) {
 		break
 	case "linux":
 		if IsOvpn27() {
-			if o.conn.Profile.DisableDns {
+			if o.conn.Profile.DisableDns || dnsproxy.IsRunning() {
 				script = blockScript
 			} else {
 				script = resolvedScript27
@@ -697,7 +699,7 @@ func (o *Ovpn) writeUp() (pth string, err error) {
 				}
 			}
 
-			if o.conn.Profile.DisableDns {
+			if o.conn.Profile.DisableDns || dnsproxy.IsRunning() {
 				script = blockScript
 			} else if resolved {
 				script = resolvedScript
@@ -737,7 +739,7 @@ func (o *Ovpn) writeDown() (pth string, err error) {
 	script := ""
 	switch runtime.GOOS {
 	case "darwin":
-		if o.conn.Profile.DisableDns {
+		if o.conn.Profile.DisableDns || dnsproxy.IsRunning() {
 			script = blockScript
 		} else {
 			script = downScriptDarwin
@@ -745,7 +747,7 @@ func (o *Ovpn) writeDown() (pth string, err error) {
 		break
 	case "linux":
 		if IsOvpn27() {
-			if o.conn.Profile.DisableDns {
+			if o.conn.Profile.DisableDns || dnsproxy.IsRunning() {
 				script = blockScript
 			} else {
 				script = resolvedScript27
@@ -763,7 +765,7 @@ func (o *Ovpn) writeDown() (pth string, err error) {
 				}
 			}
 
-			if o.conn.Profile.DisableDns {
+			if o.conn.Profile.DisableDns || dnsproxy.IsRunning() {
 				script = blockScript
 			} else if resolved {
 				script = resolvedScript
@@ -893,6 +895,7 @@ func (o *Ovpn) Close() {
 	}()
 
 	o.killCmd()
+	o.closeManagement()
 
 	stdout := o.stdout
 	stderr := o.stderr
@@ -1016,35 +1019,43 @@ func (o *Ovpn) parseLine(line string) {
 		return
 	}
 
-	if strings.Contains(line, "Initialization Sequence Completed") ||
-		strings.Contains(line, "Peer Connection Initiated") {
+	managed := o.isManaged()
 
-		o.connected = true
-		o.conn.Data.Status = Connected
-		o.conn.Data.Timestamp = time.Now().Unix() - 3
-		o.conn.Data.UpdateEvent()
+	if !managed && (strings.Contains(
+		line, "Initialization Sequence Completed") ||
+		strings.Contains(line, "Peer Connection Initiated")) {
 
-		o.conn.Data.ValidateAuthToken()
+		o.setConnected(time.Now().Unix() - 3)
+	} else if strings.Contains(line, "PUSH_REPLY") {
+		servers, domains := parsePushDns(line)
+		routes, routes6 := parsePushRoutes(line)
+		o.conn.Data.SetNetwork(routes, routes6, servers, domains)
 
-		go func() {
-			defer func() {
-				panc := recover()
-				if panc != nil {
-					logrus.WithFields(o.conn.Fields(logrus.Fields{
-						"trace": string(debug.Stack()),
-						"panic": panc,
-					})).Error("profile: Clear DNS cache panic")
-				}
-			}()
+		if !o.conn.resolveConflicts(routes, routes6, servers, domains) {
+			o.conn.State.SetStop()
+			o.conn.StopBackground()
+		}
+	} else if runtime.GOOS == "linux" &&
+		strings.Contains(line, "TUN/TAP device ") &&
+		strings.Contains(line, " opened") {
 
-			utils.ClearDNSCache()
-		}()
+		fields := strings.Fields(strings.SplitN(
+			line, "TUN/TAP device ", 2)[1])
+		if len(fields) > 0 {
+			o.conn.Data.Iface = fields[0]
+			err := o.conn.updateLockdown()
+			if err != nil {
+				o.conn.State.SetStop()
+				o.conn.StopBackground()
+			}
+		}
 	} else if strings.Contains(line, "Inactivity timeout (--inactive)") {
 		o.conn.Data.SendProfileEvent("inactive")
 	} else if strings.Contains(line, "Inactivity timeout") ||
 		strings.Contains(line, "Connection reset") {
 
 		o.conn.Data.SendProfileEvent("timeout_error")
+		o.conn.State.SetReconnectReason(ReconnectKeepalive)
 	} else if strings.Contains(
 		line, "Can't assign requested address (code=49)") {
 
@@ -1073,26 +1084,9 @@ func (o *Ovpn) parseLine(line string) {
 	} else if strings.Contains(line, "AUTH_FAILED") || strings.Contains(
 		line, "auth-failure") && !o.authFailed {
 
-		o.authFailed = true
-		o.conn.Data.ResetAuthToken()
-		o.conn.State.NoReconnect("ovpn_auth_error")
-		o.conn.State.SetStop()
-
-		if o.conn.Profile.SystemProfile {
-			logrus.WithFields(o.conn.Fields(nil)).Info(
-				"connection: Stopping system profile due to " +
-					"authentication errors")
-
-			sprofile.Deactivate(o.conn.Profile.Id)
-			sprofile.SetAuthErrorCount(o.conn.Profile.Id, 0)
-		} else {
-			time.Sleep(3 * time.Second)
-		}
-
-		if utils.SinceAbs(o.lastAuthFailed) > 5*time.Second {
-			o.lastAuthFailed = time.Now()
-			o.conn.Data.SendProfileEvent("auth_error")
-		}
+		o.authFailure()
+	} else if managed {
+		return
 	} else if strings.Contains(line, "link remote:") {
 		sIndex := strings.LastIndex(line, "]") + 1
 		eIndex := strings.LastIndex(line, ":")
@@ -1161,71 +1155,67 @@ func (o *Ovpn) parseLine(line string) {
 	}
 }
 
-func (o *Ovpn) pushOutput(output string) {
-	output = strings.TrimSpace(output)
-
-	err := log.ProfilePushLog(o.conn.Id, output)
-	if err != nil {
-		logrus.WithFields(o.conn.Fields(logrus.Fields{
-			"output": output,
-			"error":  err,
-		})).Error("connection: Failed to push profile log output")
-	}
-
-	return
-}
-
-func (o *Ovpn) sendManagementCommand(cmd string) (err error) {
-	o.managementLock.Lock()
-	defer o.managementLock.Unlock()
+func (o *Ovpn) setConnected(timestamp int64) {
+	o.connected = true
+	o.conn.Data.SetStatus(Connected)
+	o.conn.Data.Timestamp = timestamp
+	o.conn.Data.UpdateEvent()
+	GlobalStore.ResetReconnect(o.conn.Id)
 
-	conn, err := net.DialTimeout(
-		"tcp",
-		fmt.Sprintf("127.0.0.1:%d", o.managementPort),
-		3*time.Second,
-	)
-	if err != nil {
-		err = &errortypes.ReadError{
-			errors.Wrap(err, "profile: Failed to open socket"),
-		}
-		return
-	}
-	defer conn.Close()
+	o.conn.Data.ValidateAuthToken()
+	o.conn.updateSplitTunnel()
+	o.conn.updateDnsProxy()
+	o.conn.Client.hookConnected()
+	o.conn.updateNetworkPath()
 
 	go func() {
-		for {
-			buf := make([]byte, 10000)
-			n, e := conn.Read(buf)
-			if e != nil || n == 0 {
-				break
+		defer func() {
+			panc := recover()
+			if panc != nil {
+				logrus.WithFields(o.conn.Fields(logrus.Fields{
+					"trace": string(debug.Stack()),
+					"panic": panc,
+				})).Error("profile: Clear DNS cache panic")
 			}
-		}
+		}()
+
+		utils.ClearDNSCache()
 	}()
+}
 
-	err = conn.SetDeadline(time.Now().Add(3 * time.Second))
-	if err != nil {
-		err = &errortypes.ReadError{
-			errors.Wrap(err, "profile: Failed set deadline"),
-		}
-		return
+func (o *Ovpn) authFailure() {
+	o.authFailed = true
+	o.conn.Data.ResetAuthToken()
+	o.conn.State.NoReconnect("ovpn_auth_error")
+	o.conn.State.SetSessionAuth(AuthDenied)
+	o.conn.State.SetStop()
+
+	if o.conn.Profile.SystemProfile {
+		logrus.WithFields(o.conn.Fields(nil)).Info(
+			"connection: Stopping system profile due to " +
+				"authentication errors")
+
+		sprofile.Deactivate(o.conn.Profile.Id)
+		sprofile.SetAuthErrorCount(o.conn.Profile.Id, 0)
+	} else {
+		time.Sleep(3 * time.Second)
 	}
 
-	_, err = conn.Write([]byte(fmt.Sprintf("%s\n", o.managementPass)))
-	if err != nil {
-		err = &errortypes.ReadError{
-			errors.Wrap(err, "profile: Failed to write socket password"),
-		}
-		return
+	if utils.SinceAbs(o.lastAuthFailed) > 5*time.Second {
+		o.lastAuthFailed = time.Now()
+		o.conn.Data.SendProfileEvent("auth_error")
 	}
+}
 
-	time.Sleep(500 * time.Millisecond)
+func (o *Ovpn) pushOutput(output string) {
+	output = strings.TrimSpace(output)
 
-	_, err = conn.Write([]byte(fmt.Sprintf("%s\n", cmd)))
+	err := log.ProfilePushLog(o.conn.Id, output)
 	if err != nil {
-		err = &errortypes.ReadError{
-			errors.Wrap(err, "profile: Failed to write socket command"),
-		}
-		return
+		logrus.WithFields(o.conn.Fields(logrus.Fields{
+			"output": output,
+			"error":  err,
+		})).Error("connection: Failed to push profile log output")
 	}
 
 	return
@@ -100,18 +100,7 @@ func GetWgQuickPath() string {
 		return filepath.Join(string(os.PathSeparator), "Applications",
 			"Pritunl.app", "Contents", "Resources", "wg-quick")
 	case "linux":
-		path := filepath.Join(string(os.PathSeparator),
-			"usr", "bin", "wg-quick")
-		exists, _ := utils.Exists(path)
-		if exists {
-			return path
-		}
-
-		path, _ = exec.LookPath("wg-quick")
-		if path != "" {
-			return path
-		}
-
+		// Linux uses the netlink backend without wg-quick
 		break
 	default:
 		panic("paths: WG quick path not implemented")
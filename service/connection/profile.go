@@ -31,14 +31,27 @@ type Profile struct {
 	DisableDns         bool                        `json:"disable_dns"`
 	RestrictClient     bool                        `json:"restrict_client"`
 	ForceDns           bool                        `json:"force_dns"`
+	Lockdown           bool                        `json:"lockdown"`
+	SplitInclude       []string                    `json:"split_include"`
+	SplitExclude       []string                    `json:"split_exclude"`
+	PreConnectHook     string                      `json:"pre_connect_hook"`
+	PostConnectHook    string                      `json:"post_connect_hook"`
+	PreDisconnectHook  string                      `json:"pre_disconnect_hook"`
+	PostDisconnectHook string                      `json:"post_disconnect_hook"`
+	HookTimeout        int                         `json:"hook_timeout"`
 	SsoAuth            bool                        `json:"sso_auth"`
 	ServerPublicKey    string                      `json:"server_public_key"`
 	ServerBoxPublicKey string                      `json:"server_box_public_key"`
+	ServerSpkiHash     []string                    `json:"server_spki_hash"`
+	HostSpkiHash       map[string]string           `json:"host_spki_hash"`
 	RegistrationKey    string                      `json:"registration_key"`
 	TokenTtl           int                         `json:"token_ttl"`
 	Reconnect          bool                        `json:"reconnect"`
+	ReconnectPolicy    *types.ReconnectPolicy      `json:"reconnect_policy"`
 	Timeout            bool                        `json:"timeout"`
 	SystemProfile      bool                        `json:"-"`
+	Owner              string                      `json:"-"`
+	OwnerGroup         string                      `json:"-"`
 }
 
 func (p *Profile) Fields() logrus.Fields {
@@ -50,8 +63,12 @@ func (p *Profile) Fields() logrus.Fields {
 		"profile_disable_gateway":  p.DisableGateway,
 		"profile_disable_dns":      p.DisableDns,
 		"profile_geo_sort":         p.IsGeoSort(),
+		"profile_latency_sort":     p.IsLatencySort(),
 		"profile_force_connect":    p.ForceConnect,
 		"profile_force_dns":        p.ForceDns,
+		"profile_lockdown":         p.Lockdown,
+		"profile_split_include":    p.SplitInclude,
+		"profile_split_exclude":    p.SplitExclude,
 		"profile_sso_auth":         p.SsoAuth,
 		"profile_reconnect":        p.Reconnect,
 		"profile_timeout":          p.Timeout,
@@ -60,7 +77,15 @@ func (p *Profile) Fields() logrus.Fields {
 }
 
 func (p *Profile) IsGeoSort() bool {
-	return p.GeoSort != ""
+	return p.GeoSort != "" && p.GeoSort != LatencySort
+}
+
+func (p *Profile) IsLatencySort() bool {
+	return p.GeoSort == LatencySort
+}
+
+func (p *Profile) IsWg() bool {
+	return p.Mode == WgMode || p.Mode == WgUserspaceMode
 }
 
 func (p *Profile) Sync() {
@@ -123,11 +148,24 @@ func (p *Profile) ImportSystemProfile(sprfl *sprofile.Sprofile) {
 	p.DisableDns = sprfl.DisableDns
 	p.RestrictClient = sprfl.RestrictClient
 	p.ForceDns = sprfl.ForceDns
+	p.Lockdown = sprfl.Lockdown
+	p.SplitInclude = sprfl.SplitInclude
+	p.SplitExclude = sprfl.SplitExclude
+	p.PreConnectHook = sprfl.PreConnectHook
+	p.PostConnectHook = sprfl.PostConnectHook
+	p.PreDisconnectHook = sprfl.PreDisconnectHook
+	p.PostDisconnectHook = sprfl.PostDisconnectHook
+	p.HookTimeout = sprfl.HookTimeout
 	p.SsoAuth = sprfl.SsoAuth
 	p.ServerPublicKey = serverPublicKey
 	p.ServerBoxPublicKey = sprfl.ServerBoxPublicKey
+	p.ServerSpkiHash = sprfl.ServerSpkiHash
+	p.HostSpkiHash = sprfl.HostSpkiHash
 	p.RegistrationKey = sprfl.RegistrationKey
 	p.TokenTtl = sprfl.TokenTtl
 	p.Reconnect = true
+	p.ReconnectPolicy = sprfl.ReconnectPolicy
 	p.SystemProfile = true
+	p.Owner = sprfl.Owner
+	p.OwnerGroup = sprfl.OwnerGroup
 }
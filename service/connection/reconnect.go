@@ -0,0 +1,382 @@
+package connection
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/sprofile"
+	"github.com/pritunl/pritunl-client-electron/service/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ReconnectDefault       = "default"
+	ReconnectKeepalive     = "keepalive"
+	ReconnectHandshake     = "handshake_timeout"
+	ReconnectOffline       = "offline"
+	ReconnectNetworkChange = "network_change"
+)
+
+var reconnectReasons = set.NewSet(
+	ReconnectDefault,
+	ReconnectKeepalive,
+	ReconnectHandshake,
+	ReconnectOffline,
+	ReconnectNetworkChange,
+)
+
+var defaultReconnectPolicy = &types.ReconnectPolicy{
+	Backoff:    3,
+	BackoffMax: 300,
+	Multiplier: 2,
+	Jitter:     0.2,
+	Rules: map[string]*types.ReconnectRule{
+		ReconnectOffline: {
+			Backoff:    30,
+			BackoffMax: 600,
+		},
+		ReconnectNetworkChange: {
+			Immediate: true,
+		},
+	},
+}
+
+type ReconnectStatus struct {
+	ReconnectAttempt int    `json:"reconnect_attempt"`
+	ReconnectNext    int64  `json:"reconnect_next"`
+	ReconnectReason  string `json:"reconnect_reason"`
+	start            time.Time
+	waiting          bool
+}
+
+type reconnectParams struct {
+	disabled    bool
+	immediate   bool
+	backoff     time.Duration
+	backoffMax  time.Duration
+	multiplier  float64
+	jitter      float64
+	maxAttempts int
+	window      time.Duration
+}
+
+// backoffDelay returns the wait before the numbered attempt, attempts
+// start at 1
+func (r *reconnectParams) backoffDelay(attempt int) (delay time.Duration) {
+	if r.immediate && attempt <= 1 {
+		return
+	}
+
+	base := float64(r.backoff) * math.Pow(r.multiplier, float64(attempt-1))
+	if base > float64(r.backoffMax) || math.IsInf(base, 0) {
+		base = float64(r.backoffMax)
+	}
+
+	if r.jitter > 0 {
+		base += base * r.jitter * (rand.Float64()*2 - 1)
+	}
+	if base < 0 {
+		base = 0
+	}
+
+	delay = time.Duration(base)
+	return
+}
+
+func getReconnectParams(policies []*types.ReconnectPolicy,
+	reason string) (params *reconnectParams) {
+
+	params = &reconnectParams{}
+
+	var rule *types.ReconnectRule
+	for _, policy := range policies {
+		if policy == nil {
+			continue
+		}
+
+		if policy.Backoff > 0 {
+			params.backoff = time.Duration(policy.Backoff) * time.Second
+		}
+		if policy.BackoffMax > 0 {
+			params.backoffMax = time.Duration(
+				policy.BackoffMax) * time.Second
+		}
+		if policy.Multiplier >= 1 {
+			params.multiplier = policy.Multiplier
+		}
+		if policy.Jitter > 0 && policy.Jitter <= 1 {
+			params.jitter = policy.Jitter
+		}
+		if policy.MaxAttempts > 0 {
+			params.maxAttempts = policy.MaxAttempts
+		}
+		if policy.Window > 0 {
+			params.window = time.Duration(policy.Window) * time.Second
+		}
+
+		if policy.Rules != nil && policy.Rules[reason] != nil {
+			rule = policy.Rules[reason]
+		}
+	}
+
+	if rule != nil {
+		params.disabled = rule.Disabled
+		params.immediate = rule.Immediate
+		if rule.Backoff > 0 {
+			params.backoff = time.Duration(rule.Backoff) * time.Second
+		}
+		if rule.BackoffMax > 0 {
+			params.backoffMax = time.Duration(rule.BackoffMax) * time.Second
+		}
+		if rule.MaxAttempts > 0 {
+			params.maxAttempts = rule.MaxAttempts
+		}
+	}
+
+	if params.backoffMax < params.backoff {
+		params.backoffMax = params.backoff
+	}
+
+	return
+}
+
+func ValidateReconnectPolicy(policy *types.ReconnectPolicy) (err error) {
+	if policy == nil {
+		return
+	}
+
+	if policy.Backoff < 0 || policy.BackoffMax < 0 ||
+		policy.MaxAttempts < 0 || policy.Window < 0 ||
+		policy.Multiplier < 0 || policy.Jitter < 0 || policy.Jitter > 1 {
+
+		err = &errortypes.ParseError{
+			errors.New("connection: Invalid reconnect policy"),
+		}
+		return
+	}
+
+	for reason, rule := range policy.Rules {
+		if !reconnectReasons.Contains(reason) {
+			err = &errortypes.ParseError{
+				errors.Newf("connection: Unknown reconnect reason '%s'",
+					reason),
+			}
+			return
+		}
+
+		if rule == nil {
+			continue
+		}
+
+		if rule.Backoff < 0 || rule.BackoffMax < 0 || rule.MaxAttempts < 0 {
+			err = &errortypes.ParseError{
+				errors.Newf("connection: Invalid reconnect rule '%s'",
+					reason),
+			}
+			return
+		}
+	}
+
+	return
+}
+
+func (p *Profile) reconnectParams(reason string) *reconnectParams {
+	return getReconnectParams([]*types.ReconnectPolicy{
+		defaultReconnectPolicy,
+		config.Config.ReconnectPolicy,
+		p.ReconnectPolicy,
+	}, reason)
+}
+
+func (s *State) SetReconnectReason(reason string) {
+	s.lock.Lock()
+	s.reconnectReason = reason
+	s.lock.Unlock()
+}
+
+func (s *State) ReconnectReason() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.reconnectReason == "" {
+		return ReconnectDefault
+	}
+	return s.reconnectReason
+}
+
+func (s *Store) nextReconnect(prflId, reason string,
+	params *reconnectParams) (rec *ReconnectStatus,
+	delay time.Duration, ok bool) {
+
+	s.reconnectsLock.Lock()
+	defer s.reconnectsLock.Unlock()
+
+	rec = s.reconnects[prflId]
+	if rec == nil {
+		rec = &ReconnectStatus{
+			start: time.Now(),
+		}
+	}
+
+	rec = &ReconnectStatus{
+		ReconnectAttempt: rec.ReconnectAttempt + 1,
+		ReconnectReason:  reason,
+		start:            rec.start,
+	}
+
+	if params.disabled ||
+		(params.maxAttempts > 0 &&
+			rec.ReconnectAttempt > params.maxAttempts) ||
+		(params.window > 0 && time.Since(rec.start) > params.window) {
+
+		delete(s.reconnects, prflId)
+		return
+	}
+
+	delay = params.backoffDelay(rec.ReconnectAttempt)
+	rec.ReconnectNext = time.Now().Add(delay).Unix()
+	rec.waiting = true
+	s.reconnects[prflId] = rec
+	ok = true
+
+	return
+}
+
+func (s *Store) isReconnect(prflId string, rec *ReconnectStatus) bool {
+	s.reconnectsLock.Lock()
+	defer s.reconnectsLock.Unlock()
+
+	return s.reconnects[prflId] == rec
+}
+
+func (s *Store) reconnectDone(prflId string, rec *ReconnectStatus) {
+	s.reconnectsLock.Lock()
+	defer s.reconnectsLock.Unlock()
+
+	if s.reconnects[prflId] == rec {
+		s.reconnects[prflId] = &ReconnectStatus{
+			ReconnectAttempt: rec.ReconnectAttempt,
+			ReconnectReason:  rec.ReconnectReason,
+			start:            rec.start,
+		}
+	}
+}
+
+func (s *Store) IsReconnectPending(prflId string) bool {
+	s.reconnectsLock.Lock()
+	defer s.reconnectsLock.Unlock()
+
+	rec := s.reconnects[prflId]
+	return rec != nil && rec.waiting
+}
+
+func (s *Store) ResetReconnect(prflId string) {
+	s.reconnectsLock.Lock()
+	defer s.reconnectsLock.Unlock()
+
+	delete(s.reconnects, prflId)
+}
+
+func (c *Connection) reconnectWait(rec *ReconnectStatus,
+	delay time.Duration) bool {
+
+	end := time.Now().Add(delay)
+
+	for {
+		if Shutdown || c.State.IsStopFast() ||
+			!GlobalStore.isReconnect(c.Id, rec) {
+
+			return false
+		}
+
+		conn := GlobalStore.Get(c.Id)
+		if conn != nil && conn != c {
+			return false
+		}
+
+		remaining := time.Until(end)
+		if remaining <= 0 {
+			return true
+		}
+		if remaining > 500*time.Millisecond {
+			remaining = 500 * time.Millisecond
+		}
+
+		time.Sleep(remaining)
+	}
+}
+
+// clearReconnectLockdown removes the lockdown rules kept for a reconnect
+// that will not happen, rules owned by a newer connection are kept
+func (c *Connection) clearReconnectLockdown() {
+	conn := GlobalStore.Get(c.Id)
+	if conn != nil && conn != c {
+		return
+	}
+
+	c.clearLockdown()
+}
+
+// Reconnect restarts the connection once the reconnect policy for the
+// reason allows it, the profile is stopped if attempts are exhausted
+func (c *Connection) Reconnect(reason string) {
+	params := c.Profile.reconnectParams(reason)
+
+	rec, delay, ok := GlobalStore.nextReconnect(c.Id, reason, params)
+	if !ok {
+		if params.disabled {
+			logrus.WithFields(c.Fields(logrus.Fields{
+				"reason": reason,
+			})).Info("connection: Reconnect disabled for reason")
+		} else {
+			logrus.WithFields(c.Fields(logrus.Fields{
+				"reason":       reason,
+				"max_attempts": params.maxAttempts,
+				"window":       params.window.String(),
+			})).Error("connection: Reconnect attempts exhausted")
+		}
+
+		if c.Data.GetStatus() == Connected {
+			return
+		}
+
+		if !params.disabled {
+			c.Data.SendProfileEvent("reconnect_exhausted")
+		}
+
+		if c.Profile.SystemProfile {
+			sprofile.Deactivate(c.Id)
+		}
+
+		c.clearReconnectLockdown()
+		c.Data.UpdateEvent()
+		return
+	}
+
+	logrus.WithFields(c.Fields(logrus.Fields{
+		"reason":  reason,
+		"attempt": rec.ReconnectAttempt,
+		"delay":   delay.String(),
+	})).Info("connection: Scheduling reconnect")
+
+	c.Data.UpdateEvent()
+
+	if !c.reconnectWait(rec, delay) {
+		logrus.WithFields(c.Fields(logrus.Fields{
+			"reason":  reason,
+			"attempt": rec.ReconnectAttempt,
+		})).Info("connection: Scheduled reconnect cancelled")
+		GlobalStore.reconnectDone(c.Id, rec)
+		c.clearReconnectLockdown()
+		return
+	}
+
+	GlobalStore.reconnectDone(c.Id, rec)
+
+	c.Restart()
+}
@@ -0,0 +1,154 @@
+package connection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pritunl/pritunl-client-electron/service/types"
+)
+
+func TestReconnectParams(t *testing.T) {
+	params := getReconnectParams([]*types.ReconnectPolicy{
+		defaultReconnectPolicy,
+		{
+			MaxAttempts: 5,
+			Rules: map[string]*types.ReconnectRule{
+				ReconnectKeepalive: {
+					Backoff: 10,
+				},
+			},
+		},
+	}, ReconnectKeepalive)
+
+	if params.backoff != 10*time.Second ||
+		params.backoffMax != 300*time.Second ||
+		params.multiplier != 2 || params.maxAttempts != 5 {
+
+		t.Fatalf("connection: Unexpected reconnect params %#v", params)
+	}
+
+	params = getReconnectParams([]*types.ReconnectPolicy{
+		defaultReconnectPolicy,
+	}, ReconnectOffline)
+	if params.backoff != 30*time.Second ||
+		params.backoffMax != 600*time.Second {
+
+		t.Fatalf("connection: Unexpected offline params %#v", params)
+	}
+
+	params = getReconnectParams([]*types.ReconnectPolicy{
+		defaultReconnectPolicy,
+	}, ReconnectNetworkChange)
+	if !params.immediate || params.backoffDelay(1) != 0 {
+		t.Fatal("connection: Expected immediate network change reconnect")
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	params := &reconnectParams{
+		backoff:    2 * time.Second,
+		backoffMax: 20 * time.Second,
+		multiplier: 2,
+	}
+
+	expected := []time.Duration{
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		16 * time.Second,
+		20 * time.Second,
+		20 * time.Second,
+	}
+	for i, delay := range expected {
+		if params.backoffDelay(i+1) != delay {
+			t.Errorf("connection: Unexpected delay %s for attempt %d",
+				params.backoffDelay(i+1), i+1)
+		}
+	}
+
+	params.jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := params.backoffDelay(3)
+		if delay < 4*time.Second || delay > 12*time.Second {
+			t.Fatalf("connection: Jitter delay out of range %s", delay)
+		}
+	}
+}
+
+func TestReconnectAttempts(t *testing.T) {
+	store := &Store{
+		reconnects: map[string]*ReconnectStatus{},
+	}
+	params := &reconnectParams{
+		backoff:     time.Second,
+		backoffMax:  time.Second,
+		multiplier:  1,
+		maxAttempts: 2,
+	}
+
+	for i := 1; i <= 2; i++ {
+		rec, _, ok := store.nextReconnect("prfl", ReconnectKeepalive, params)
+		if !ok || rec.ReconnectAttempt != i {
+			t.Fatalf("connection: Unexpected reconnect attempt %d", i)
+		}
+		if !store.IsReconnectPending("prfl") {
+			t.Fatal("connection: Expected pending reconnect")
+		}
+
+		store.reconnectDone("prfl", rec)
+		if store.IsReconnectPending("prfl") {
+			t.Fatal("connection: Unexpected pending reconnect")
+		}
+	}
+
+	_, _, ok := store.nextReconnect("prfl", ReconnectKeepalive, params)
+	if ok {
+		t.Fatal("connection: Expected reconnect attempts exhausted")
+	}
+
+	rec, _, ok := store.nextReconnect("prfl", ReconnectKeepalive, params)
+	if !ok || rec.ReconnectAttempt != 1 {
+		t.Fatal("connection: Expected reconnect attempts reset")
+	}
+
+	store.ResetReconnect("prfl")
+	if store.isReconnect("prfl", rec) {
+		t.Fatal("connection: Expected reconnect cleared")
+	}
+
+	params.disabled = true
+	_, _, ok = store.nextReconnect("prfl", ReconnectKeepalive, params)
+	if ok {
+		t.Fatal("connection: Expected disabled reconnect")
+	}
+}
+
+func TestValidateReconnectPolicy(t *testing.T) {
+	err := ValidateReconnectPolicy(&types.ReconnectPolicy{
+		Backoff: 5,
+		Rules: map[string]*types.ReconnectRule{
+			ReconnectOffline: {
+				Disabled: true,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ValidateReconnectPolicy(&types.ReconnectPolicy{
+		Rules: map[string]*types.ReconnectRule{
+			"unknown": {},
+		},
+	})
+	if err == nil {
+		t.Fatal("connection: Expected unknown reason error")
+	}
+
+	err = ValidateReconnectPolicy(&types.ReconnectPolicy{
+		Jitter: 2,
+	})
+	if err == nil {
+		t.Fatal("connection: Expected invalid jitter error")
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/dropbox/godropbox/errors"
 	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/latency"
 	"github.com/pritunl/pritunl-client-electron/service/parser"
 	"github.com/sirupsen/logrus"
 )
@@ -19,10 +22,28 @@ type Remote struct {
 	OvpnPort  int
 	OvpnProto string
 	Type      string
+	lock      sync.RWMutex
 }
 
 type Remotes []*Remote
 
+var (
+	wgPorts     = map[string]int{}
+	wgPortsLock = sync.Mutex{}
+)
+
+func setWgPort(host string, port int) {
+	wgPortsLock.Lock()
+	wgPorts[host] = port
+	wgPortsLock.Unlock()
+}
+
+func getWgPort(host string) int {
+	wgPortsLock.Lock()
+	defer wgPortsLock.Unlock()
+	return wgPorts[host]
+}
+
 func (r Remotes) GetHosts() (hosts []string) {
 	hosts = []string{}
 
@@ -37,11 +58,12 @@ func (r Remotes) GetAddrs() (addrs []string) {
 	addrs = []string{}
 
 	for _, remote := range r {
-		if remote.Addr4 != "" {
-			addrs = append(addrs, remote.Addr4)
+		addr4, addr6 := remote.GetAddrs()
+		if addr4 != "" {
+			addrs = append(addrs, addr4)
 		}
-		if remote.Addr6 != "" {
-			addrs = append(addrs, remote.Addr6)
+		if addr6 != "" {
+			addrs = append(addrs, addr6)
 		}
 	}
 
@@ -63,14 +85,15 @@ func (r Remotes) GetAddrMap() (addrMap map[string]*Remote, other []*Remote) {
 	other = []*Remote{}
 
 	for _, remote := range r {
-		if remote.Addr4 != "" {
-			addrMap[remote.Addr4] = remote
+		addr4, addr6 := remote.GetAddrs()
+		if addr4 != "" {
+			addrMap[addr4] = remote
 		}
-		if remote.Addr6 != "" {
-			addrMap[remote.Addr6] = remote
+		if addr6 != "" {
+			addrMap[addr6] = remote
 		}
 
-		if remote.Addr4 == "" && remote.Addr6 == "" {
+		if addr4 == "" && addr6 == "" {
 			other = append(other, remote)
 		}
 	}
@@ -88,49 +111,194 @@ func (r Remotes) GetParser() (remotes parser.Remotes) {
 	return
 }
 
-func (r *Remote) Lookup() {
-	ip := net.ParseIP(r.Host)
+// Refresh resolves the remotes concurrently, remotes that fail to resolve
+// keep the previous addresses
+func (r Remotes) Refresh() {
+	waiter := sync.WaitGroup{}
+
+	for _, remote := range r {
+		waiter.Add(1)
+		go func(remote *Remote) {
+			defer waiter.Done()
+			remote.Refresh()
+		}(remote)
+	}
+
+	waiter.Wait()
+}
+
+func (r Remotes) Lookup() {
+	waiter := sync.WaitGroup{}
+
+	for _, remote := range r {
+		waiter.Add(1)
+		go func(remote *Remote) {
+			defer waiter.Done()
+			remote.Lookup()
+		}(remote)
+	}
+
+	waiter.Wait()
+}
+
+// SortLatency orders the remotes by latency to the port that will be
+// used to connect, ovpn remotes are probed on the ovpn port and protocol
+// when wg is false and all others on the web port. For WireGuard the
+// remote is also offline if the last known WireGuard port is closed.
+func (r Remotes) SortLatency(wg bool) (remotes Remotes) {
+	network := latency.Network()
+	targets := []*latency.Target{}
+	targetRemotes := map[*latency.Target]*Remote{}
+
+	r.Lookup()
+
+	for _, remote := range r {
+		host, port := remote.GetWebHostPort()
+		proto := latency.TcpProbe
+		checkUdpPort := 0
+
+		if !wg && remote.Type == OvpnRemote && remote.OvpnPort != 0 {
+			port = remote.OvpnPort
+			if strings.HasPrefix(remote.OvpnProto, "udp") {
+				proto = latency.UdpProbe
+			}
+		} else if wg {
+			checkUdpPort = getWgPort(remote.Host)
+		}
+
+		addrs := []string{}
+		addr4, addr6 := remote.GetAddrs()
+		if addr4 != "" {
+			addrs = append(addrs, addr4)
+		}
+		if addr6 != "" {
+			addrs = append(addrs, addr6)
+		}
+		if len(addrs) == 0 {
+			addrs = append(addrs, host)
+		}
+
+		target := &latency.Target{
+			Addrs:        addrs,
+			Port:         port,
+			Proto:        proto,
+			CheckUdpPort: checkUdpPort,
+		}
+		targets = append(targets, target)
+		targetRemotes[target] = remote
+	}
+
+	latency.Sort(network, targets)
+
+	remotes = Remotes{}
+	for _, target := range targets {
+		remote := targetRemotes[target]
+		remotes = append(remotes, remote)
+
+		logrus.WithFields(logrus.Fields{
+			"remote":   remote.GetFormatted(),
+			"network":  network,
+			"port":     target.Port,
+			"protocol": target.Proto,
+			"method":   target.Method,
+			"latency":  target.Latency.String(),
+			"online":   target.Ok,
+		}).Info("connection: Measured remote latency")
+	}
+
+	return
+}
+
+func (r *Remote) GetAddrs() (addr4, addr6 string) {
+	r.lock.RLock()
+	addr4 = r.Addr4
+	addr6 = r.Addr6
+	r.lock.RUnlock()
+	return
+}
+
+func (r *Remote) setAddrs(addr4, addr6 string) {
+	r.lock.Lock()
+	r.Addr4 = addr4
+	r.Addr6 = addr6
+	r.lock.Unlock()
+}
+
+func resolveRemote(host string) (addr4, addr6 string) {
+	ip := net.ParseIP(host)
 	if ip != nil {
-		ipStr := ip.String()
 		if ip.To4() == nil {
-			r.Addr6 = ipStr
+			addr6 = ip.String()
 		} else {
-			r.Addr4 = ipStr
+			addr4 = ip.String()
+		}
+		return
+	}
+
+	remoteIps, err := net.LookupIP(host)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "remotes: Failed to resolve remote"),
 		}
-	} else {
-		remoteIps, err := net.LookupIP(r.Host)
-		if err != nil {
-			err = &errortypes.RequestError{
-				errors.Wrap(err, "remotes: Failed to resolve remote"),
-			}
 
-			logrus.WithFields(logrus.Fields{
-				"host":  r.Host,
-				"error": err,
-			}).Info("profile: Failed to resolve remote")
-			return
-		}
-
-		for _, remoteIp := range remoteIps {
-			remoteIpStr := remoteIp.String()
-			if remoteIp.To4() == nil {
-				if r.Addr6 == "" {
-					r.Addr6 = remoteIpStr
-				} else {
-					// TODO Handle multiple
-				}
+		logrus.WithFields(logrus.Fields{
+			"host":  host,
+			"error": err,
+		}).Info("profile: Failed to resolve remote")
+		return
+	}
+
+	for _, remoteIp := range remoteIps {
+		remoteIpStr := remoteIp.String()
+		if remoteIp.To4() == nil {
+			if addr6 == "" {
+				addr6 = remoteIpStr
+			} else {
+				// TODO Handle multiple
+			}
+		} else {
+			if addr4 == "" {
+				addr4 = remoteIpStr
 			} else {
-				if r.Addr4 == "" {
-					r.Addr4 = remoteIpStr
-				} else {
-					// TODO Handle multiple
-				}
+				// TODO Handle multiple
 			}
 		}
 	}
+
+	return
+}
+
+func (r *Remote) Lookup() {
+	addr4, addr6 := resolveRemote(r.Host)
+
+	r.lock.Lock()
+	if r.Addr4 == "" {
+		r.Addr4 = addr4
+	}
+	if r.Addr6 == "" {
+		r.Addr6 = addr6
+	}
+	r.lock.Unlock()
+}
+
+// Refresh resolves the remote without holding the lock and replaces both
+// addresses together, a failed lookup keeps the previous addresses
+func (r *Remote) Refresh() {
+	if net.ParseIP(r.Host) != nil {
+		return
+	}
+
+	addr4, addr6 := resolveRemote(r.Host)
+	if addr4 == "" && addr6 == "" {
+		return
+	}
+
+	r.setAddrs(addr4, addr6)
 }
 
 func (r *Remote) Equal(addr string) bool {
+	addr4, addr6 := r.GetAddrs()
+
 	if strings.Contains(addr, ":") {
 		var hostIp6 net.IP
 		if strings.Contains(r.Host, ":") {
@@ -138,8 +306,8 @@ func (r *Remote) Equal(addr string) bool {
 		}
 
 		var addrIp6 net.IP
-		if strings.Contains(r.Addr6, ":") {
-			addrIp6 = net.ParseIP(r.Addr6)
+		if strings.Contains(addr6, ":") {
+			addrIp6 = net.ParseIP(addr6)
 		}
 
 		ip6 := net.ParseIP(addr)
@@ -150,13 +318,32 @@ func (r *Remote) Equal(addr string) bool {
 		}
 	}
 
-	if addr == r.Host || addr == r.Addr4 || addr == r.Addr6 {
+	if addr == r.Host || addr == addr4 || addr == addr6 {
 		return true
 	}
 
 	return false
 }
 
+// GetWebHostPort returns the host and port used for web requests to the
+// remote, the port defaults to 443 when the host does not include one
+func (r *Remote) GetWebHostPort() (host string, port int) {
+	host = r.Host
+	port = 443
+
+	hostSpl, portSpl, err := net.SplitHostPort(r.Host)
+	if err == nil {
+		host = hostSpl
+		portInt, e := strconv.Atoi(portSpl)
+		if e == nil {
+			port = portInt
+		}
+	}
+	host = strings.Trim(host, "[]")
+
+	return
+}
+
 func (r *Remote) GetUrl(path string) *url.URL {
 	remote := r.Host
 
@@ -173,15 +360,16 @@ func (r *Remote) GetUrl(path string) *url.URL {
 
 func (r *Remote) GetFormatted() (host string) {
 	host = r.Host
+	addr4, addr6 := r.GetAddrs()
 
 	if r.Type == SyncRemote {
 		host += "*"
 	}
-	if r.Addr4 != "" {
-		host += fmt.Sprintf("[%s]", r.Addr4)
+	if addr4 != "" {
+		host += fmt.Sprintf("[%s]", addr4)
 	}
-	if r.Addr6 != "" {
-		host += fmt.Sprintf("[%s]", r.Addr6)
+	if addr6 != "" {
+		host += fmt.Sprintf("[%s]", addr6)
 	}
 
 	return
@@ -189,23 +377,24 @@ func (r *Remote) GetFormatted() (host string) {
 
 func (r *Remote) GetParser() (remotes parser.Remotes) {
 	remotes = parser.Remotes{}
+	addr4, addr6 := r.GetAddrs()
 
-	if r.Addr4 != "" {
+	if addr4 != "" {
 		remotes = append(remotes, parser.Remote{
-			Host:  r.Addr4,
+			Host:  addr4,
 			Port:  r.OvpnPort,
 			Proto: r.OvpnProto,
 		})
 	}
-	if r.Addr6 != "" {
+	if addr6 != "" {
 		remotes = append(remotes, parser.Remote{
-			Host:  r.Addr6,
+			Host:  addr6,
 			Port:  r.OvpnPort,
 			Proto: r.OvpnProto,
 		})
 	}
 
-	if r.Addr4 == "" && r.Addr6 == "" && r.Host != "" {
+	if addr4 == "" && addr6 == "" && r.Host != "" {
 		remotes = append(remotes, parser.Remote{
 			Host:  r.Host,
 			Port:  r.OvpnPort,
@@ -0,0 +1,44 @@
+package connection
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRemoteRefresh(t *testing.T) {
+	remote := &Remote{
+		Host:  "localhost",
+		Addr4: "192.0.2.1",
+	}
+	remotes := Remotes{remote}
+
+	waiter := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		waiter.Add(2)
+		go func() {
+			defer waiter.Done()
+			remotes.Refresh()
+		}()
+		go func() {
+			defer waiter.Done()
+			_ = remotes.GetFormatted()
+			_ = remote.Equal("127.0.0.1")
+		}()
+	}
+	waiter.Wait()
+
+	addr4, addr6 := remote.GetAddrs()
+	if addr4 != "127.0.0.1" && addr6 != "::1" {
+		t.Fatalf("connection: Unexpected refreshed addresses %s %s",
+			addr4, addr6)
+	}
+
+	ipRemote := &Remote{
+		Host:  "192.0.2.10",
+		Addr4: "192.0.2.10",
+	}
+	ipRemote.Refresh()
+	if addr4, _ := ipRemote.GetAddrs(); addr4 != "192.0.2.10" {
+		t.Fatalf("connection: Unexpected ip remote address %s", addr4)
+	}
+}
@@ -0,0 +1,54 @@
+package connection
+
+import (
+	"github.com/pritunl/pritunl-client-electron/service/splittun"
+	"github.com/sirupsen/logrus"
+)
+
+func (c *Connection) updateSplitTunnel() {
+	if len(c.Profile.SplitInclude) == 0 &&
+		len(c.Profile.SplitExclude) == 0 {
+
+		c.clearSplitTunnel()
+		return
+	}
+
+	if c.Data.Iface == "" {
+		return
+	}
+
+	err := splittun.Set(c.Id, &splittun.Config{
+		Iface:      c.Data.Iface,
+		Include:    c.Profile.SplitInclude,
+		Exclude:    c.Profile.SplitExclude,
+		DnsServers: c.Data.DnsServers,
+		Owner:      c.Profile.Owner,
+	})
+	if err != nil {
+		logrus.WithFields(c.Fields(logrus.Fields{
+			"error": err,
+		})).Error("connection: Failed to apply split tunnel rules")
+	}
+}
+
+func (c *Connection) clearSplitTunnel() {
+	if !splittun.IsActive(c.Id) {
+		return
+	}
+
+	err := splittun.Remove(c.Id)
+	if err != nil {
+		logrus.WithFields(c.Fields(logrus.Fields{
+			"error": err,
+		})).Error("connection: Failed to remove split tunnel rules")
+	}
+}
+
+func (c *Connection) SetSplitTunnel(include, exclude []string) {
+	c.Profile.SplitInclude = include
+	c.Profile.SplitExclude = exclude
+
+	if c.Data.GetStatus() == Connected {
+		c.updateSplitTunnel()
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pritunl/pritunl-client-electron/service/sprofile"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -13,6 +14,7 @@ type State struct {
 	conn               *Connection
 	startTime          time.Time
 	id                 string
+	lock               sync.Mutex
 	stop               bool
 	lastStopCheckStack string
 	lastStopCheckTime  time.Time
@@ -20,25 +22,40 @@ type State struct {
 	delay              bool
 	interactive        bool
 	noReconnect        bool
+	reconnectReason    string
 	closed             bool
 	systemInteractive  bool
 	closeWaiters       []chan bool
 	closeWaitersLock   sync.Mutex
 	tempPaths          []string
+	session            *sprofile.Session
+	sessionLock        sync.Mutex
 }
 
 func (s *State) Fields() logrus.Fields {
+	s.lock.Lock()
+	stop := s.stop
+	noReconnect := s.noReconnect
+	reconnectReason := s.reconnectReason
+	s.lock.Unlock()
+
+	s.closeWaitersLock.Lock()
+	closed := s.closed
+	closeWaiters := len(s.closeWaiters)
+	s.closeWaitersLock.Unlock()
+
 	return logrus.Fields{
 		"state_id":                 s.id,
 		"state_time":               s.startTime,
-		"state_stop":               s.stop,
+		"state_stop":               stop,
 		"state_deadline":           s.deadline,
 		"state_delay":              s.delay,
-		"state_no_reconnect":       s.noReconnect,
+		"state_no_reconnect":       noReconnect,
+		"state_reconnect_reason":   reconnectReason,
 		"state_interactive":        s.interactive,
 		"state_system_interactive": s.systemInteractive,
-		"state_closed":             s.closed,
-		"state_closed_waiters":     len(s.closeWaiters),
+		"state_closed":             closed,
+		"state_closed_waiters":     closeWaiters,
 		"state_temp_paths":         s.tempPaths,
 	}
 }
@@ -55,6 +72,8 @@ func (s *State) Init(opts Options) (err error) {
 	s.startTime = time.Now()
 	s.tempPaths = []string{}
 
+	s.initSession()
+
 	go s.stopWatch()
 
 	return
@@ -70,7 +89,11 @@ func (s *State) IsReconnect() bool {
 	if GlobalStore.IsStop(s.conn.Id) {
 		return false
 	}
-	return !s.noReconnect && s.conn.Profile.Reconnect
+	s.lock.Lock()
+	noReconnect := s.noReconnect
+	s.lock.Unlock()
+
+	return !noReconnect && s.conn.Profile.Reconnect
 }
 
 func (s *State) IsInteractive() bool {
@@ -78,29 +101,50 @@ func (s *State) IsInteractive() bool {
 }
 
 func (s *State) NoReconnect(reason string) {
+	s.lock.Lock()
 	if s.noReconnect {
+		s.lock.Unlock()
 		return
 	}
+	s.lock.Unlock()
+
 	logrus.WithFields(s.conn.Fields(logrus.Fields{
 		"reason": reason,
 	})).Info("connection: Stopping reconnect")
+
+	s.lock.Lock()
 	s.noReconnect = true
+	s.lock.Unlock()
+
+	s.setSessionReason(reason)
 }
 
 func (s *State) stopWatch() {
 	for {
 		time.Sleep(1 * time.Second)
-		if s.closed {
+
+		s.closeWaitersLock.Lock()
+		closed := s.closed
+		s.closeWaitersLock.Unlock()
+		if closed {
 			return
 		}
 
-		if time.Since(s.lastStopCheckTime) > 3*time.Minute {
+		s.lock.Lock()
+		lastStopCheckTime := s.lastStopCheckTime
+		lastStopCheckStack := s.lastStopCheckStack
+		s.lock.Unlock()
+
+		if time.Since(lastStopCheckTime) > 3*time.Minute {
 			logrus.WithFields(s.conn.Fields(logrus.Fields{
-				"last_stop_check": s.lastStopCheckTime.Format(
+				"last_stop_check": lastStopCheckTime.Format(
 					"2006-01-02 15:04:05"),
-				"trace": s.lastStopCheckStack,
+				"trace": lastStopCheckStack,
 			})).Info("state: Detected dead state")
+
+			s.lock.Lock()
 			s.lastStopCheckTime = time.Now()
+			s.lock.Unlock()
 		}
 	}
 }
@@ -111,23 +155,32 @@ func (s *State) SetStop() {
 	// 		"state: Profile already in stop")
 	// 	return
 	// }
+	s.lock.Lock()
 	s.stop = true
+	s.lock.Unlock()
 }
 
 func (s *State) IsStop() bool {
 	trace := utils.GetStackTrace()
 
+	s.lock.Lock()
 	s.lastStopCheckTime = time.Now()
 	s.lastStopCheckStack = trace
+	stop := s.stop
+	s.lock.Unlock()
 
-	if Shutdown || s.stop {
+	if Shutdown || stop {
 		return true
 	}
 	return false
 }
 
 func (s *State) IsStopFast() bool {
-	if Shutdown || s.stop {
+	s.lock.Lock()
+	stop := s.stop
+	s.lock.Unlock()
+
+	if Shutdown || stop {
 		return true
 	}
 	return false
@@ -148,7 +201,7 @@ func (s *State) SetConnecting() {
 		"reconnect":        s.conn.Profile.Reconnect,
 	}).Info("profile: Connecting")
 
-	s.conn.Data.Status = Connecting
+	s.conn.Data.SetStatus(Connecting)
 
 	return
 }
@@ -193,6 +246,9 @@ func (s *State) Close() {
 		return
 	}
 	s.closed = true
+	closeWaiters := s.closeWaiters
+	s.closeWaiters = nil
+	s.closeWaitersLock.Unlock()
 
 	if LogClose {
 		logrus.WithFields(s.conn.Fields(logrus.Fields{
@@ -202,14 +258,11 @@ func (s *State) Close() {
 
 	GlobalStore.Remove(s.conn.Id, s.conn)
 
-	if s.closeWaiters != nil {
-		for _, waiter := range s.closeWaiters {
-			waiter <- true
-		}
-	}
-	s.closeWaiters = nil
+	s.commitSession()
 
-	s.closeWaitersLock.Unlock()
+	for _, waiter := range closeWaiters {
+		waiter <- true
+	}
 
 	s.conn.Client.Disconnected()
 }
@@ -15,6 +15,7 @@ var GlobalStore = &Store{
 	conns:      map[string]*Connection{},
 	conditions: map[string]*Condition{},
 	stops:      map[string]time.Time{},
+	reconnects: map[string]*ReconnectStatus{},
 }
 
 type Condition struct {
@@ -25,6 +26,7 @@ type StoreData struct {
 	Id string `json:"id"`
 	*Data
 	*Condition
+	*ReconnectStatus
 }
 
 type Store struct {
@@ -32,9 +34,11 @@ type Store struct {
 	lock           sync.RWMutex
 	conditionsLock sync.Mutex
 	stopsLock      sync.Mutex
+	reconnectsLock sync.Mutex
 	conns          map[string]*Connection
 	conditions     map[string]*Condition
 	stops          map[string]time.Time
+	reconnects     map[string]*ReconnectStatus
 }
 
 func (s *Store) cleanState() {
@@ -82,7 +86,7 @@ func (s *Store) IsConnected() bool {
 	defer s.lock.RUnlock()
 
 	for _, conn := range s.conns {
-		if conn.Data.Status == Connected {
+		if conn.Data.GetStatus() == Connected {
 			return true
 		}
 	}
@@ -97,6 +101,8 @@ func (s *Store) SetStop(prflId string) {
 	defer s.stopsLock.Unlock()
 
 	s.stops[prflId] = time.Now()
+
+	s.ResetReconnect(prflId)
 }
 
 func (s *Store) IsStop(prflId string) bool {
@@ -264,6 +270,21 @@ func (s *Store) GetAllData() (prfls map[string]*StoreData) {
 		}
 	}
 
+	s.reconnectsLock.Lock()
+	defer s.reconnectsLock.Unlock()
+	for prflId, rec := range s.reconnects {
+		recCopy := *rec
+		data := prfls[prflId]
+		if data != nil {
+			data.ReconnectStatus = &recCopy
+		} else {
+			prfls[prflId] = &StoreData{
+				Id:              prflId,
+				ReconnectStatus: &recCopy,
+			}
+		}
+	}
+
 	return
 }
 
@@ -48,6 +48,10 @@ func SyncSystemProfiles() (err error) {
 
 		if sPrfl.State {
 			if conn == nil {
+				if GlobalStore.IsReconnectPending(sPrfl.Id) {
+					continue
+				}
+
 				conn, err = ImportSystemProfile(sPrfl)
 				if err != nil {
 					return
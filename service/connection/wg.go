@@ -16,15 +16,20 @@ import (
 
 	"github.com/dropbox/godropbox/errors"
 	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/dnsproxy"
 	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/metrics"
 	"github.com/pritunl/pritunl-client-electron/service/network"
 	"github.com/pritunl/pritunl-client-electron/service/platform"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/pritunl/pritunl-client-electron/service/wireguard"
 	"github.com/sirupsen/logrus"
 )
 
 var (
 	lastRetryLogged = time.Time{}
+	wgSetPeer       = wireguard.SetPeer
+	wgGetPeer       = wireguard.GetPeer
 )
 
 type Wg struct {
@@ -36,13 +41,17 @@ type Wg struct {
 	wgConfPath    string
 	wgConfPath2   string
 	connected     bool
+	statsLock     sync.Mutex
 	lastHandshake int
+	pingLatency   time.Duration
 	bashPath      string
 	publicKey     string
 	privateKey    string
 	serverPubKey  string
+	serverConf    *WgConf
 	ssoToken      string
 	ssoStart      time.Time
+	userspace     bool
 }
 
 type WgConf struct {
@@ -74,18 +83,39 @@ func (w *Wg) Fields() logrus.Fields {
 		"wg_conf_path":      w.wgConfPath,
 		"wg_conf_path2":     w.wgConfPath2,
 		"wg_connected":      w.connected,
-		"wg_last_handshake": w.lastHandshake,
+		"wg_last_handshake": w.getLastHandshake(),
 		"wg_pub_key":        w.publicKey != "",
 		"wg_priv_key":       w.privateKey != "",
 		"wg_server_pub_key": w.serverPubKey != "",
 		"wg_sso_token":      w.ssoToken != "",
 		"wg_sso_start":      w.ssoStart,
+		"wg_userspace":      w.userspace,
 	}
 }
 
+func (w *Wg) getLastHandshake() int {
+	w.statsLock.Lock()
+	defer w.statsLock.Unlock()
+	return w.lastHandshake
+}
+
+func (w *Wg) setLastHandshake(lastHandshake int) {
+	w.statsLock.Lock()
+	w.lastHandshake = lastHandshake
+	w.statsLock.Unlock()
+}
+
+func (w *Wg) getPingLatency() time.Duration {
+	w.statsLock.Lock()
+	defer w.statsLock.Unlock()
+	return w.pingLatency
+}
+
 func (w *Wg) Init() {
 	w.wgPath = GetWgPath()
-	w.wgQuickPath = GetWgQuickPath()
+	if runtime.GOOS != "linux" {
+		w.wgQuickPath = GetWgQuickPath()
+	}
 	w.wgUtilPath = GetWgUtilPath()
 	w.bashPath = GetBashPath()
 }
@@ -99,6 +129,15 @@ func (w *Wg) GetReqPrefix() string {
 }
 
 func (w *Wg) generateKey() (err error) {
+	if runtime.GOOS == "linux" {
+		w.privateKey, w.publicKey, err = wireguard.GenerateKey()
+		if err != nil {
+			return
+		}
+
+		return
+	}
+
 	privateKey, err := utils.ExecOutput(w.wgPath, "genkey")
 	if err != nil {
 		err = &errortypes.ExecError{
@@ -122,6 +161,8 @@ func (w *Wg) generateKey() (err error) {
 }
 
 func (w *Wg) Start() (err error) {
+	w.userspace = w.conn.Profile.Mode == WgUserspaceMode
+
 	err = w.conn.Client.Start(w)
 	if err != nil {
 		return
@@ -131,6 +172,13 @@ func (w *Wg) Start() (err error) {
 }
 
 func (w *Wg) PreConnect() (err error) {
+	if w.userspace && runtime.GOOS != "linux" {
+		err = &errortypes.ExecError{
+			errors.New("wg: Userspace mode not supported on this platform"),
+		}
+		return
+	}
+
 	err = w.generateKey()
 	if err != nil {
 		return
@@ -150,20 +198,6 @@ func (w *Wg) Connect(data *ConnData) (err error) {
 		return
 	}
 
-	iface := network.InterfaceAcquire()
-	if iface == "" {
-		err = &errortypes.ReadError{
-			errors.New("profile: Failed to acquire interface"),
-		}
-		return
-	}
-	w.conn.Data.Iface = iface
-
-	if w.conn.State.IsStop() {
-		w.conn.State.Close()
-		return
-	}
-
 	if w.conn.Profile.DisableGateway {
 		routes := []*Route{}
 		for _, route := range data.Configuration.Routes {
@@ -184,8 +218,29 @@ func (w *Wg) Connect(data *ConnData) (err error) {
 		data.Configuration.Routes6 = routes6
 	}
 
-	err = w.writeWgConf(data.Configuration)
+	if !w.conn.resolveConflicts(data.Configuration.Routes,
+		data.Configuration.Routes6, data.Configuration.DnsServers,
+		data.Configuration.SearchDomains) {
+
+		w.conn.State.SetStop()
+		err = &errortypes.RequestError{
+			errors.New("profile: Connection rejected by network conflict"),
+		}
+		return
+	}
+
+	iface := network.InterfaceAcquire()
+	if iface == "" {
+		err = &errortypes.ReadError{
+			errors.New("profile: Failed to acquire interface"),
+		}
+		return
+	}
+	w.conn.Data.Iface = iface
+	err = w.conn.updateLockdown()
 	if err != nil {
+		w.conn.State.SetStop()
+		w.conn.State.Close()
 		return
 	}
 
@@ -194,6 +249,18 @@ func (w *Wg) Connect(data *ConnData) (err error) {
 		return
 	}
 
+	if runtime.GOOS != "linux" {
+		err = w.writeWgConf(data.Configuration)
+		if err != nil {
+			return
+		}
+	}
+
+	if w.conn.State.IsStop() {
+		w.conn.State.Close()
+		return
+	}
+
 	err = w.confWg(data.Configuration)
 	if err != nil {
 		w.conn.Data.SendProfileEvent("configuration_error")
@@ -206,6 +273,9 @@ func (w *Wg) Connect(data *ConnData) (err error) {
 		return
 	}
 
+	w.conn.updateSplitTunnel()
+	w.conn.updateDnsProxy()
+
 	if w.conn.State.IsStop() {
 		w.conn.State.Close()
 		return
@@ -213,6 +283,10 @@ func (w *Wg) Connect(data *ConnData) (err error) {
 
 	w.conn.Data.ValidateAuthToken()
 
+	if data.Configuration.Port != 0 {
+		setWgPort(w.conn.Client.remote, data.Configuration.Port)
+	}
+
 	logrus.WithFields(w.conn.Fields(logrus.Fields{
 		"ping_interval":  data.Configuration.PingInterval,
 		"ping_timeout":   data.Configuration.PingTimeout,
@@ -265,11 +339,14 @@ func (w *Wg) WatchConnection() (err error) {
 			return
 		}
 
-		if w.lastHandshake != 0 {
+		if w.getLastHandshake() != 0 {
 			w.connected = true
-			w.conn.Data.Status = Connected
+			w.conn.Data.SetStatus(Connected)
 			w.conn.Data.Timestamp = time.Now().Unix() - 3
+			GlobalStore.ResetReconnect(w.conn.Id)
 			w.conn.Data.UpdateEvent()
+			w.conn.Client.hookConnected()
+			w.conn.updateNetworkPath()
 			break
 		}
 
@@ -281,8 +358,9 @@ func (w *Wg) WatchConnection() (err error) {
 		return
 	}
 
-	if w.lastHandshake == 0 {
+	if w.getLastHandshake() == 0 {
 		w.conn.Data.SendProfileEvent("handshake_timeout")
+		w.conn.State.SetReconnectReason(ReconnectHandshake)
 
 		logrus.WithFields(w.conn.Fields(logrus.Fields{
 			"error": err,
@@ -294,7 +372,7 @@ func (w *Wg) WatchConnection() (err error) {
 
 	if !w.conn.Profile.DisableDns && w.conn.Data.DnsServers != nil &&
 		len(w.conn.Data.DnsServers) > 0 && runtime.GOOS == "darwin" &&
-		!config.Config.DisableWgDns {
+		!config.Config.DisableWgDns && !dnsproxy.IsRunning() {
 
 		err := utils.SetScutilDns(w.conn.Id,
 			w.conn.Data.DnsServers, w.conn.Data.DnsServers)
@@ -330,6 +408,14 @@ func (w *Wg) WatchConnection() (err error) {
 			return
 		}
 
+		err = w.updateHandshake()
+		if err != nil {
+			logrus.WithFields(w.conn.Fields(logrus.Fields{
+				"error": err,
+			})).Warn("connection: Failed to update handshake status")
+			err = nil
+		}
+
 		start := time.Now()
 		var data *PingData
 		var final bool
@@ -339,6 +425,8 @@ func (w *Wg) WatchConnection() (err error) {
 				break
 			}
 
+			metrics.PingRetry.Inc()
+
 			if time.Since(lastRetryLogged) > 30*time.Minute {
 				lastRetryLogged = time.Now()
 				logrus.WithFields(w.conn.Fields(logrus.Fields{
@@ -353,11 +441,24 @@ func (w *Wg) WatchConnection() (err error) {
 
 			time.Sleep(1 * time.Second)
 		}
+		if err == nil && w.handshakeStale() {
+			err = &errortypes.RequestError{
+				errors.New("connection: WireGuard handshake stale"),
+			}
+		}
 		if err != nil {
+			metrics.PingFailure.Inc()
+
 			logrus.WithFields(w.conn.Fields(logrus.Fields{
 				"error": err,
 			})).Error("connection: Keepalive failed")
 
+			if !final && w.failover() {
+				continue
+			}
+
+			w.conn.State.SetReconnectReason(ReconnectKeepalive)
+
 			w.conn.State.Close()
 			return
 		}
@@ -371,6 +472,8 @@ func (w *Wg) WatchConnection() (err error) {
 			logrus.WithFields(w.conn.Fields(nil)).Error(
 				"profile: Keepalive missing status")
 
+			w.conn.State.SetReconnectReason(ReconnectKeepalive)
+
 			w.conn.State.Close()
 			return
 		}
@@ -378,6 +481,11 @@ func (w *Wg) WatchConnection() (err error) {
 }
 
 func (w *Wg) updateHandshake() (err error) {
+	if runtime.GOOS == "linux" {
+		err = w.updateHandshakeLinux()
+		return
+	}
+
 	iface := ""
 	if runtime.GOOS == "darwin" {
 		iface = w.conn.Data.WgTunIface
@@ -409,12 +517,34 @@ func (w *Wg) updateHandshake() (err error) {
 				continue
 			}
 
-			w.lastHandshake = lastHandshake
+			w.setLastHandshake(lastHandshake)
 			return
 		}
 	}
 
-	w.lastHandshake = 0
+	w.setLastHandshake(0)
+	return
+}
+
+func (w *Wg) updateHandshakeLinux() (err error) {
+	peer, err := wgGetPeer(w.conn.Data.Iface, w.serverPubKey)
+	if err != nil {
+		return
+	}
+
+	if peer == nil {
+		w.setLastHandshake(0)
+		return
+	}
+
+	if peer.LastHandshake.IsZero() {
+		w.setLastHandshake(0)
+	} else {
+		w.setLastHandshake(int(peer.LastHandshake.Unix()))
+	}
+	w.conn.Data.RxBytes = peer.ReceiveBytes
+	w.conn.Data.TxBytes = peer.TransmitBytes
+
 	return
 }
 
@@ -439,11 +569,13 @@ func (w *Wg) ping() (data *PingData, final bool, err error) {
 	ctx := w.conn.Client.GetContext()
 	defer ctx.Cancel()
 
+	start := time.Now()
 	res, err := w.conn.Client.EncRequest(ctx, "PUT", reqUrl, ciph, reqBx)
 	if err != nil {
 		return
 	}
 	defer res.Body.Close()
+	latency := time.Since(start)
 
 	if res.StatusCode != 200 {
 		if res.StatusCode >= 400 && res.StatusCode < 500 {
@@ -480,6 +612,10 @@ func (w *Wg) ping() (data *PingData, final bool, err error) {
 		return
 	}
 
+	w.statsLock.Lock()
+	w.pingLatency = latency
+	w.statsLock.Unlock()
+
 	return
 }
 
@@ -623,12 +759,11 @@ func (w *Wg) confWg(data *WgConf) (err error) {
 	w.conn.Data.PingTimeoutWg = data.PingTimeout
 	w.conn.Data.WebPort = data.WebPort
 	w.conn.Data.WebNoSsl = data.WebNoSsl
-	w.conn.Data.DnsServers = data.DnsServers
-	w.conn.Data.SearchDomains = data.SearchDomains
-	w.conn.Data.Routes = data.Routes
-	w.conn.Data.Routes6 = data.Routes6
+	w.conn.Data.SetNetwork(data.Routes, data.Routes6,
+		data.DnsServers, data.SearchDomains)
 
 	w.serverPubKey = data.PublicKey
+	w.serverConf = data
 
 	switch runtime.GOOS {
 	case "darwin":
@@ -638,7 +773,7 @@ func (w *Wg) confWg(data *WgConf) (err error) {
 		err = w.confWgWin()
 		break
 	case "linux":
-		err = w.confWgLinux()
+		err = w.confWgLinux(data)
 		break
 	default:
 		panic("profile: Not implemented")
@@ -652,29 +787,84 @@ func (w *Wg) confWg(data *WgConf) (err error) {
 	return
 }
 
-func (w *Wg) confWgLinux() (err error) {
+func (w *Wg) confWgLinux(data *WgConf) (err error) {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	for i := 0; i < 3; i++ {
-		_, _ = utils.ExecCombinedOutput(
-			w.wgQuickPath, "down", w.conn.Data.Iface,
-		)
+	addrs := []string{}
+	if data.Address != "" {
+		addrs = append(addrs, data.Address)
+	}
+	if data.Address6 != "" {
+		addrs = append(addrs, data.Address6)
+	}
 
+	routes := []*wireguard.Route{}
+	for _, route := range data.Routes {
+		if w.conn.Profile.DisableGateway && route.Network == "0.0.0.0/0" {
+			continue
+		}
+		if route.NetGateway {
+			continue
+		}
+
+		routes = append(routes, &wireguard.Route{
+			Network: route.Network,
+			Metric:  route.Metric,
+		})
+	}
+	for _, route := range data.Routes6 {
+		if w.conn.Profile.DisableGateway && route.Network == "::/0" {
+			continue
+		}
+		if route.NetGateway {
+			continue
+		}
+
+		routes = append(routes, &wireguard.Route{
+			Network: route.Network,
+			Metric:  route.Metric,
+		})
+	}
+
+	conf := &wireguard.Config{
+		Iface:      w.conn.Data.Iface,
+		PrivateKey: w.privateKey,
+		PublicKey:  data.PublicKey,
+		Endpoint:   fmt.Sprintf("%s:%d", data.Hostname, data.Port),
+		Mtu:        data.Mtu,
+		Addresses:  addrs,
+		Routes:     routes,
+		Userspace:  w.userspace,
+	}
+
+	// DNS is configured through the DNS proxy on Linux, the proxy is
+	// started when needed and attaches to resolved, NetworkManager or
+	// resolv.conf once the connection adds a route
+	if !w.conn.Profile.DisableDns && (len(data.DnsServers) > 0 ||
+		len(data.SearchDomains) > 0) && !dnsproxy.IsRunning() {
+
+		err = dnsproxy.Start()
+		if err != nil {
+			return
+		}
+	}
+
+	for i := 0; i < 3; i++ {
 		if i == 0 {
 			time.Sleep(100 * time.Millisecond)
 		} else {
 			time.Sleep(500 * time.Millisecond)
 		}
 
-		_, err = utils.ExecCombinedOutputLogged(
-			nil,
-			w.wgQuickPath,
-			"up", w.conn.Data.Iface,
-		)
+		err = wireguard.Configure(conf)
 		if err == nil {
 			break
 		}
+
+		logrus.WithFields(w.conn.Fields(logrus.Fields{
+			"error": err,
+		})).Warn("connection: Failed to configure wg interface")
 	}
 
 	if err != nil {
@@ -785,81 +975,12 @@ func (w *Wg) confWgWin() (err error) {
 
 func (w *Wg) applyRouteMetrics(data *WgConf) {
 	switch runtime.GOOS {
-	case "linux":
-		w.applyRouteMetricsLinux(data)
-		break
 	case "windows":
 		w.applyRouteMetricsWin(data)
 		break
 	}
 }
 
-func (w *Wg) applyRouteMetricsLinux(data *WgConf) {
-	time.Sleep(200 * time.Millisecond)
-
-	iface := w.conn.Data.Iface
-
-	if data.Routes != nil {
-		for _, route := range data.Routes {
-			if route.Metric == 0 || route.NetGateway {
-				continue
-			}
-			if route.Network == "0.0.0.0/0" {
-				continue
-			}
-
-			utils.ExecCombinedOutput(
-				"ip", "-4", "route", "del",
-				route.Network, "dev", iface,
-			)
-
-			_, err := utils.ExecCombinedOutputLogged(
-				nil,
-				"ip", "-4", "route", "add",
-				route.Network, "dev", iface,
-				"metric", strconv.Itoa(route.Metric),
-			)
-			if err != nil {
-				logrus.WithFields(w.conn.Fields(logrus.Fields{
-					"network": route.Network,
-					"metric":  route.Metric,
-					"error":   err,
-				})).Warn("connection: Failed to set IPv4 route metric")
-			}
-		}
-	}
-
-	if data.Routes6 != nil {
-		for _, route := range data.Routes6 {
-			if route.Metric == 0 || route.NetGateway {
-				continue
-			}
-			if route.Network == "::/0" {
-				continue
-			}
-
-			utils.ExecCombinedOutput(
-				"ip", "-6", "route", "del",
-				route.Network, "dev", iface,
-			)
-
-			_, err := utils.ExecCombinedOutputLogged(
-				nil,
-				"ip", "-6", "route", "add",
-				route.Network, "dev", iface,
-				"metric", strconv.Itoa(route.Metric),
-			)
-			if err != nil {
-				logrus.WithFields(w.conn.Fields(logrus.Fields{
-					"network": route.Network,
-					"metric":  route.Metric,
-					"error":   err,
-				})).Warn("connection: Failed to set IPv6 route metric")
-			}
-		}
-	}
-}
-
 func (w *Wg) applyRouteMetricsWin(data *WgConf) {
 	time.Sleep(300 * time.Millisecond)
 
@@ -921,14 +1042,12 @@ func (w *Wg) clearWgLinux() {
 	defer w.lock.Unlock()
 
 	if w.conn.Data.Iface != "" {
-		utils.ExecCombinedOutputLogged(
-			[]string{
-				"does not exist",
-				"is not a",
-			},
-			w.wgQuickPath,
-			"down", w.conn.Data.Iface,
-		)
+		err := wireguard.Clear(w.conn.Data.Iface)
+		if err != nil {
+			logrus.WithFields(w.conn.Fields(logrus.Fields{
+				"error": err,
+			})).Error("connection: Failed to clear wg interface")
+		}
 	}
 }
 
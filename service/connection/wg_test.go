@@ -0,0 +1,375 @@
+package connection
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/pritunl/pritunl-client-electron/service/wireguard"
+)
+
+func waitClosed(t *testing.T, conn *Connection) {
+	t.Helper()
+
+	closed := make(chan bool, 1)
+	go func() {
+		conn.State.CloseWait()
+		closed <- true
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(testTimeout):
+		t.Fatal("connection: Timeout waiting for connection close")
+	}
+}
+
+func TestWgPing(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeServer(t)
+	conn := newTestConnection(t, srv, WgMode, Options{Interactive: true})
+	prov := newFakeProvider(conn)
+
+	err := conn.Client.Start(prov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prov.waitConnected(t)
+
+	defer func() {
+		conn.Stop()
+		prov.waitDisconnected(t)
+	}()
+
+	data, _, err := conn.Wg.ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data == nil || !data.Status {
+		t.Fatal("connection: Expected ping status")
+	}
+	if conn.Wg.getPingLatency() <= 0 {
+		t.Fatal("connection: Ping latency not set")
+	}
+
+	reqs := srv.Requests()
+	req := reqs[len(reqs)-1]
+	if req.Method != "PUT" || req.Handle != WgMode {
+		t.Fatalf("connection: Unexpected request %s %s",
+			req.Method, req.Path)
+	}
+	if req.Box.WgPublicKey != prov.publicKey {
+		t.Fatal("connection: Public key not sent")
+	}
+
+	srv.PingStatus = 500
+	_, final, err := conn.Wg.ping()
+	if err == nil {
+		t.Fatal("connection: Expected ping error")
+	}
+	if final {
+		t.Fatal("connection: Server error should not be final")
+	}
+
+	srv.PingStatus = 403
+	_, final, err = conn.Wg.ping()
+	if err == nil {
+		t.Fatal("connection: Expected ping error")
+	}
+	if !final {
+		t.Fatal("connection: Client error should be final")
+	}
+
+	srv.PingStatus = 0
+	srv.BadSignature = true
+	_, _, err = conn.Wg.ping()
+	if err == nil {
+		t.Fatal("connection: Expected signature error")
+	}
+	srv.BadSignature = false
+}
+
+func TestWgKeepaliveFailure(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeServer(t)
+	conn := newTestConnection(t, srv, WgMode, Options{Interactive: true})
+	prov := newFakeProvider(conn)
+
+	pingErr := make(chan error, 1)
+	prov.watch = func() (err error) {
+		srv.PingStatus = 403
+
+		_, final, err := conn.Wg.ping()
+		if err != nil && !final {
+			t.Error("connection: Keepalive rejection should be final")
+		}
+		pingErr <- err
+
+		return
+	}
+
+	err := conn.Client.Start(prov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prov.waitConnected(t)
+
+	select {
+	case err = <-pingErr:
+		if err == nil {
+			t.Fatal("connection: Expected keepalive error")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("connection: Timeout waiting for keepalive")
+	}
+
+	waitClosed(t, conn)
+
+	if GlobalStore.Get(conn.Id) != nil {
+		t.Fatal("connection: Connection not removed after keepalive failure")
+	}
+
+	reqs := srv.Requests()
+	if len(reqs) != 2 || reqs[1].Method != "PUT" {
+		t.Fatal("connection: Keepalive request not sent")
+	}
+}
+
+func TestWgFailoverRemotes(t *testing.T) {
+	conn, err := NewConnection(&Profile{
+		Id:   utils.Uuid(),
+		Mode: WgMode,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Data.Remotes = Remotes{
+		{Host: "one.example.com"},
+		{Host: "two.example.com"},
+		{Host: "three.example.com"},
+	}
+	conn.Client.remote = "two.example.com"
+
+	hosts := conn.Wg.failoverRemotes().GetHosts()
+	if len(hosts) != 2 || hosts[0] != "three.example.com" ||
+		hosts[1] != "one.example.com" {
+
+		t.Fatalf("connection: Unexpected failover remotes %v", hosts)
+	}
+
+	conn.Client.remote = ""
+	hosts = conn.Wg.failoverRemotes().GetHosts()
+	if len(hosts) != 3 || hosts[0] != "one.example.com" {
+		t.Fatalf("connection: Unexpected failover remotes %v", hosts)
+	}
+
+	conn.Data.Remotes = Remotes{
+		{Host: "one.example.com"},
+	}
+	conn.Client.remote = "one.example.com"
+	if len(conn.Wg.failoverRemotes()) != 0 {
+		t.Fatal("connection: Expected no failover remotes")
+	}
+
+	conn.Data.Routes = []*Route{
+		{Network: "0.0.0.0/0"},
+		{Network: "198.51.100.0/24", NetGateway: true},
+	}
+	conn.Data.Routes6 = []*Route{
+		{Network: "::/0"},
+	}
+	allowedIps := conn.Wg.allowedIps()
+	if len(allowedIps) != 2 || allowedIps[0] != "0.0.0.0/0" ||
+		allowedIps[1] != "::/0" {
+
+		t.Fatalf("connection: Unexpected allowed ips %v", allowedIps)
+	}
+}
+
+func TestWgHandshakeStale(t *testing.T) {
+	conn, err := NewConnection(&Profile{
+		Id:   utils.Uuid(),
+		Mode: WgMode,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conn.Wg.handshakeStale() {
+		t.Fatal("connection: Missing handshake should not be stale")
+	}
+
+	conn.Wg.setLastHandshake(int(time.Now().Unix()) - 120)
+	if conn.Wg.handshakeStale() {
+		t.Fatal("connection: Recent handshake should not be stale")
+	}
+
+	config.Config.WgHandshakeStale = 60
+	defer func() {
+		config.Config.WgHandshakeStale = 0
+	}()
+
+	if !conn.Wg.handshakeStale() {
+		t.Fatal("connection: Expected stale handshake")
+	}
+}
+
+func TestWgFailover(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("connection: Failover peer update uses netlink")
+	}
+
+	peers := make(chan *wireguard.Config, 1)
+	wgSetPeer = func(conf *wireguard.Config) (err error) {
+		peers <- conf
+		return
+	}
+	wgGetPeer = func(iface, publicKey string) (
+		peer *wireguard.Peer, err error) {
+
+		peer = &wireguard.Peer{
+			PublicKey:     publicKey,
+			LastHandshake: time.Now(),
+		}
+		return
+	}
+	defer func() {
+		wgSetPeer = wireguard.SetPeer
+		wgGetPeer = wireguard.GetPeer
+	}()
+
+	srv := newFakeServer(t)
+	conn := newTestConnection(t, srv, WgMode, Options{Interactive: true})
+	prov := newFakeProvider(conn)
+
+	rec := newEventRecorder(conn.Id)
+	defer rec.Close()
+
+	err := conn.Client.Start(prov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prov.waitConnected(t)
+
+	defer func() {
+		conn.Stop()
+		prov.waitDisconnected(t)
+	}()
+
+	oldRemote := srv.Host()
+	newRemote := fmt.Sprintf("localhost:%d", srv.Port())
+
+	conn.Data.ClientAddr = "10.150.0.2/24"
+	conn.Data.Remotes = Remotes{
+		{Host: oldRemote},
+		{Host: newRemote},
+	}
+	conn.Client.remote = oldRemote
+
+	if !conn.Wg.failover() {
+		t.Fatal("connection: Expected failover to succeed")
+	}
+
+	select {
+	case peer := <-peers:
+		if peer.Endpoint != "127.0.0.1:1194" ||
+			peer.PublicKey != "server-public-key" {
+
+			t.Fatalf("connection: Unexpected failover peer %s %s",
+				peer.Endpoint, peer.PublicKey)
+		}
+	default:
+		t.Fatal("connection: Failover peer not set")
+	}
+
+	if conn.Client.remote != newRemote {
+		t.Fatalf("connection: Unexpected remote %s", conn.Client.remote)
+	}
+	if !rec.has("remote_failover") {
+		t.Fatal("connection: Missing remote_failover event")
+	}
+}
+
+func TestWgFailoverRestore(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("connection: Failover peer update uses netlink")
+	}
+
+	peers := make(chan *wireguard.Config, 2)
+	wgSetPeer = func(conf *wireguard.Config) (err error) {
+		peers <- conf
+		if conf.PublicKey == "server-public-key" {
+			err = fmt.Errorf("connection: Peer update failed")
+		}
+		return
+	}
+	defer func() {
+		wgSetPeer = wireguard.SetPeer
+	}()
+
+	srv := newFakeServer(t)
+	conn := newTestConnection(t, srv, WgMode, Options{Interactive: true})
+	prov := newFakeProvider(conn)
+
+	err := conn.Client.Start(prov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prov.waitConnected(t)
+
+	defer func() {
+		conn.Stop()
+		prov.waitDisconnected(t)
+	}()
+
+	oldRemote := srv.Host()
+	newRemote := fmt.Sprintf("localhost:%d", srv.Port())
+
+	conn.Data.ClientAddr = "10.150.0.2/24"
+	conn.Data.ServerAddr = "198.51.100.1"
+	conn.Data.GatewayAddr = "10.150.0.1"
+	conn.Data.Remotes = Remotes{
+		{Host: oldRemote},
+		{Host: newRemote},
+	}
+	conn.Client.remote = oldRemote
+	conn.Wg.serverConf = &WgConf{
+		Hostname:  "198.51.100.1",
+		Gateway:   "10.150.0.1",
+		Port:      1194,
+		PublicKey: "old-public-key",
+	}
+
+	if conn.Wg.failover() {
+		t.Fatal("connection: Expected failover to fail")
+	}
+
+	<-peers
+	select {
+	case peer := <-peers:
+		if peer.Endpoint != "198.51.100.1:1194" ||
+			peer.PublicKey != "old-public-key" {
+
+			t.Fatalf("connection: Unexpected restored peer %s %s",
+				peer.Endpoint, peer.PublicKey)
+		}
+	default:
+		t.Fatal("connection: Peer not restored")
+	}
+
+	if conn.Data.ServerAddr != "198.51.100.1" ||
+		conn.Data.GatewayAddr != "10.150.0.1" {
+
+		t.Fatalf("connection: Unexpected server address %s %s",
+			conn.Data.ServerAddr, conn.Data.GatewayAddr)
+	}
+	if conn.Client.remote != oldRemote {
+		t.Fatalf("connection: Unexpected remote %s", conn.Client.remote)
+	}
+}
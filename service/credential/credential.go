@@ -0,0 +1,185 @@
+// Credential helper protocol for profile passwords and passcodes. The
+// helper command is run with the argument get and receives key=value
+// lines on stdin terminated by a blank line:
+//
+//	profile_id=<id>
+//	organization=<name>
+//	user=<name>
+//	server=<name>
+//	password_mode=<mode>
+//	part=pin
+//	part=otp
+//
+// One part line is sent for each value required by the password mode.
+// The helper writes key=value lines to stdout with one line for each
+// requested part, a non-zero exit status aborts the request.
+package credential
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/command"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+)
+
+const (
+	defaultTimeout = 60 * time.Second
+)
+
+var partsOrder = []string{
+	"pin",
+	"duo",
+	"onelogin",
+	"okta",
+	"otp",
+	"yubikey",
+	"password",
+}
+
+type Request struct {
+	ProfileId    string
+	Organization string
+	User         string
+	Server       string
+	PasswordMode string
+}
+
+// Parts returns the values required by the password mode in the order
+// they are joined, a mode without known parts requires a password
+func Parts(passwordMode string) (parts []string) {
+	passModes := map[string]bool{}
+	for _, passMode := range strings.Split(passwordMode, "_") {
+		passModes[passMode] = true
+	}
+
+	for _, part := range partsOrder {
+		if passModes[part] {
+			parts = append(parts, part)
+		}
+	}
+
+	if len(parts) == 0 {
+		parts = []string{"password"}
+	}
+
+	return
+}
+
+func (r *Request) Marshal() []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "profile_id=%s\n", r.ProfileId)
+	fmt.Fprintf(buf, "organization=%s\n", r.Organization)
+	fmt.Fprintf(buf, "user=%s\n", r.User)
+	fmt.Fprintf(buf, "server=%s\n", r.Server)
+	fmt.Fprintf(buf, "password_mode=%s\n", r.PasswordMode)
+	for _, part := range Parts(r.PasswordMode) {
+		fmt.Fprintf(buf, "part=%s\n", part)
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes()
+}
+
+func ParseResponse(output []byte, parts []string) (
+	password string, err error) {
+
+	values := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+
+		lineSpl := strings.SplitN(line, "=", 2)
+		if len(lineSpl) != 2 {
+			continue
+		}
+
+		values[lineSpl[0]] = lineSpl[1]
+	}
+
+	for _, part := range parts {
+		val := values[part]
+		if val == "" {
+			err = &errortypes.ParseError{
+				errors.Newf("credential: Helper missing value for '%s'",
+					part),
+			}
+			return
+		}
+		password += val
+	}
+
+	return
+}
+
+func helperCommand(helper string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "windows":
+		return command.Command("cmd.exe", "/C", helper+" get")
+	default:
+		return command.Command("/bin/sh", "-c", helper+" get")
+	}
+}
+
+// Get runs the credential helper and returns the joined password
+func Get(helper string, req *Request) (password string, err error) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	cmd := helperCommand(helper)
+	cmd.Stdin = bytes.NewReader(req.Marshal())
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = 3 * time.Second
+
+	err = cmd.Start()
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "credential: Failed to start helper"),
+		}
+		return
+	}
+
+	waiter := make(chan error, 1)
+	go func() {
+		waiter <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-waiter:
+		if err != nil {
+			err = &errortypes.ExecError{
+				errors.Wrapf(err, "credential: Helper failed '%s'",
+					strings.TrimSpace(stderr.String())),
+			}
+			return
+		}
+		break
+	case <-time.After(defaultTimeout):
+		_ = cmd.Process.Kill()
+		<-waiter
+		err = &errortypes.ExecError{
+			errors.Newf("credential: Helper timed out after %s",
+				defaultTimeout),
+		}
+		return
+	}
+
+	password, err = ParseResponse(stdout.Bytes(), Parts(req.PasswordMode))
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -0,0 +1,71 @@
+package credential
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParts(t *testing.T) {
+	for mode, expected := range map[string]string{
+		"":             "password",
+		"otp":          "otp",
+		"otp_pin":      "pin otp",
+		"password_otp": "otp password",
+		"yubikey_duo":  "duo yubikey",
+		"unknown":      "password",
+	} {
+		parts := strings.Join(Parts(mode), " ")
+		if parts != expected {
+			t.Errorf("credential: Unexpected parts for '%s' %q",
+				mode, parts)
+		}
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	password, err := ParseResponse(
+		[]byte("otp=123456\r\npin=1234\nother=x\n\npassword=y\n"),
+		[]string{"pin", "otp"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password != "1234123456" {
+		t.Fatalf("credential: Unexpected password %q", password)
+	}
+
+	_, err = ParseResponse([]byte("pin=1234\n\notp=123456\n"),
+		[]string{"pin", "otp"})
+	if err == nil {
+		t.Fatal("credential: Expected missing part error")
+	}
+}
+
+func TestGet(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential: Helper test uses sh")
+	}
+
+	req := &Request{
+		ProfileId:    "test",
+		User:         "user@example.com",
+		Server:       "server",
+		PasswordMode: "pin_otp",
+	}
+
+	password, err := Get(`f() { [ "$1" = get ] || exit 1; `+
+		`grep -q '^part=otp$' && echo pin=1234 && echo otp=654321; }; f`,
+		req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password != "1234654321" {
+		t.Fatalf("credential: Unexpected password %q", password)
+	}
+
+	_, err = Get("echo denied 1>&2; exit 1; :", req)
+	if err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Fatalf("credential: Expected helper error, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package dnsproxy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	cacheMaxEntries  = 4096
+	cacheMaxTtl      = 300
+	cacheNegativeTtl = 30
+)
+
+var (
+	cache       = map[string]*cacheEntry{}
+	cacheHits   = 0
+	cacheMisses = 0
+	cacheLock   = sync.Mutex{}
+)
+
+type cacheEntry struct {
+	msg     *dns.Msg
+	expires time.Time
+}
+
+type CacheStats struct {
+	Entries int `json:"entries"`
+	Hits    int `json:"hits"`
+	Misses  int `json:"misses"`
+}
+
+func cacheKey(routeId string, ques dns.Question) string {
+	return fmt.Sprintf("%s/%s/%d/%d", routeId,
+		dns.CanonicalName(ques.Name), ques.Qtype, ques.Qclass)
+}
+
+func getTtl(msg *dns.Msg) (ttl uint32) {
+	ttl = cacheMaxTtl
+
+	rrs := append(append([]dns.RR{}, msg.Answer...), msg.Ns...)
+	if len(rrs) == 0 {
+		return cacheNegativeTtl
+	}
+
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		if rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+
+	return
+}
+
+func cacheGet(key string) (msg *dns.Msg) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	entry := cache[key]
+	if entry == nil {
+		cacheMisses += 1
+		return
+	}
+
+	remaining := time.Until(entry.expires)
+	if remaining <= 0 {
+		delete(cache, key)
+		cacheMisses += 1
+		return
+	}
+
+	cacheHits += 1
+
+	msg = entry.msg.Copy()
+	ttl := uint32(remaining.Seconds())
+	for _, rrs := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range rrs {
+			if rr.Header().Rrtype != dns.TypeOPT && rr.Header().Ttl > ttl {
+				rr.Header().Ttl = ttl
+			}
+		}
+	}
+
+	return
+}
+
+func cacheSet(key string, msg *dns.Msg) {
+	if msg.Truncated || (msg.Rcode != dns.RcodeSuccess &&
+		msg.Rcode != dns.RcodeNameError) {
+
+		return
+	}
+
+	ttl := getTtl(msg)
+	if ttl == 0 {
+		return
+	}
+
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	if len(cache) >= cacheMaxEntries {
+		now := time.Now()
+		for k, entry := range cache {
+			if now.After(entry.expires) {
+				delete(cache, k)
+			}
+		}
+
+		if len(cache) >= cacheMaxEntries {
+			cache = map[string]*cacheEntry{}
+		}
+	}
+
+	cache[key] = &cacheEntry{
+		msg:     msg.Copy(),
+		expires: time.Now().Add(time.Duration(ttl) * time.Second),
+	}
+}
+
+func FlushCache() {
+	cacheLock.Lock()
+	cache = map[string]*cacheEntry{}
+	cacheLock.Unlock()
+}
+
+func GetCacheStats() (stats *CacheStats) {
+	cacheLock.Lock()
+	stats = &CacheStats{
+		Entries: len(cache),
+		Hits:    cacheHits,
+		Misses:  cacheMisses,
+	}
+	cacheLock.Unlock()
+	return
+}
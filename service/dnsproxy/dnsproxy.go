@@ -0,0 +1,489 @@
+package dnsproxy
+
+import (
+	"net"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/miekg/dns"
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultAddress = "127.0.0.85"
+	queryTimeout   = 3 * time.Second
+)
+
+var (
+	routes     = map[string]*Route{}
+	upstream   = []string{}
+	address    = ""
+	attached   = false
+	running    = false
+	udpServer  *dns.Server
+	tcpServer  *dns.Server
+	routesLock = sync.Mutex{}
+	serverLock = sync.Mutex{}
+)
+
+type Route struct {
+	Id      string   `json:"id"`
+	Servers []string `json:"servers"`
+	Domains []string `json:"domains"`
+	Force   bool     `json:"force"`
+}
+
+type target struct {
+	routeId  string
+	servers  []string
+	fallback bool
+	refuse   bool
+}
+
+type State struct {
+	Running  bool        `json:"running"`
+	Address  string      `json:"address"`
+	Upstream []string    `json:"upstream"`
+	Routes   []*Route    `json:"routes"`
+	Cache    *CacheStats `json:"cache"`
+	Log      []*Query    `json:"log"`
+}
+
+func IsRunning() bool {
+	serverLock.Lock()
+	defer serverLock.Unlock()
+	return running
+}
+
+// Restore removes DNS configuration left behind by a previous service
+// instance that exited without detaching
+func Restore() (err error) {
+	routesLock.Lock()
+	defer routesLock.Unlock()
+
+	err = restore()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Upstream returns the system resolvers, used by lockdown to allow remote
+// lookups while non-tunnel traffic is blocked
+func Upstream() (servers []string) {
+	routesLock.Lock()
+	defer routesLock.Unlock()
+
+	if attached {
+		servers = upstream
+		return
+	}
+
+	servers = getUpstream(address)
+	return
+}
+
+func Start() (err error) {
+	serverLock.Lock()
+	defer serverLock.Unlock()
+
+	if running {
+		return
+	}
+
+	addr := config.Config.DnsProxyAddress
+	if addr == "" {
+		addr = DefaultAddress
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil || !ip.IsLoopback() || ip.To4() == nil {
+		err = &errortypes.ParseError{
+			errors.Newf("dnsproxy: Invalid listen address '%s'", addr),
+		}
+		return
+	}
+
+	err = prepare(addr)
+	if err != nil {
+		return
+	}
+
+	listenAddr := net.JoinHostPort(addr, "53")
+
+	pc, err := net.ListenPacket("udp", listenAddr)
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "dnsproxy: Failed to listen on udp"),
+		}
+		return
+	}
+
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		_ = pc.Close()
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "dnsproxy: Failed to listen on tcp"),
+		}
+		return
+	}
+
+	handler := dns.HandlerFunc(handle)
+	udpServer = &dns.Server{
+		PacketConn: pc,
+		Handler:    handler,
+	}
+	tcpServer = &dns.Server{
+		Listener: ln,
+		Handler:  handler,
+	}
+
+	go serve(udpServer)
+	go serve(tcpServer)
+
+	address = addr
+	running = true
+
+	logrus.WithFields(logrus.Fields{
+		"address": addr,
+	}).Info("dnsproxy: Started DNS proxy")
+
+	return
+}
+
+func Stop() {
+	routesLock.Lock()
+	routes = map[string]*Route{}
+	if attached {
+		_ = detach()
+		attached = false
+	}
+	routesLock.Unlock()
+
+	serverLock.Lock()
+	defer serverLock.Unlock()
+
+	if !running {
+		return
+	}
+
+	if udpServer != nil {
+		_ = udpServer.Shutdown()
+		udpServer = nil
+	}
+	if tcpServer != nil {
+		_ = tcpServer.Shutdown()
+		tcpServer = nil
+	}
+
+	running = false
+	FlushCache()
+}
+
+func serve(server *dns.Server) {
+	defer func() {
+		panc := recover()
+		if panc != nil {
+			logrus.WithFields(logrus.Fields{
+				"trace": string(debug.Stack()),
+				"panic": panc,
+			}).Error("dnsproxy: Server panic")
+		}
+	}()
+
+	err := server.ActivateAndServe()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("dnsproxy: Server error")
+	}
+}
+
+func getIds() (prflIds []string) {
+	prflIds = []string{}
+	for prflId := range routes {
+		prflIds = append(prflIds, prflId)
+	}
+	sort.Strings(prflIds)
+	return
+}
+
+func getDomains() (domains []string) {
+	domains = []string{}
+	for _, prflId := range getIds() {
+		domains = append(domains, routes[prflId].Domains...)
+	}
+	return
+}
+
+func Set(prflId string, servers, domains []string, force bool) (err error) {
+	if !IsRunning() {
+		return
+	}
+
+	routesLock.Lock()
+	defer routesLock.Unlock()
+
+	route := &Route{
+		Id:      prflId,
+		Servers: []string{},
+		Domains: []string{},
+		Force:   force,
+	}
+
+	for _, server := range servers {
+		if net.ParseIP(server) != nil {
+			route.Servers = append(route.Servers, server)
+		}
+	}
+
+	for _, domain := range domains {
+		domain = strings.Trim(strings.ToLower(domain), ". ")
+		if domain != "" {
+			route.Domains = append(route.Domains, domain)
+		}
+	}
+
+	if !attached {
+		upstream = getUpstream(address)
+	}
+
+	routes[prflId] = route
+	FlushCache()
+
+	err = attach(address, getDomains())
+	if err != nil {
+		return
+	}
+	attached = true
+
+	return
+}
+
+func Remove(prflId string) (err error) {
+	routesLock.Lock()
+	defer routesLock.Unlock()
+
+	if _, ok := routes[prflId]; !ok {
+		return
+	}
+	delete(routes, prflId)
+	FlushCache()
+
+	if !attached {
+		return
+	}
+
+	if len(routes) == 0 {
+		err = detach()
+		if err != nil {
+			return
+		}
+		attached = false
+	} else {
+		err = attach(address, getDomains())
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func resolve(name string) (tgt *target) {
+	routesLock.Lock()
+	defer routesLock.Unlock()
+
+	name = strings.ToLower(name)
+	prflIds := getIds()
+
+	bestLabels := 0
+	for _, prflId := range prflIds {
+		route := routes[prflId]
+		for _, domain := range route.Domains {
+			domain = dns.Fqdn(domain)
+			if !dns.IsSubDomain(domain, name) {
+				continue
+			}
+
+			labels := dns.CountLabel(domain)
+			if labels > bestLabels {
+				bestLabels = labels
+				tgt = &target{
+					routeId: route.Id,
+					servers: route.Servers,
+					refuse:  len(route.Servers) == 0,
+				}
+			}
+		}
+	}
+
+	if tgt != nil {
+		return
+	}
+
+	for _, prflId := range prflIds {
+		route := routes[prflId]
+		if route.Force {
+			tgt = &target{
+				routeId: route.Id,
+				servers: route.Servers,
+				refuse:  len(route.Servers) == 0,
+			}
+			return
+		}
+	}
+
+	for _, prflId := range prflIds {
+		route := routes[prflId]
+		if len(route.Domains) == 0 && len(route.Servers) > 0 {
+			tgt = &target{
+				routeId:  route.Id,
+				servers:  route.Servers,
+				fallback: true,
+			}
+			return
+		}
+	}
+
+	tgt = &target{
+		servers: upstream,
+	}
+
+	return
+}
+
+func exchange(req *dns.Msg, servers []string, proto string) (
+	resp *dns.Msg, server string, err error) {
+
+	for _, server = range servers {
+		addr := server
+		if net.ParseIP(server) != nil {
+			addr = net.JoinHostPort(server, "53")
+		}
+
+		client := &dns.Client{
+			Net:     proto,
+			Timeout: queryTimeout,
+		}
+
+		resp, _, err = client.Exchange(req, addr)
+		if err == nil && resp.Truncated && proto == "udp" {
+			client.Net = "tcp"
+			resp, _, err = client.Exchange(req, addr)
+		}
+		if err == nil {
+			return
+		}
+	}
+
+	if err == nil {
+		err = &errortypes.RequestError{
+			errors.New("dnsproxy: No servers available"),
+		}
+	}
+	resp = nil
+	server = ""
+
+	return
+}
+
+func reply(w dns.ResponseWriter, req *dns.Msg, rcode int) {
+	resp := &dns.Msg{}
+	resp.SetRcode(req, rcode)
+	_ = w.WriteMsg(resp)
+}
+
+func handle(w dns.ResponseWriter, req *dns.Msg) {
+	start := time.Now()
+
+	if len(req.Question) != 1 {
+		reply(w, req, dns.RcodeFormatError)
+		return
+	}
+
+	ques := req.Question[0]
+	proto := "udp"
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+		proto = "tcp"
+	}
+
+	query := &Query{
+		Timestamp: start,
+		Client:    w.RemoteAddr().String(),
+		Name:      ques.Name,
+		Type:      dns.TypeToString[ques.Qtype],
+	}
+	defer func() {
+		query.Duration = float64(time.Since(start).Microseconds()) / 1000
+		logQuery(query)
+	}()
+
+	tgt := resolve(ques.Name)
+	query.Route = tgt.routeId
+
+	if tgt.refuse {
+		query.Rcode = dns.RcodeToString[dns.RcodeRefused]
+		reply(w, req, dns.RcodeRefused)
+		return
+	}
+
+	key := cacheKey(tgt.routeId, ques)
+
+	resp := cacheGet(key)
+	if resp != nil {
+		resp.Id = req.Id
+		query.Cached = true
+		query.Rcode = dns.RcodeToString[resp.Rcode]
+		_ = w.WriteMsg(resp)
+		return
+	}
+
+	resp, server, err := exchange(req, tgt.servers, proto)
+	if err != nil && tgt.fallback {
+		query.Route = ""
+		resp, server, err = exchange(req, upstream, proto)
+	}
+	if err != nil {
+		query.Rcode = dns.RcodeToString[dns.RcodeServerFailure]
+		reply(w, req, dns.RcodeServerFailure)
+		return
+	}
+
+	query.Server = server
+	query.Rcode = dns.RcodeToString[resp.Rcode]
+
+	cacheSet(key, resp)
+
+	resp.Id = req.Id
+	_ = w.WriteMsg(resp)
+}
+
+func GetState() (state *State) {
+	serverLock.Lock()
+	state = &State{
+		Running: running,
+		Address: address,
+	}
+	serverLock.Unlock()
+
+	routesLock.Lock()
+	state.Upstream = upstream
+	state.Routes = []*Route{}
+	for _, prflId := range getIds() {
+		state.Routes = append(state.Routes, routes[prflId])
+	}
+	routesLock.Unlock()
+
+	state.Cache = GetCacheStats()
+	state.Log = GetLog()
+
+	return
+}
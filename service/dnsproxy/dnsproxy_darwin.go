@@ -0,0 +1,62 @@
+package dnsproxy
+
+import (
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+)
+
+const (
+	scutilConnId = "dnsproxy"
+)
+
+func prepare(addr string) (err error) {
+	if addr == "127.0.0.1" {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"/sbin/ifconfig", "lo0", "alias", addr, "up",
+	)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func getUpstream(addr string) (servers []string) {
+	servers = parseResolvConf("/etc/resolv.conf", addr)
+	return
+}
+
+func attach(addr string, domains []string) (err error) {
+	err = utils.SetScutilDns(scutilConnId, []string{addr}, domains)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func restore() (err error) {
+	err = utils.ClearScutilDns(scutilConnId)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func detach() (err error) {
+	err = utils.ClearScutilDns(scutilConnId)
+	if err != nil {
+		return
+	}
+
+	err = utils.RestoreScutilDns(false)
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -0,0 +1,304 @@
+package dnsproxy
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	resolvPath       = "/etc/resolv.conf"
+	resolvBackupPath = "/etc/resolv.conf.pritunl"
+	resolvedPath     = "/run/systemd/resolve/resolv.conf"
+	resolvedConfDir  = "/etc/systemd/resolved.conf.d"
+	resolvedConfPath = "/etc/systemd/resolved.conf.d/pritunl-dnsproxy.conf"
+	nmConfDir        = "/etc/NetworkManager/conf.d"
+	nmConfPath       = "/etc/NetworkManager/conf.d/pritunl-dnsproxy.conf"
+)
+
+const (
+	modeResolved = "resolved"
+	modeNm       = "network_manager"
+	modeResolv   = "resolv"
+)
+
+var (
+	attachMode = ""
+)
+
+func prepare(addr string) (err error) {
+	return
+}
+
+func getUpstream(addr string) (servers []string) {
+	pth := resolvPath
+	exists, _ := utils.Exists(resolvBackupPath)
+	if exists {
+		pth = resolvBackupPath
+	}
+
+	servers = parseResolvConf(pth, addr)
+	if len(servers) == 0 {
+		servers = parseResolvConf(resolvedPath, addr)
+	}
+
+	return
+}
+
+func isActive(unit string) bool {
+	systemctlPath, _ := exec.LookPath("systemctl")
+	if systemctlPath == "" {
+		return false
+	}
+
+	output, _ := utils.ExecOutput(systemctlPath, "is-active", unit)
+	return strings.TrimSpace(output) == "active"
+}
+
+func getMode() string {
+	if isActive("systemd-resolved") {
+		return modeResolved
+	}
+
+	nmcliPath, _ := exec.LookPath("nmcli")
+	if nmcliPath != "" && isActive("NetworkManager") {
+		return modeNm
+	}
+
+	return modeResolv
+}
+
+func reloadResolved() (err error) {
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"systemctl", "restart", "systemd-resolved",
+	)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func reloadNm() (err error) {
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"systemctl", "reload", "NetworkManager",
+	)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func attachResolved(addr string, domains []string) (err error) {
+	data := "# Generated by pritunl-client\n"
+	data += "[Resolve]\n"
+	data += fmt.Sprintf("DNS=%s\n", addr)
+	routeDomains := []string{"~."}
+	for _, domain := range domains {
+		routeDomains = append(routeDomains, "~"+domain)
+	}
+	data += fmt.Sprintf("Domains=%s\n", strings.Join(routeDomains, " "))
+
+	err = utils.ExistsMkdir(resolvedConfDir, 0755)
+	if err != nil {
+		return
+	}
+
+	err = utils.CreateWrite(resolvedConfPath, data, 0644)
+	if err != nil {
+		return
+	}
+
+	err = reloadResolved()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func attachNm(addr string, domains []string) (err error) {
+	data := "# Generated by pritunl-client\n"
+	data += "[global-dns]\n"
+	if len(domains) > 0 {
+		data += fmt.Sprintf("searches=%s\n", strings.Join(domains, ","))
+	}
+	data += "[global-dns-domain-*]\n"
+	data += fmt.Sprintf("servers=%s\n", addr)
+
+	err = utils.ExistsMkdir(nmConfDir, 0755)
+	if err != nil {
+		return
+	}
+
+	err = utils.CreateWrite(nmConfPath, data, 0644)
+	if err != nil {
+		return
+	}
+
+	err = reloadNm()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func attachResolv(addr string, domains []string) (err error) {
+	exists, err := utils.Exists(resolvBackupPath)
+	if err != nil {
+		return
+	}
+
+	if !exists {
+		err = os.Rename(resolvPath, resolvBackupPath)
+		if err != nil && !os.IsNotExist(err) {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "dnsproxy: Failed to backup resolv.conf"),
+			}
+			return
+		}
+		err = nil
+	}
+
+	data := "# Generated by pritunl-client\n"
+	data += fmt.Sprintf("nameserver %s\n", addr)
+	if len(domains) > 0 {
+		data += fmt.Sprintf("search %s\n", strings.Join(domains, " "))
+	}
+	data += "options edns0 trust-ad\n"
+
+	_ = os.Remove(resolvPath)
+	err = utils.CreateWrite(resolvPath, data, 0644)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// attach prefers configuring systemd-resolved or NetworkManager so the
+// system resolver manager does not overwrite the proxy, the resolv.conf
+// swap is only used when neither is running
+func attach(addr string, domains []string) (err error) {
+	if attachMode == "" {
+		attachMode = getMode()
+	}
+
+	switch attachMode {
+	case modeResolved:
+		err = attachResolved(addr, domains)
+	case modeNm:
+		err = attachNm(addr, domains)
+	default:
+		err = attachResolv(addr, domains)
+	}
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func detachResolv() (err error) {
+	exists, err := utils.Exists(resolvBackupPath)
+	if err != nil {
+		return
+	}
+
+	if !exists {
+		return
+	}
+
+	_ = os.Remove(resolvPath)
+
+	err = os.Rename(resolvBackupPath, resolvPath)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "dnsproxy: Failed to restore resolv.conf"),
+		}
+		return
+	}
+
+	return
+}
+
+func detachConf(pth string, reload func() error) (err error) {
+	exists, err := utils.Exists(pth)
+	if err != nil {
+		return
+	}
+
+	if !exists {
+		return
+	}
+
+	err = utils.Remove(pth)
+	if err != nil {
+		return
+	}
+
+	err = reload()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func detach() (err error) {
+	attachMode = ""
+
+	err = detachConf(resolvedConfPath, reloadResolved)
+	if err != nil {
+		return
+	}
+
+	err = detachConf(nmConfPath, reloadNm)
+	if err != nil {
+		return
+	}
+
+	err = detachResolv()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func restore() (err error) {
+	stale := false
+	for _, pth := range []string{
+		resolvedConfPath,
+		nmConfPath,
+		resolvBackupPath,
+	} {
+		exists, _ := utils.Exists(pth)
+		if exists {
+			stale = true
+		}
+	}
+
+	if !stale {
+		return
+	}
+
+	err = detach()
+	if err != nil {
+		return
+	}
+
+	logrus.Info("dnsproxy: Restored system DNS configuration")
+
+	return
+}
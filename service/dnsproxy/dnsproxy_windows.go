@@ -0,0 +1,33 @@
+package dnsproxy
+
+import (
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+)
+
+func prepare(addr string) (err error) {
+	err = &errortypes.ExecError{
+		errors.New("dnsproxy: Not implemented"),
+	}
+	return
+}
+
+func getUpstream(addr string) (servers []string) {
+	servers = []string{}
+	return
+}
+
+func attach(addr string, domains []string) (err error) {
+	err = &errortypes.ExecError{
+		errors.New("dnsproxy: Not implemented"),
+	}
+	return
+}
+
+func detach() (err error) {
+	return
+}
+
+func restore() (err error) {
+	return
+}
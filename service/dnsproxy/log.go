@@ -0,0 +1,50 @@
+package dnsproxy
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	logMaxEntries = 256
+)
+
+var (
+	queryLog     = []*Query{}
+	queryLogLock = sync.Mutex{}
+)
+
+type Query struct {
+	Timestamp time.Time `json:"timestamp"`
+	Client    string    `json:"client"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Route     string    `json:"route"`
+	Server    string    `json:"server"`
+	Rcode     string    `json:"rcode"`
+	Cached    bool      `json:"cached"`
+	Duration  float64   `json:"duration"`
+}
+
+func logQuery(query *Query) {
+	queryLogLock.Lock()
+	queryLog = append(queryLog, query)
+	if len(queryLog) > logMaxEntries {
+		queryLog = queryLog[len(queryLog)-logMaxEntries:]
+	}
+	queryLogLock.Unlock()
+}
+
+func GetLog() (queries []*Query) {
+	queryLogLock.Lock()
+	queries = make([]*Query, len(queryLog))
+	copy(queries, queryLog)
+	queryLogLock.Unlock()
+	return
+}
+
+func ClearLog() {
+	queryLogLock.Lock()
+	queryLog = []*Query{}
+	queryLogLock.Unlock()
+}
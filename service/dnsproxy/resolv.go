@@ -0,0 +1,34 @@
+package dnsproxy
+
+import (
+	"io/ioutil"
+	"net"
+	"strings"
+)
+
+func parseResolvConf(pth, exclude string) (servers []string) {
+	servers = []string{}
+
+	data, err := ioutil.ReadFile(pth)
+	if err != nil {
+		return
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+
+		server := strings.SplitN(fields[1], "%", 2)[0]
+		if net.ParseIP(server) == nil || server == exclude ||
+			server == "127.0.0.53" || server == "127.0.0.54" {
+
+			continue
+		}
+
+		servers = append(servers, server)
+	}
+
+	return
+}
@@ -0,0 +1,82 @@
+package event
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+const bufferSize = 512
+
+var buffer = struct {
+	sync.Mutex
+	events []*Event
+	seq    uint64
+	notify chan bool
+}{
+	events: []*Event{},
+	notify: make(chan bool),
+}
+
+// push buffers a snapshot of the event with the data marshaled at push
+// time, the event data often references live connection state
+func push(evt *Event) {
+	snapshot := &Event{
+		Id:        evt.Id,
+		Type:      evt.Type,
+		ProfileId: evt.ProfileId,
+	}
+	if evt.Data != nil {
+		data, err := json.Marshal(evt.Data)
+		if err == nil {
+			snapshot.Data = json.RawMessage(data)
+		}
+	}
+
+	buffer.Lock()
+	defer buffer.Unlock()
+
+	buffer.seq += 1
+	evt.Seq = buffer.seq
+	snapshot.Seq = buffer.seq
+
+	buffer.events = append(buffer.events, snapshot)
+	if len(buffer.events) > bufferSize {
+		buffer.events = buffer.events[len(buffer.events)-bufferSize:]
+	}
+
+	close(buffer.notify)
+	buffer.notify = make(chan bool)
+}
+
+func LastSeq() uint64 {
+	buffer.Lock()
+	defer buffer.Unlock()
+	return buffer.seq
+}
+
+// Since returns buffered events after seq in order and a channel closed on
+// the next event. Ok is false when events after seq are no longer buffered,
+// all buffered events are then returned.
+func Since(seq uint64) (evts []*Event, notify chan bool, ok bool) {
+	buffer.Lock()
+	defer buffer.Unlock()
+
+	notify = buffer.notify
+	evts = []*Event{}
+
+	if seq > buffer.seq || (len(buffer.events) > 0 &&
+		seq+1 < buffer.events[0].Seq) {
+
+		evts = append(evts, buffer.events...)
+		return
+	}
+
+	ok = true
+	for _, evt := range buffer.events {
+		if evt.Seq > seq {
+			evts = append(evts, evt)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,95 @@
+package event
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSince(t *testing.T) {
+	start := LastSeq()
+
+	evts, notify, ok := Since(start)
+	if !ok || len(evts) != 0 {
+		t.Fatalf("unexpected events %d %t", len(evts), ok)
+	}
+
+	for _, typ := range []string{"one", "two", "three"} {
+		evt := &Event{
+			Type: typ,
+		}
+		evt.Init()
+	}
+
+	select {
+	case <-notify:
+	case <-time.After(time.Second):
+		t.Fatal("expected notify on new event")
+	}
+
+	evts, _, ok = Since(start + 1)
+	if !ok || len(evts) != 2 {
+		t.Fatalf("unexpected events %d %t", len(evts), ok)
+	}
+	if evts[0].Type != "two" || evts[1].Type != "three" {
+		t.Fatalf("unexpected event order %s %s", evts[0].Type, evts[1].Type)
+	}
+	if evts[0].Seq != start+2 || evts[1].Seq != start+3 {
+		t.Fatalf("unexpected event seq %d %d", evts[0].Seq, evts[1].Seq)
+	}
+}
+
+func TestSinceExpired(t *testing.T) {
+	start := LastSeq()
+
+	for i := 0; i < bufferSize+10; i++ {
+		evt := &Event{
+			Type: "update",
+		}
+		evt.Init()
+	}
+
+	evts, _, ok := Since(start + 1)
+	if ok {
+		t.Fatal("expected expired events")
+	}
+	if len(evts) != bufferSize {
+		t.Fatalf("unexpected events %d", len(evts))
+	}
+
+	evts, _, ok = Since(LastSeq() + 100)
+	if ok {
+		t.Fatal("expected unknown seq")
+	}
+	if len(evts) != bufferSize {
+		t.Fatalf("unexpected events %d", len(evts))
+	}
+}
+
+func TestSinceSnapshot(t *testing.T) {
+	start := LastSeq()
+
+	data := map[string]string{
+		"status": "connecting",
+	}
+	evt := &Event{
+		Type: "update",
+		Data: data,
+	}
+	evt.Init()
+
+	data["status"] = "connected"
+
+	evts, _, ok := Since(start)
+	if !ok || len(evts) != 1 {
+		t.Fatalf("unexpected events %d %t", len(evts), ok)
+	}
+
+	evtData, ok := evts[0].Data.(json.RawMessage)
+	if !ok {
+		t.Fatalf("unexpected event data %T", evts[0].Data)
+	}
+	if string(evtData) != `{"status":"connecting"}` {
+		t.Fatalf("unexpected event data %s", evtData)
+	}
+}
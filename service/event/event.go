@@ -20,13 +20,16 @@ var (
 )
 
 type Event struct {
-	Id   string      `json:"id"`
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+	Id        string      `json:"id"`
+	Seq       uint64      `json:"seq"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	ProfileId string      `json:"-"`
 }
 
 func (e *Event) Init() {
 	e.Id = utils.Uuid()
+	push(e)
 
 	listeners.RLock()
 	defer listeners.RUnlock()
@@ -38,7 +41,10 @@ func (e *Event) Init() {
 			defer func() {
 				recover()
 			}()
-			list.stream <- e
+			select {
+			case list.stream <- e:
+			case <-list.done:
+			}
 		}()
 	}
 }
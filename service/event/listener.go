@@ -2,6 +2,7 @@ package event
 
 type Listener struct {
 	stream chan *Event
+	done   chan bool
 }
 
 func (l *Listener) Listen() chan *Event {
@@ -11,15 +12,18 @@ func (l *Listener) Listen() chan *Event {
 	return l.stream
 }
 
+// Close stops delivery to the listener, the stream is left open to avoid
+// racing with pending sends
 func (l *Listener) Close() {
 	listeners.Lock()
 	listeners.s.Remove(l)
 	listeners.Unlock()
-	close(l.stream)
+	close(l.done)
 }
 
 func NewListener() (list *Listener) {
 	list = &Listener{}
 	list.stream = make(chan *Event)
+	list.done = make(chan bool)
 	return
 }
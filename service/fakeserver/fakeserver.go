@@ -0,0 +1,534 @@
+// In-process Pritunl server for testing client authorization and sync.
+package fakeserver
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/certpin"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"golang.org/x/crypto/nacl/box"
+)
+
+type ReqBox struct {
+	DeviceId    string `json:"device_id"`
+	DeviceName  string `json:"device_name"`
+	Platform    string `json:"platform"`
+	Token       string `json:"token"`
+	Nonce       string `json:"nonce"`
+	Password    string `json:"password"`
+	Timestamp   int64  `json:"timestamp"`
+	WgPublicKey string `json:"wg_public_key"`
+	SsoToken    string `json:"sso_token"`
+}
+
+type Request struct {
+	Method string
+	Path   string
+	Handle string
+	Box    *ReqBox
+}
+
+type encryptedKeyBox struct {
+	Data            string `json:"data"`
+	Nonce           string `json:"nonce"`
+	PublicKey       string `json:"public_key"`
+	Signature       string `json:"signature"`
+	DeviceSignature string `json:"device_signature"`
+}
+
+type respBox struct {
+	SsoToken  string `json:"sso_token,omitempty"`
+	SsoUrl    string `json:"sso_url,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+type connData struct {
+	Allow         bool                   `json:"allow"`
+	Reason        string                 `json:"reason"`
+	RegKey        string                 `json:"reg_key"`
+	Token         string                 `json:"token"`
+	Remote        string                 `json:"remote"`
+	Remote6       string                 `json:"remote6"`
+	Configuration map[string]interface{} `json:"configuration"`
+}
+
+type pingData struct {
+	Status    bool `json:"status"`
+	Timestamp int  `json:"timestamp"`
+}
+
+type syncData struct {
+	Signature string `json:"signature"`
+	Conf      string `json:"conf"`
+}
+
+type Server struct {
+	OrgId         string
+	UserId        string
+	ServerId      string
+	SyncToken     string
+	SyncSecret    string
+	Allow         bool
+	Reason        string
+	RegKey        string
+	Configuration map[string]interface{}
+	SsoUrl        string
+	SsoPolls      int
+	BadSignature  bool
+	PingStatus    int
+	SyncStatus    int
+	SyncConf      string
+	lock          sync.Mutex
+	polls         int
+	ssoToken      string
+	requests      []*Request
+	httpServer    *httptest.Server
+	boxPubKey     *[32]byte
+	boxPrivKey    *[32]byte
+	userKey       *rsa.PrivateKey
+}
+
+func (s *Server) URL() string {
+	return s.httpServer.URL
+}
+
+func (s *Server) Host() string {
+	u, _ := url.Parse(s.httpServer.URL)
+	return u.Host
+}
+
+func (s *Server) Port() int {
+	u, _ := url.Parse(s.httpServer.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return port
+}
+
+func (s *Server) BoxPublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.boxPubKey[:])
+}
+
+func (s *Server) SpkiHash() string {
+	return certpin.Hash(s.httpServer.Certificate())
+}
+
+func (s *Server) UserPrivateKey() string {
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(s.userKey),
+	}))
+}
+
+func (s *Server) ProfileData() string {
+	return fmt.Sprintf("setenv UV_ID %s\n"+
+		"setenv UV_NAME fake-device\n"+
+		"<key>\n%s</key>\n", s.UserId, s.UserPrivateKey())
+}
+
+func (s *Server) Requests() (reqs []*Request) {
+	s.lock.Lock()
+	reqs = make([]*Request, len(s.requests))
+	copy(reqs, s.requests)
+	s.lock.Unlock()
+	return
+}
+
+func (s *Server) Polls() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.polls
+}
+
+func (s *Server) Close() {
+	s.httpServer.Close()
+}
+
+func (s *Server) sign(data ...string) string {
+	hashFunc := hmac.New(sha512.New, []byte(s.SyncSecret))
+	hashFunc.Write([]byte(strings.Join(data, "&")))
+	return base64.StdEncoding.EncodeToString(hashFunc.Sum(nil))
+}
+
+func (s *Server) checkAuth(r *http.Request, data ...string) bool {
+	if r.Header.Get("Auth-Token") != s.SyncToken {
+		return false
+	}
+
+	timestamp, err := strconv.ParseInt(
+		r.Header.Get("Auth-Timestamp"), 10, 64)
+	if err != nil ||
+		utils.SinceAbs(time.Unix(timestamp, 0)) > time.Minute {
+
+		return false
+	}
+
+	authData := append([]string{
+		r.Header.Get("Auth-Token"),
+		r.Header.Get("Auth-Timestamp"),
+		r.Header.Get("Auth-Nonce"),
+		r.Method,
+		r.URL.Path,
+	}, data...)
+
+	return subtle.ConstantTimeCompare(
+		[]byte(s.sign(authData...)),
+		[]byte(r.Header.Get("Auth-Signature")),
+	) == 1
+}
+
+func (s *Server) openBox(r *http.Request) (reqBx *ReqBox,
+	clientKey *[32]byte, err error) {
+
+	encBox := &encryptedKeyBox{}
+	err = json.NewDecoder(r.Body).Decode(encBox)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "fakeserver: Failed to parse request box"),
+		}
+		return
+	}
+
+	authData := []string{
+		encBox.Data,
+		encBox.Nonce,
+		encBox.PublicKey,
+		encBox.Signature,
+	}
+	if encBox.DeviceSignature != "" {
+		authData = append(authData, encBox.DeviceSignature)
+	}
+
+	if !s.checkAuth(r, authData...) {
+		err = &errortypes.RequestError{
+			errors.New("fakeserver: Invalid auth signature"),
+		}
+		return
+	}
+
+	reqHash := sha512.Sum512([]byte(strings.Join([]string{
+		encBox.Data,
+		encBox.Nonce,
+		encBox.PublicKey,
+	}, "&")))
+
+	rsaSig, err := base64.StdEncoding.DecodeString(encBox.Signature)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "fakeserver: Failed to decode rsa signature"),
+		}
+		return
+	}
+
+	err = rsa.VerifyPSS(
+		&s.userKey.PublicKey,
+		crypto.SHA512,
+		reqHash[:],
+		rsaSig,
+		&rsa.PSSOptions{
+			SaltLength: 0,
+			Hash:       crypto.SHA512,
+		},
+	)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "fakeserver: Invalid rsa signature"),
+		}
+		return
+	}
+
+	clientKeySl, err := base64.StdEncoding.DecodeString(encBox.PublicKey)
+	if err != nil || len(clientKeySl) != 32 {
+		err = &errortypes.ParseError{
+			errors.New("fakeserver: Invalid client box key"),
+		}
+		return
+	}
+	clientKey = &[32]byte{}
+	copy(clientKey[:], clientKeySl)
+
+	nonceSl, err := base64.StdEncoding.DecodeString(encBox.Nonce)
+	if err != nil || len(nonceSl) != 24 {
+		err = &errortypes.ParseError{
+			errors.New("fakeserver: Invalid box nonce"),
+		}
+		return
+	}
+	var nonce [24]byte
+	copy(nonce[:], nonceSl)
+
+	ciphertext, err := base64.StdEncoding.DecodeString(encBox.Data)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "fakeserver: Failed to decode box data"),
+		}
+		return
+	}
+
+	plaintext, ok := box.Open([]byte{}, ciphertext,
+		&nonce, clientKey, s.boxPrivKey)
+	if !ok {
+		err = &errortypes.ParseError{
+			errors.New("fakeserver: Failed to decrypt request box"),
+		}
+		return
+	}
+
+	reqBx = &ReqBox{}
+	err = json.Unmarshal(plaintext, reqBx)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "fakeserver: Failed to parse request data"),
+		}
+		return
+	}
+
+	return
+}
+
+func (s *Server) sealBox(w http.ResponseWriter, clientKey *[32]byte,
+	data interface{}) {
+
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	var nonce [24]byte
+	_, err = rand.Read(nonce[:])
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	encrypted := box.Seal([]byte{}, plaintext, &nonce, clientKey,
+		s.boxPrivKey)
+
+	respBx := &respBox{
+		Data:  base64.StdEncoding.EncodeToString(encrypted),
+		Nonce: base64.StdEncoding.EncodeToString(nonce[:]),
+	}
+
+	if s.BadSignature {
+		respBx.Signature = s.sign(respBx.Nonce, respBx.Data)
+	} else {
+		respBx.Signature = s.sign(respBx.Data, respBx.Nonce)
+	}
+
+	s.writeJson(w, respBx)
+}
+
+func (s *Server) writeJson(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func (s *Server) handleKey(w http.ResponseWriter, r *http.Request,
+	handle string) {
+
+	reqBx, clientKey, err := s.openBox(r)
+	if err != nil {
+		http.Error(w, err.Error(), 401)
+		return
+	}
+
+	s.lock.Lock()
+	s.requests = append(s.requests, &Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Handle: handle,
+		Box:    reqBx,
+	})
+	s.lock.Unlock()
+
+	if r.Method == "PUT" {
+		if s.PingStatus != 0 && s.PingStatus != 200 {
+			http.Error(w, "ping failed", s.PingStatus)
+			return
+		}
+
+		s.sealBox(w, clientKey, &pingData{
+			Status:    true,
+			Timestamp: int(time.Now().Unix()),
+		})
+		return
+	}
+
+	if strings.HasSuffix(handle, "_wait") {
+		s.lock.Lock()
+		if reqBx.SsoToken == "" || reqBx.SsoToken != s.ssoToken {
+			s.lock.Unlock()
+			http.Error(w, "invalid sso token", 401)
+			return
+		}
+		if s.polls < s.SsoPolls {
+			s.polls += 1
+			s.lock.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			w.WriteHeader(428)
+			return
+		}
+		s.lock.Unlock()
+	} else if s.SsoUrl != "" {
+		ssoToken, e := utils.RandStr(32)
+		if e != nil {
+			http.Error(w, e.Error(), 500)
+			return
+		}
+
+		s.lock.Lock()
+		s.ssoToken = ssoToken
+		s.lock.Unlock()
+
+		s.writeJson(w, &respBox{
+			SsoToken: ssoToken,
+			SsoUrl:   s.SsoUrl,
+		})
+		return
+	}
+
+	data := &connData{
+		Allow:         s.Allow,
+		Reason:        s.Reason,
+		RegKey:        s.RegKey,
+		Configuration: s.Configuration,
+	}
+	if s.Allow && !strings.HasPrefix(handle, "wg") {
+		data.Token = reqBx.Token
+		data.Remote = "127.0.0.1"
+	}
+
+	s.sealBox(w, clientKey, data)
+}
+
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAuth(r) {
+		http.Error(w, "invalid auth signature", 401)
+		return
+	}
+
+	s.lock.Lock()
+	s.requests = append(s.requests, &Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Handle: "sync",
+	})
+	s.lock.Unlock()
+
+	if s.SyncStatus != 0 && s.SyncStatus != 200 {
+		w.WriteHeader(s.SyncStatus)
+		return
+	}
+
+	data := &syncData{
+		Conf: s.SyncConf,
+	}
+	if s.SyncConf != "" {
+		if s.BadSignature {
+			data.Signature = s.sign(s.SyncConf + "\n")
+		} else {
+			data.Signature = s.sign(s.SyncConf)
+		}
+	}
+
+	s.writeJson(w, data)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pathSpl := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(pathSpl) < 5 || pathSpl[0] != "key" {
+		http.NotFound(w, r)
+		return
+	}
+
+	handle := pathSpl[1]
+	if handle == "sync" && len(pathSpl) < 6 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if pathSpl[2] != s.OrgId || pathSpl[3] != s.UserId ||
+		pathSpl[4] != s.ServerId {
+
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case handle == "sync" && r.Method == "GET":
+		s.handleSync(w, r)
+		break
+	case (handle == "wg" && r.Method == "PUT") || (r.Method == "POST" &&
+		(handle == "wg" || handle == "wg_wait" ||
+			handle == "ovpn" || handle == "ovpn_wait")):
+
+		s.handleKey(w, r, handle)
+		break
+	default:
+		http.Error(w, "method not allowed", 405)
+		break
+	}
+}
+
+func New() (s *Server, err error) {
+	boxPubKey, boxPrivKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "fakeserver: Failed to generate box key"),
+		}
+		return
+	}
+
+	userKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "fakeserver: Failed to generate rsa key"),
+		}
+		return
+	}
+
+	syncToken, err := utils.RandStr(32)
+	if err != nil {
+		return
+	}
+
+	syncSecret, err := utils.RandStr(32)
+	if err != nil {
+		return
+	}
+
+	s = &Server{
+		OrgId:      utils.Uuid(),
+		UserId:     utils.Uuid(),
+		ServerId:   utils.Uuid(),
+		SyncToken:  syncToken,
+		SyncSecret: syncSecret,
+		Allow:      true,
+		boxPubKey:  boxPubKey,
+		boxPrivKey: boxPrivKey,
+		userKey:    userKey,
+	}
+	s.httpServer = httptest.NewTLSServer(s)
+
+	return
+}
@@ -20,9 +20,8 @@ var (
 		DisableKeepAlives:   true,
 		TLSHandshakeTimeout: 10 * time.Second,
 		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true, // TODO
-			MinVersion:         tls.VersionTLS12,
-			MaxVersion:         tls.VersionTLS13,
+			MinVersion: tls.VersionTLS12,
+			MaxVersion: tls.VersionTLS13,
 		},
 	}
 	client = &http.Client{
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/connection"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/event"
+	"github.com/pritunl/pritunl-client-electron/service/peercred"
+	"github.com/pritunl/pritunl-client-electron/service/sprofile"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/sirupsen/logrus"
+)
+
+type sprofileOwnerData struct {
+	Owner      string `json:"owner"`
+	OwnerGroup string `json:"owner_group"`
+}
+
+func getCred(c *gin.Context) *peercred.Cred {
+	return peercred.FromContext(c.Request.Context())
+}
+
+// isAdmin allows root and members of the admin group, requests without
+// peer credentials such as the windows tcp listener are not restricted
+func isAdmin(cred *peercred.Cred) bool {
+	if cred == nil {
+		return true
+	}
+	if cred.Uid == 0 {
+		return true
+	}
+	return cred.InGroup(config.Config.AdminGroup)
+}
+
+// isOwner allows the owner and members of the owner group, profiles
+// without an owner such as profiles created before owners were recorded
+// are restricted to admins until an owner is set
+func isOwner(cred *peercred.Cred, owner, ownerGroup string) bool {
+	if owner == "" && ownerGroup == "" {
+		return false
+	}
+	if cred.Uid < 0 {
+		return false
+	}
+	if owner != "" && cred.UidStr() == owner {
+		return true
+	}
+	return cred.InGroup(ownerGroup)
+}
+
+func getOwner(c *gin.Context) string {
+	cred := getCred(c)
+	if cred == nil || cred.Uid < 0 {
+		return ""
+	}
+	return cred.UidStr()
+}
+
+func profileOwner(prflId string) (owner, ownerGroup string, exists bool) {
+	sprfl := sprofile.Get(prflId)
+	if sprfl != nil {
+		owner = sprfl.Owner
+		ownerGroup = sprfl.OwnerGroup
+		exists = true
+		return
+	}
+
+	conn := connection.GlobalStore.Get(prflId)
+	if conn != nil {
+		owner = conn.Profile.Owner
+		ownerGroup = conn.Profile.OwnerGroup
+		exists = true
+	}
+
+	return
+}
+
+func audit(c *gin.Context, cred *peercred.Cred, prflId, action string,
+	allowed bool) {
+
+	fields := logrus.Fields{
+		"audit":      true,
+		"action":     action,
+		"profile_id": prflId,
+		"allowed":    allowed,
+		"method":     c.Request.Method,
+		"path":       c.Request.URL.Path,
+	}
+	if cred != nil {
+		fields["uid"] = cred.Uid
+		fields["gid"] = cred.Gid
+		fields["pid"] = cred.Pid
+	}
+
+	if allowed {
+		logrus.WithFields(fields).Info("handlers: Profile action allowed")
+	} else {
+		logrus.WithFields(fields).Warn("handlers: Profile action denied")
+	}
+}
+
+// authorizeProfile checks the peer is an admin or owner of the profile and
+// writes an audit entry, requests are aborted with a 403 when denied
+func authorizeProfile(c *gin.Context, prflId, action string) bool {
+	cred := getCred(c)
+	owner, ownerGroup, _ := profileOwner(prflId)
+
+	allowed := isAdmin(cred) || isOwner(cred, owner, ownerGroup)
+	audit(c, cred, prflId, action, allowed)
+
+	if !allowed {
+		utils.AbortWithStatus(c, 403)
+	}
+
+	return allowed
+}
+
+// authorizeProfileCreate is authorizeProfile but also allows any peer when
+// the profile does not exist, the peer is recorded as the new owner
+func authorizeProfileCreate(c *gin.Context, prflId, action string) bool {
+	cred := getCred(c)
+	owner, ownerGroup, exists := profileOwner(prflId)
+
+	allowed := isAdmin(cred) || !exists || isOwner(cred, owner, ownerGroup)
+	audit(c, cred, prflId, action, allowed)
+
+	if !allowed {
+		utils.AbortWithStatus(c, 403)
+	}
+
+	return allowed
+}
+
+// profileAllowed returns if the peer is an admin or owner of the profile,
+// used to filter profile data without an audit entry
+func profileAllowed(cred *peercred.Cred, prflId string) bool {
+	if isAdmin(cred) {
+		return true
+	}
+
+	owner, ownerGroup, _ := profileOwner(prflId)
+	return isOwner(cred, owner, ownerGroup)
+}
+
+// eventAllowed returns if the event can be sent to the peer, profile
+// events are limited to admins and owners of the profile
+func eventAllowed(cred *peercred.Cred, evt *event.Event) bool {
+	if evt.ProfileId == "" {
+		return true
+	}
+
+	return profileAllowed(cred, evt.ProfileId)
+}
+
+// authorizeAdmin checks the peer is an admin and writes an audit entry,
+// requests are aborted with a 403 when denied
+func authorizeAdmin(c *gin.Context, prflId, action string) bool {
+	cred := getCred(c)
+
+	allowed := isAdmin(cred)
+	audit(c, cred, prflId, action, allowed)
+
+	if !allowed {
+		utils.AbortWithStatus(c, 403)
+	}
+
+	return allowed
+}
+
+func sprofileOwnerPut(c *gin.Context) {
+	prflId := utils.FilterStr(c.Param("profile_id"))
+	if prflId == "" {
+		err := &errortypes.ParseError{
+			errors.New("handler: Invalid profile ID"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	data := &sprofileOwnerData{}
+
+	err := c.Bind(data)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Bind error"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	if sprofile.Get(prflId) == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
+	owner := strings.TrimSpace(data.Owner)
+	if owner != "" {
+		if _, e := strconv.Atoi(owner); e != nil {
+			usr, e := user.Lookup(owner)
+			if e != nil {
+				err = &errortypes.ParseError{
+					errors.Wrap(e, "handler: Unknown profile owner"),
+				}
+				utils.AbortWithError(c, 400, err)
+				return
+			}
+			owner = usr.Uid
+		}
+	}
+
+	err = sprofile.SetOwner(
+		prflId,
+		owner,
+		strings.TrimSpace(data.OwnerGroup),
+	)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	prfl := sprofile.Get(prflId)
+	if prfl == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
+	c.JSON(200, prfl.Client())
+}
@@ -4,30 +4,40 @@ import (
 	"github.com/dropbox/godropbox/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/connection"
 	"github.com/pritunl/pritunl-client-electron/service/errortypes"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
 )
 
 type configData struct {
-	DisableDnsWatch  bool `json:"disable_dns_watch"`
-	EnableDnsRefresh bool `json:"enable_dns_refresh"`
-	DisableWakeWatch bool `json:"disable_wake_watch"`
-	DisableNetClean  bool `json:"disable_net_clean"`
-	DisableWgDns     bool `json:"disable_wg_dns"`
-	InterfaceMetric  int  `json:"interface_metric"`
+	DisableDnsWatch  bool    `json:"disable_dns_watch"`
+	EnableDnsRefresh bool    `json:"enable_dns_refresh"`
+	DisableWakeWatch bool    `json:"disable_wake_watch"`
+	DisableNetWatch  *bool   `json:"disable_net_watch"`
+	DisableNetClean  bool    `json:"disable_net_clean"`
+	DisableWgDns     bool    `json:"disable_wg_dns"`
+	InterfaceMetric  int     `json:"interface_metric"`
+	ConflictPolicy   *string `json:"conflict_policy"`
 }
 
-func configGet(c *gin.Context) {
-	data := &configData{
+func getConfigData() *configData {
+	disableNetWatch := config.Config.DisableNetWatch
+	conflictPolicy := config.Config.ConflictPolicy
+
+	return &configData{
 		DisableDnsWatch:  config.Config.DisableDnsWatch,
 		EnableDnsRefresh: config.Config.EnableDnsRefresh,
 		DisableWakeWatch: config.Config.DisableWakeWatch,
+		DisableNetWatch:  &disableNetWatch,
 		DisableNetClean:  config.Config.DisableNetClean,
 		DisableWgDns:     config.Config.DisableWgDns,
 		InterfaceMetric:  config.Config.InterfaceMetric,
+		ConflictPolicy:   &conflictPolicy,
 	}
+}
 
-	c.JSON(200, data)
+func configGet(c *gin.Context) {
+	c.JSON(200, getConfigData())
 }
 
 func configPut(c *gin.Context) {
@@ -42,12 +52,37 @@ func configPut(c *gin.Context) {
 		return
 	}
 
+	// Options added after the client ui config are only updated when
+	// present so older clients do not reset them
+	if data.ConflictPolicy != nil {
+		validPolicy := false
+		for _, policy := range connection.ConflictPolicies {
+			if *data.ConflictPolicy == policy {
+				validPolicy = true
+				break
+			}
+		}
+		if !validPolicy {
+			err = &errortypes.ParseError{
+				errors.New("handler: Invalid conflict policy"),
+			}
+			utils.AbortWithError(c, 400, err)
+			return
+		}
+	}
+
 	config.Config.DisableDnsWatch = data.DisableDnsWatch
 	config.Config.EnableDnsRefresh = data.EnableDnsRefresh
 	config.Config.DisableWakeWatch = data.DisableWakeWatch
+	if data.DisableNetWatch != nil {
+		config.Config.DisableNetWatch = *data.DisableNetWatch
+	}
 	config.Config.DisableNetClean = data.DisableNetClean
 	config.Config.DisableWgDns = data.DisableWgDns
 	config.Config.InterfaceMetric = data.InterfaceMetric
+	if data.ConflictPolicy != nil {
+		config.Config.ConflictPolicy = *data.ConflictPolicy
+	}
 
 	err = config.Save()
 	if err != nil {
@@ -55,5 +90,5 @@ func configPut(c *gin.Context) {
 		return
 	}
 
-	c.JSON(200, data)
+	c.JSON(200, getConfigData())
 }
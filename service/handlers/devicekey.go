@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"github.com/dropbox/godropbox/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/tpm"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/sirupsen/logrus"
+)
+
+type deviceKeyData struct {
+	Backend    string `json:"backend"`
+	Passphrase string `json:"passphrase"`
+	Force      bool   `json:"force"`
+}
+
+func deviceKeyGet(c *gin.Context) {
+	c.JSON(200, tpm.GetStatus())
+}
+
+func deviceKeyEnrollPost(c *gin.Context) {
+	data := &deviceKeyData{}
+
+	err := c.Bind(data)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Bind error"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	if !tpm.ValidBackend(data.Backend) {
+		err = &errortypes.ParseError{
+			errors.New("handler: Invalid device key backend"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	pubKey64, err := tpm.Enroll(data.Backend, data.Passphrase, data.Force)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if data.Backend != "" &&
+		data.Backend != config.Config.DeviceKeyBackend {
+
+		config.Config.DeviceKeyBackend = data.Backend
+
+		err = config.Save()
+		if err != nil {
+			utils.AbortWithError(c, 500, err)
+			return
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"backend":    tpm.Backend(),
+		"public_key": pubKey64,
+	}).Info("handler: Device key enrolled")
+
+	c.JSON(200, &tpm.KeyStatus{
+		Backend:   tpm.Backend(),
+		PublicKey: pubKey64,
+	})
+}
+
+func deviceKeyUnlockPost(c *gin.Context) {
+	data := &deviceKeyData{}
+
+	err := c.Bind(data)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Bind error"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	if tpm.Backend() != tpm.BackendSoftware {
+		err = &errortypes.ParseError{
+			errors.New("handler: Device key backend cannot be unlocked"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	err = tpm.UnlockSoftware(data.Passphrase)
+	if err != nil {
+		utils.AbortWithError(c, 401, err)
+		return
+	}
+
+	c.JSON(200, tpm.GetStatus())
+}
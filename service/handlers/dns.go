@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pritunl/pritunl-client-electron/service/dnsproxy"
+)
+
+func dnsGet(c *gin.Context) {
+	c.JSON(200, dnsproxy.GetState())
+}
+
+func dnsDelete(c *gin.Context) {
+	dnsproxy.FlushCache()
+	dnsproxy.ClearLog()
+
+	c.JSON(200, nil)
+}
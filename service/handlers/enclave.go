@@ -3,13 +3,33 @@ package handlers
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/sprofile"
+	"github.com/pritunl/pritunl-client-electron/service/token"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
 )
 
 func resetEnclave(c *gin.Context) {
+	// Rewrite the tokens and profiles with the fallback keys before the
+	// enclave key is removed from the config, the fallback profile and
+	// token secrets are stored in plaintext in the service config and
+	// only protected by the file permissions
+	enclaveKey := config.Config.EnclavePrivateKey
 	config.Config.EnclavePrivateKey = ""
 
-	err := config.Config.Save()
+	err := token.Rekey()
+	if err == nil {
+		err = sprofile.Rekey()
+	}
+	if err != nil {
+		config.Config.EnclavePrivateKey = enclaveKey
+		_ = token.Rekey()
+		_ = sprofile.Rekey()
+
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	err = config.Config.Save()
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
 		return
@@ -1,14 +1,19 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"time"
 
+	"github.com/dropbox/godropbox/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/pritunl/pritunl-client-electron/service/connection"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
 	"github.com/pritunl/pritunl-client-electron/service/event"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
 	"github.com/pritunl/pritunl-client-electron/service/watch"
@@ -33,6 +38,7 @@ var (
 )
 
 func eventsGet(c *gin.Context) {
+	cred := getCred(c)
 	event.LastPong = time.Now()
 
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -97,6 +103,10 @@ func eventsGet(c *gin.Context) {
 				return
 			}
 
+			if !eventAllowed(cred, evt) {
+				continue
+			}
+
 			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
 			err = conn.WriteJSON(evt)
 			if err != nil {
@@ -115,3 +125,116 @@ func eventsGet(c *gin.Context) {
 		}
 	}
 }
+
+func writeStreamEvent(c *gin.Context, ctrl *http.ResponseController,
+	evt *event.Event) (err error) {
+
+	data, err := json.Marshal(evt)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "events: Failed to marshal event"),
+		}
+		return
+	}
+
+	_ = ctrl.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	if evt.Seq != 0 {
+		_, err = fmt.Fprintf(c.Writer, "id: %d\n", evt.Seq)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func eventsStreamGet(c *gin.Context) {
+	cred := getCred(c)
+	lastSeq := event.LastSeq()
+
+	lastId := c.Request.Header.Get("Last-Event-ID")
+	if lastId == "" {
+		lastId = c.Query("last_event_id")
+	}
+	if lastId != "" {
+		seq, err := strconv.ParseUint(lastId, 10, 64)
+		if err != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(err, "events: Invalid last event ID"),
+			}
+			utils.AbortWithError(c, 400, err)
+			return
+		}
+		lastSeq = seq
+	}
+
+	ctrl := http.NewResponseController(c.Writer)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(200)
+
+	_ = ctrl.SetWriteDeadline(time.Now().Add(writeTimeout))
+	err := ctrl.Flush()
+	if err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		evts, notify, ok := event.Since(lastSeq)
+		if !ok {
+			err = writeStreamEvent(c, ctrl, &event.Event{
+				Type: "reset",
+			})
+			if err != nil {
+				return
+			}
+			lastSeq = 0
+		}
+
+		for _, evt := range evts {
+			lastSeq = evt.Seq
+			if !eventAllowed(cred, evt) {
+				continue
+			}
+
+			err = writeStreamEvent(c, ctrl, evt)
+			if err != nil {
+				return
+			}
+		}
+
+		if len(evts) > 0 || !ok {
+			err = ctrl.Flush()
+			if err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-notify:
+		case <-ticker.C:
+			_ = ctrl.SetWriteDeadline(time.Now().Add(writeTimeout))
+			_, err = c.Writer.WriteString(": ping\n\n")
+			if err != nil {
+				return
+			}
+			err = ctrl.Flush()
+			if err != nil {
+				return
+			}
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
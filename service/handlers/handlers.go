@@ -8,9 +8,69 @@ import (
 	"github.com/dropbox/godropbox/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/pritunl/pritunl-client-electron/service/auth"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
 	"github.com/sirupsen/logrus"
 )
 
+type routePerm struct {
+	Admin  bool
+	Action string
+}
+
+// routePerms lists the permission for each route, routes not listed are
+// denied. Admin routes are checked and audited by the auth handler, other
+// routes are open to any peer and check profile access in the handler.
+var routePerms = map[string]routePerm{
+	"GET /events":                          {false, "events_read"},
+	"GET /events/stream":                   {false, "events_read"},
+	"GET /config":                          {false, "config_read"},
+	"PUT /config":                          {true, "config_update"},
+	"POST /network/reset_dns":              {true, "network_reset_dns"},
+	"POST /network/reset_all":              {true, "network_reset_all"},
+	"GET /network/conflicts":               {false, "network_conflicts"},
+	"POST /reset_enclave":                  {true, "enclave_reset"},
+	"GET /profile":                         {false, "profile_read"},
+	"GET /profile/:profile_id":             {false, "profile_read"},
+	"POST /profile":                        {false, "profile_start"},
+	"DELETE /profile":                      {false, "profile_stop"},
+	"DELETE /profile/:profile_id":          {false, "profile_stop"},
+	"GET /sprofile":                        {false, "sprofile_read"},
+	"GET /sprofile/:profile_id":            {false, "sprofile_read"},
+	"PUT /sprofile":                        {false, "sprofile_put"},
+	"DELETE /sprofile":                     {false, "sprofile_delete"},
+	"DELETE /sprofile/:profile_id":         {false, "sprofile_delete"},
+	"PUT /sprofile/:profile_id/split":      {true, "sprofile_split"},
+	"PUT /sprofile/:profile_id/lockdown":   {true, "sprofile_lockdown"},
+	"PUT /sprofile/:profile_id/hooks":      {true, "sprofile_hooks"},
+	"PUT /sprofile/:profile_id/reconnect":  {false, "sprofile_reconnect"},
+	"GET /sprofile/:profile_id/credential": {false, "sprofile_credential_input"},
+	"PUT /sprofile/:profile_id/credential": {true, "sprofile_credential"},
+	"PUT /sprofile/:profile_id/owner":      {true, "sprofile_owner"},
+	"GET /sprofile/:profile_id/log":        {false, "sprofile_log_read"},
+	"DELETE /sprofile/:profile_id/log":     {false, "sprofile_log_clear"},
+	"GET /sprofile/:profile_id/history":    {false, "sprofile_history_read"},
+	"GET /log/query":                       {false, "log_query"},
+	"GET /log/:log_id":                     {false, "log_read"},
+	"DELETE /log/:log_id":                  {false, "log_clear"},
+	"PUT /token":                           {false, "token_update"},
+	"DELETE /token":                        {false, "token_clear"},
+	"DELETE /token/:profile_id":            {false, "token_clear"},
+	"POST /tpm/callback":                   {true, "tpm_callback"},
+	"GET /device_key":                      {true, "device_key_read"},
+	"POST /device_key/enroll":              {true, "device_key_enroll"},
+	"POST /device_key/unlock":              {true, "device_key_unlock"},
+	"GET /ping":                            {false, "ping"},
+	"POST /stop":                           {true, "service_stop"},
+	"POST /cleanup":                        {true, "service_cleanup"},
+	"POST /restart":                        {true, "service_restart"},
+	"GET /status":                          {false, "status_read"},
+	"GET /state":                           {false, "state_read"},
+	"GET /metrics":                         {true, "metrics_read"},
+	"GET /dns":                             {true, "dns_read"},
+	"DELETE /dns":                          {true, "dns_clear"},
+	"POST /wakeup":                         {true, "wakeup"},
+}
+
 func Recovery(c *gin.Context) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -50,6 +110,30 @@ func Auth(c *gin.Context) {
 		c.AbortWithStatus(401)
 		return
 	}
+
+	route := c.Request.Method + " " + c.FullPath()
+	perm, ok := routePerms[route]
+	if !ok {
+		if c.FullPath() == "" {
+			c.AbortWithStatus(404)
+		} else {
+			c.AbortWithStatus(403)
+		}
+		return
+	}
+
+	if perm.Admin {
+		cred := getCred(c)
+		allowed := isAdmin(cred)
+		audit(c, cred, utils.FilterStr(c.Param("profile_id")),
+			perm.Action, allowed)
+
+		if !allowed {
+			c.AbortWithStatus(403)
+			return
+		}
+	}
+
 	c.Next()
 }
 
@@ -59,10 +143,12 @@ func Register(engine *gin.Engine) {
 	engine.Use(Errors)
 
 	engine.GET("/events", eventsGet)
+	engine.GET("/events/stream", eventsStreamGet)
 	engine.GET("/config", configGet)
 	engine.PUT("/config", configPut)
 	engine.POST("/network/reset_dns", networkDnsReset)
 	engine.POST("/network/reset_all", networkAllReset)
+	engine.GET("/network/conflicts", networkConflictsGet)
 	engine.POST("/reset_enclave", resetEnclave)
 	engine.GET("/profile", profilesGet)
 	engine.GET("/profile/:profile_id", profileGet)
@@ -74,21 +160,36 @@ func Register(engine *gin.Engine) {
 	engine.PUT("/sprofile", sprofilePut)
 	engine.DELETE("/sprofile", sprofileDel)
 	engine.DELETE("/sprofile/:profile_id", sprofileDel2)
+	engine.PUT("/sprofile/:profile_id/split", sprofileSplitPut)
+	engine.PUT("/sprofile/:profile_id/lockdown", sprofileLockdownPut)
+	engine.PUT("/sprofile/:profile_id/hooks", sprofileHooksPut)
+	engine.PUT("/sprofile/:profile_id/reconnect", sprofileReconnectPut)
+	engine.GET("/sprofile/:profile_id/credential", sprofileCredentialGet)
+	engine.PUT("/sprofile/:profile_id/credential", sprofileCredentialPut)
+	engine.PUT("/sprofile/:profile_id/owner", sprofileOwnerPut)
 	// TODO classic client
 	engine.GET("/sprofile/:profile_id/log", sprofileLogGet)
 	// TODO classic client
 	engine.DELETE("/sprofile/:profile_id/log", sprofileLogDel)
+	engine.GET("/sprofile/:profile_id/history", sprofileHistoryGet)
+	engine.GET("/log/query", logQueryGet)
 	engine.GET("/log/:log_id", logGet)
 	engine.DELETE("/log/:log_id", logDel)
 	engine.PUT("/token", tokenPut)
 	engine.DELETE("/token", tokenDelete)
 	engine.DELETE("/token/:profile_id", tokenDelete2)
 	engine.POST("/tpm/callback", tpmCallbackPost)
+	engine.GET("/device_key", deviceKeyGet)
+	engine.POST("/device_key/enroll", deviceKeyEnrollPost)
+	engine.POST("/device_key/unlock", deviceKeyUnlockPost)
 	engine.GET("/ping", pingGet)
 	engine.POST("/stop", stopPost)
 	engine.POST("/cleanup", cleanupPost)
 	engine.POST("/restart", restartPost)
 	engine.GET("/status", statusGet)
 	engine.GET("/state", stateGet)
+	engine.GET("/metrics", metricsGet)
+	engine.GET("/dns", dnsGet)
+	engine.DELETE("/dns", dnsDelete)
 	engine.POST("/wakeup", wakeupPost)
 }
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoutePerms(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	engine := gin.New()
+	Register(engine)
+
+	routes := map[string]bool{}
+	for _, route := range engine.Routes() {
+		key := route.Method + " " + route.Path
+		routes[key] = true
+
+		if _, ok := routePerms[key]; !ok {
+			t.Errorf("handlers: Missing permission for route %s", key)
+		}
+	}
+
+	for key := range routePerms {
+		if !routes[key] {
+			t.Errorf("handlers: Permission for unknown route %s", key)
+		}
+	}
+
+	for _, key := range []string{
+		"POST /device_key/unlock",
+		"GET /dns",
+		"DELETE /dns",
+		"POST /tpm/callback",
+		"POST /wakeup",
+		"GET /metrics",
+	} {
+		if !routePerms[key].Admin {
+			t.Errorf("handlers: Route %s should be admin only", key)
+		}
+	}
+}
@@ -1,13 +1,40 @@
 package handlers
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/dropbox/godropbox/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/pritunl/pritunl-client-electron/service/errortypes"
 	"github.com/pritunl/pritunl-client-electron/service/log"
+	"github.com/pritunl/pritunl-client-electron/service/logger"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/sirupsen/logrus"
 )
 
+func parseLogTime(val string) (tm time.Time, err error) {
+	if val == "" {
+		return
+	}
+
+	unix, e := strconv.ParseInt(val, 10, 64)
+	if e == nil {
+		tm = time.Unix(unix, 0)
+		return
+	}
+
+	tm, err = time.Parse(time.RFC3339, val)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Invalid log time"),
+		}
+		return
+	}
+
+	return
+}
+
 func logGet(c *gin.Context) {
 	logId := utils.FilterStr(c.Param("log_id"))
 	if logId == "" {
@@ -18,6 +45,14 @@ func logGet(c *gin.Context) {
 		return
 	}
 
+	if logId == "service" {
+		if !authorizeAdmin(c, "", "log_read") {
+			return
+		}
+	} else if !authorizeProfile(c, logId, "log_read") {
+		return
+	}
+
 	var err error
 	var data string
 
@@ -48,6 +83,14 @@ func logDel(c *gin.Context) {
 		return
 	}
 
+	if logId == "service" {
+		if !authorizeAdmin(c, "", "log_clear") {
+			return
+		}
+	} else if !authorizeProfile(c, logId, "log_clear") {
+		return
+	}
+
 	if logId == "service" {
 		err := utils.ClearServiceLog()
 		if err != nil {
@@ -64,3 +107,63 @@ func logDel(c *gin.Context) {
 
 	c.JSON(200, nil)
 }
+
+func logQueryGet(c *gin.Context) {
+	query := &logger.Query{
+		Level:     utils.FilterStr(c.Query("level")),
+		ProfileId: utils.FilterStr(c.Query("profile_id")),
+		StateId:   utils.FilterStr(c.Query("state_id")),
+	}
+
+	if query.ProfileId != "" {
+		if !authorizeProfile(c, query.ProfileId, "log_query") {
+			return
+		}
+	} else if !authorizeAdmin(c, "", "log_query") {
+		return
+	}
+
+	if query.Level != "" {
+		_, err := logrus.ParseLevel(query.Level)
+		if err != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(err, "handler: Invalid log level"),
+			}
+			utils.AbortWithError(c, 400, err)
+			return
+		}
+	}
+
+	var err error
+	query.Start, err = parseLogTime(c.Query("start"))
+	if err != nil {
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	query.End, err = parseLogTime(c.Query("end"))
+	if err != nil {
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	limit := c.Query("limit")
+	if limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(err, "handler: Invalid log limit"),
+			}
+			utils.AbortWithError(c, 400, err)
+			return
+		}
+	}
+
+	entries, err := logger.QueryLog(query)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, entries)
+}
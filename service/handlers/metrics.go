@@ -0,0 +1,10 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pritunl/pritunl-client-electron/service/metrics"
+)
+
+func metricsGet(c *gin.Context) {
+	c.Data(200, "text/plain; version=0.0.4; charset=utf-8", metrics.Export())
+}
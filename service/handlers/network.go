@@ -3,7 +3,9 @@ package handlers
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/pritunl/pritunl-client-electron/service/connection"
+	"github.com/pritunl/pritunl-client-electron/service/lockdown"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/sirupsen/logrus"
 )
 
 func networkDnsReset(c *gin.Context) {
@@ -19,7 +21,34 @@ func networkAllReset(c *gin.Context) {
 	utils.ResetNetworking()
 	utils.ClearDNSCache()
 
+	err := lockdown.Clear()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("handlers: Failed to clear lockdown rules")
+	}
+
 	_ = connection.RestartProfiles(true)
 
 	c.JSON(200, nil)
 }
+
+func networkConflictsGet(c *gin.Context) {
+	data := connection.GetConflicts()
+
+	// Conflicts include the routes and dns servers of both profiles
+	cred := getCred(c)
+	if !isAdmin(cred) {
+		conflicts := []*connection.Conflict{}
+		for _, conflict := range data.Conflicts {
+			if profileAllowed(cred, conflict.Id) &&
+				profileAllowed(cred, conflict.ConflictId) {
+
+				conflicts = append(conflicts, conflict)
+			}
+		}
+		data.Conflicts = conflicts
+	}
+
+	c.JSON(200, data)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/dropbox/godropbox/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/pritunl/pritunl-client-electron/service/connection"
+	"github.com/pritunl/pritunl-client-electron/service/credential"
 	"github.com/pritunl/pritunl-client-electron/service/errortypes"
 	"github.com/pritunl/pritunl-client-electron/service/sprofile"
 	"github.com/pritunl/pritunl-client-electron/service/types"
@@ -37,16 +38,31 @@ type profileData struct {
 	DisableDns         bool                        `json:"disable_dns"`
 	RestrictClient     bool                        `json:"restrict_client"`
 	ForceDns           bool                        `json:"force_dns"`
+	Lockdown           bool                        `json:"lockdown"`
+	SplitInclude       []string                    `json:"split_include"`
+	SplitExclude       []string                    `json:"split_exclude"`
 	SsoAuth            bool                        `json:"sso_auth"`
 	ServerPublicKey    string                      `json:"server_public_key"`
 	ServerBoxPublicKey string                      `json:"server_box_public_key"`
+	ServerSpkiHash     []string                    `json:"server_spki_hash"`
 	TokenTtl           int                         `json:"token_ttl"`
 	Reconnect          bool                        `json:"reconnect"`
+	ReconnectPolicy    *types.ReconnectPolicy      `json:"reconnect_policy"`
 	Timeout            bool                        `json:"timeout"`
+	CredentialOutput   string                      `json:"credential_output"`
 }
 
 func profilesGet(c *gin.Context) {
-	c.JSON(200, connection.GlobalStore.GetAllData())
+	cred := getCred(c)
+
+	prfls := connection.GlobalStore.GetAllData()
+	for prflId := range prfls {
+		if !profileAllowed(cred, prflId) {
+			delete(prfls, prflId)
+		}
+	}
+
+	c.JSON(200, prfls)
 }
 
 func profileGet(c *gin.Context) {
@@ -59,6 +75,10 @@ func profileGet(c *gin.Context) {
 		return
 	}
 
+	if !authorizeProfile(c, prflId, "profile_read") {
+		return
+	}
+
 	prfl := connection.GlobalStore.GetData(prflId)
 	if prfl == nil {
 		utils.AbortWithStatus(c, 404)
@@ -89,8 +109,23 @@ func profilePost(c *gin.Context) {
 		return
 	}
 
+	if !authorizeProfileCreate(c, data.Id, "profile_start") {
+		return
+	}
+
 	sprfl := sprofile.Get(data.Id)
 	if sprfl != nil {
+		if data.Password == "" && data.CredentialOutput != "" {
+			data.Password, err = credential.ParseResponse(
+				[]byte(data.CredentialOutput),
+				credential.Parts(sprfl.PasswordMode),
+			)
+			if err != nil {
+				utils.AbortWithError(c, 400, err)
+				return
+			}
+		}
+
 		err = sprofile.Activate(data.Id, data.Mode, data.Password)
 		if err != nil {
 			utils.AbortWithError(c, 500, err)
@@ -101,8 +136,25 @@ func profilePost(c *gin.Context) {
 		return
 	}
 
+	cred := getCred(c)
+	if !isAdmin(cred) && (data.Lockdown ||
+		len(filterSplitEntries(data.SplitInclude)) > 0 ||
+		len(filterSplitEntries(data.SplitExclude)) > 0) {
+
+		audit(c, cred, data.Id, "profile_admin_options", false)
+		utils.AbortWithStatus(c, 403)
+		return
+	}
+
+	owner := getOwner(c)
+	ownerGroup := ""
+
 	conn := connection.GlobalStore.Get(data.Id)
 	if conn != nil {
+		if conn.Profile.Owner != "" || conn.Profile.OwnerGroup != "" {
+			owner = conn.Profile.Owner
+			ownerGroup = conn.Profile.OwnerGroup
+		}
 		conn.StopWait()
 	}
 
@@ -128,11 +180,18 @@ func profilePost(c *gin.Context) {
 		DisableDns:         data.DisableDns,
 		RestrictClient:     data.RestrictClient,
 		ForceDns:           data.ForceDns,
+		Lockdown:           data.Lockdown,
+		SplitInclude:       filterSplitEntries(data.SplitInclude),
+		SplitExclude:       filterSplitEntries(data.SplitExclude),
 		SsoAuth:            data.SsoAuth,
 		ServerPublicKey:    data.ServerPublicKey,
 		ServerBoxPublicKey: data.ServerBoxPublicKey,
+		ServerSpkiHash:     data.ServerSpkiHash,
 		TokenTtl:           data.TokenTtl,
 		Reconnect:          data.Reconnect,
+		ReconnectPolicy:    data.ReconnectPolicy,
+		Owner:              owner,
+		OwnerGroup:         ownerGroup,
 	}
 
 	conn, err = connection.NewConnection(prfl)
@@ -184,6 +243,10 @@ func profileDel(c *gin.Context) {
 		return
 	}
 
+	if !authorizeProfile(c, prflId, "profile_stop") {
+		return
+	}
+
 	connection.GlobalStore.SetStop(prflId)
 
 	sprfl := sprofile.Get(prflId)
@@ -211,6 +274,10 @@ func profileDel2(c *gin.Context) {
 		return
 	}
 
+	if !authorizeProfile(c, prflId, "profile_stop") {
+		return
+	}
+
 	connection.GlobalStore.SetStop(prflId)
 
 	sprfl := sprofile.Get(prflId)
@@ -1,15 +1,44 @@
 package handlers
 
 import (
+	"strings"
+
 	"github.com/dropbox/godropbox/errors"
 	"github.com/gin-gonic/gin"
+	"github.com/pritunl/pritunl-client-electron/service/certpin"
 	"github.com/pritunl/pritunl-client-electron/service/connection"
 	"github.com/pritunl/pritunl-client-electron/service/errortypes"
 	"github.com/pritunl/pritunl-client-electron/service/sprofile"
+	"github.com/pritunl/pritunl-client-electron/service/token"
 	"github.com/pritunl/pritunl-client-electron/service/types"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
 )
 
+type sprofileSplitData struct {
+	SplitInclude []string `json:"split_include"`
+	SplitExclude []string `json:"split_exclude"`
+}
+
+type sprofileLockdownData struct {
+	Lockdown bool `json:"lockdown"`
+}
+
+type sprofileHooksData struct {
+	PreConnectHook     string `json:"pre_connect_hook"`
+	PostConnectHook    string `json:"post_connect_hook"`
+	PreDisconnectHook  string `json:"pre_disconnect_hook"`
+	PostDisconnectHook string `json:"post_disconnect_hook"`
+	HookTimeout        int    `json:"hook_timeout"`
+}
+
+type sprofileCredentialData struct {
+	CredentialHelper string `json:"credential_helper"`
+}
+
+type sprofileCredentialInput struct {
+	Input string `json:"input"`
+}
+
 type sprofileData struct {
 	Id                 string                      `json:"id"`
 	Name               string                      `json:"name"`
@@ -33,6 +62,9 @@ type sprofileData struct {
 	DisableDns         bool                        `json:"disable_dns"`
 	RestrictClient     bool                        `json:"restrict_client"`
 	ForceDns           bool                        `json:"force_dns"`
+	Lockdown           *bool                       `json:"lockdown"`
+	SplitInclude       []string                    `json:"split_include"`
+	SplitExclude       []string                    `json:"split_exclude"`
 	SsoAuth            bool                        `json:"sso_auth"`
 	PasswordMode       string                      `json:"password_mode"`
 	Token              bool                        `json:"token"`
@@ -45,6 +77,7 @@ type sprofileData struct {
 	SyncToken          string                      `json:"sync_token"`
 	ServerPublicKey    []string                    `json:"server_public_key"`
 	ServerBoxPublicKey string                      `json:"server_box_public_key"`
+	ServerSpkiHash     []string                    `json:"server_spki_hash"`
 	RegistrationKey    string                      `json:"registration_key"`
 	OvpnData           string                      `json:"ovpn_data"`
 }
@@ -62,6 +95,17 @@ func sprofilesGet(c *gin.Context) {
 		return
 	}
 
+	cred := getCred(c)
+	if !isAdmin(cred) {
+		ownPrfls := []*sprofile.SprofileClient{}
+		for _, prfl := range prfls {
+			if isOwner(cred, prfl.Owner, prfl.OwnerGroup) {
+				ownPrfls = append(ownPrfls, prfl)
+			}
+		}
+		prfls = ownPrfls
+	}
+
 	c.JSON(200, prfls)
 }
 
@@ -75,6 +119,10 @@ func sprofileGet(c *gin.Context) {
 		return
 	}
 
+	if !authorizeProfile(c, prflId, "sprofile_read") {
+		return
+	}
+
 	prfl := sprofile.Get(prflId)
 	if prfl == nil {
 		utils.AbortWithStatus(c, 505)
@@ -105,6 +153,10 @@ func sprofilePut(c *gin.Context) {
 		return
 	}
 
+	if !authorizeProfileCreate(c, data.Id, "sprofile_put") {
+		return
+	}
+
 	prfl := &sprofile.Sprofile{
 		Id:                 data.Id,
 		Name:               data.Name,
@@ -143,12 +195,318 @@ func sprofilePut(c *gin.Context) {
 		OvpnData:           data.OvpnData,
 	}
 
+	curPrfl := sprofile.Get(prfl.Id)
+	if curPrfl != nil {
+		prfl.PreConnectHook = curPrfl.PreConnectHook
+		prfl.PostConnectHook = curPrfl.PostConnectHook
+		prfl.PreDisconnectHook = curPrfl.PreDisconnectHook
+		prfl.PostDisconnectHook = curPrfl.PostDisconnectHook
+		prfl.HookTimeout = curPrfl.HookTimeout
+		prfl.ReconnectPolicy = curPrfl.ReconnectPolicy
+		prfl.CredentialHelper = curPrfl.CredentialHelper
+		prfl.Owner = curPrfl.Owner
+		prfl.OwnerGroup = curPrfl.OwnerGroup
+		prfl.ManagedPath = curPrfl.ManagedPath
+		prfl.ManagedHash = curPrfl.ManagedHash
+	} else {
+		prfl.Owner = getOwner(c)
+	}
+
+	cred := getCred(c)
+	if !isAdmin(cred) && adminOptionsChanged(curPrfl, data) {
+		audit(c, cred, prfl.Id, "sprofile_admin_options", false)
+		utils.AbortWithStatus(c, 403)
+		return
+	}
+
+	pinChanged := mergeSprofileOptions(prfl, curPrfl, data)
+
 	err = prfl.Commit()
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
 		return
 	}
 
+	if pinChanged {
+		certpin.Clear(prfl.Id)
+	}
+
+	c.JSON(200, prfl.Client())
+}
+
+func sprofileSplitPut(c *gin.Context) {
+	prflId := utils.FilterStr(c.Param("profile_id"))
+	if prflId == "" {
+		err := &errortypes.ParseError{
+			errors.New("handler: Invalid profile ID"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	data := &sprofileSplitData{}
+
+	err := c.Bind(data)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Bind error"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	include := filterSplitEntries(data.SplitInclude)
+	exclude := filterSplitEntries(data.SplitExclude)
+
+	if sprofile.Get(prflId) == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
+	err = sprofile.SetSplit(prflId, include, exclude)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	conn := connection.GlobalStore.Get(prflId)
+	if conn != nil {
+		conn.SetSplitTunnel(include, exclude)
+	}
+
+	prfl := sprofile.Get(prflId)
+	if prfl == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
+	c.JSON(200, prfl.Client())
+}
+
+func sprofileLockdownPut(c *gin.Context) {
+	prflId := utils.FilterStr(c.Param("profile_id"))
+	if prflId == "" {
+		err := &errortypes.ParseError{
+			errors.New("handler: Invalid profile ID"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	data := &sprofileLockdownData{}
+
+	err := c.Bind(data)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Bind error"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	if sprofile.Get(prflId) == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
+	err = sprofile.SetLockdown(prflId, data.Lockdown)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	prfl := sprofile.Get(prflId)
+	if prfl == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
+	c.JSON(200, prfl.Client())
+}
+
+func sprofileHooksPut(c *gin.Context) {
+	prflId := utils.FilterStr(c.Param("profile_id"))
+	if prflId == "" {
+		err := &errortypes.ParseError{
+			errors.New("handler: Invalid profile ID"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	data := &sprofileHooksData{}
+
+	err := c.Bind(data)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Bind error"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	if data.HookTimeout < 0 || data.HookTimeout > 600 {
+		err = &errortypes.ParseError{
+			errors.New("handler: Invalid hook timeout"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	if sprofile.Get(prflId) == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
+	err = sprofile.SetHooks(
+		prflId,
+		strings.TrimSpace(data.PreConnectHook),
+		strings.TrimSpace(data.PostConnectHook),
+		strings.TrimSpace(data.PreDisconnectHook),
+		strings.TrimSpace(data.PostDisconnectHook),
+		data.HookTimeout,
+	)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	prfl := sprofile.Get(prflId)
+	if prfl == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
+	c.JSON(200, prfl.Client())
+}
+
+func sprofileReconnectPut(c *gin.Context) {
+	prflId := utils.FilterStr(c.Param("profile_id"))
+	if prflId == "" {
+		err := &errortypes.ParseError{
+			errors.New("handler: Invalid profile ID"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	if !authorizeProfile(c, prflId, "sprofile_reconnect") {
+		return
+	}
+
+	data := &types.ReconnectPolicy{}
+
+	err := c.Bind(data)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Bind error"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	err = connection.ValidateReconnectPolicy(data)
+	if err != nil {
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	if sprofile.Get(prflId) == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
+	if data.Backoff == 0 && data.BackoffMax == 0 && data.Multiplier == 0 &&
+		data.Jitter == 0 && data.MaxAttempts == 0 && data.Window == 0 &&
+		len(data.Rules) == 0 {
+
+		data = nil
+	}
+
+	err = sprofile.SetReconnectPolicy(prflId, data)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	prfl := sprofile.Get(prflId)
+	if prfl == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
+	c.JSON(200, prfl.Client())
+}
+
+// sprofileCredentialGet returns the credential helper input for clients
+// that run a helper as the user, the helper output is returned in the
+// credential_output field when starting the profile
+func sprofileCredentialGet(c *gin.Context) {
+	prflId := utils.FilterStr(c.Param("profile_id"))
+	if prflId == "" {
+		err := &errortypes.ParseError{
+			errors.New("handler: Invalid profile ID"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	if !authorizeProfile(c, prflId, "sprofile_credential_input") {
+		return
+	}
+
+	prfl := sprofile.Get(prflId)
+	if prfl == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
+	c.JSON(200, &sprofileCredentialInput{
+		Input: string(prfl.CredentialRequest().Marshal()),
+	})
+}
+
+func sprofileCredentialPut(c *gin.Context) {
+	prflId := utils.FilterStr(c.Param("profile_id"))
+	if prflId == "" {
+		err := &errortypes.ParseError{
+			errors.New("handler: Invalid profile ID"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	data := &sprofileCredentialData{}
+
+	err := c.Bind(data)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Bind error"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	if sprofile.Get(prflId) == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
+	err = sprofile.SetCredentialHelper(
+		prflId,
+		strings.TrimSpace(data.CredentialHelper),
+	)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	prfl := sprofile.Get(prflId)
+	if prfl == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
 	c.JSON(200, prfl.Client())
 }
 
@@ -173,6 +531,10 @@ func sprofileDel(c *gin.Context) {
 		return
 	}
 
+	if !authorizeProfile(c, prflId, "sprofile_delete") {
+		return
+	}
+
 	connection.GlobalStore.SetStop(prflId)
 
 	conn := connection.GlobalStore.Get(prflId)
@@ -181,6 +543,7 @@ func sprofileDel(c *gin.Context) {
 	}
 
 	sprofile.Remove(prflId)
+	token.Clear(prflId)
 
 	c.JSON(200, nil)
 }
@@ -195,6 +558,10 @@ func sprofileDel2(c *gin.Context) {
 		return
 	}
 
+	if !authorizeProfile(c, prflId, "sprofile_delete") {
+		return
+	}
+
 	connection.GlobalStore.SetStop(prflId)
 
 	conn := connection.GlobalStore.Get(prflId)
@@ -203,6 +570,7 @@ func sprofileDel2(c *gin.Context) {
 	}
 
 	sprofile.Remove(prflId)
+	token.Clear(prflId)
 
 	c.JSON(200, nil)
 }
@@ -217,6 +585,10 @@ func sprofileLogGet(c *gin.Context) {
 		return
 	}
 
+	if !authorizeProfile(c, prflId, "sprofile_log_read") {
+		return
+	}
+
 	sprfl := sprofile.Get(prflId)
 	if sprfl == nil {
 		utils.AbortWithStatus(c, 404)
@@ -232,6 +604,35 @@ func sprofileLogGet(c *gin.Context) {
 	c.String(200, output)
 }
 
+func sprofileHistoryGet(c *gin.Context) {
+	prflId := utils.FilterStr(c.Param("profile_id"))
+	if prflId == "" {
+		err := &errortypes.ParseError{
+			errors.New("handler: Invalid profile ID"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	if !authorizeProfile(c, prflId, "sprofile_history_read") {
+		return
+	}
+
+	sprfl := sprofile.Get(prflId)
+	if sprfl == nil {
+		utils.AbortWithStatus(c, 404)
+		return
+	}
+
+	sessions, err := sprfl.GetHistory()
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, sessions)
+}
+
 func sprofileLogDel(c *gin.Context) {
 	prflId := utils.FilterStr(c.Param("profile_id"))
 	if prflId == "" {
@@ -242,6 +643,10 @@ func sprofileLogDel(c *gin.Context) {
 		return
 	}
 
+	if !authorizeProfile(c, prflId, "sprofile_log_clear") {
+		return
+	}
+
 	err := sprofile.ClearLog(prflId)
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
@@ -250,3 +655,92 @@ func sprofileLogDel(c *gin.Context) {
 
 	c.JSON(200, nil)
 }
+
+// mergeSprofileOptions sets the options that are kept from the current
+// profile when the request omits them. A changed server pin replaces the
+// pin and clears the captured host pins.
+func mergeSprofileOptions(prfl, curPrfl *sprofile.Sprofile,
+	data *sprofileData) (pinChanged bool) {
+
+	if curPrfl != nil {
+		prfl.Lockdown = curPrfl.Lockdown
+		prfl.SplitInclude = curPrfl.SplitInclude
+		prfl.SplitExclude = curPrfl.SplitExclude
+		prfl.ServerSpkiHash = curPrfl.ServerSpkiHash
+		prfl.HostSpkiHash = curPrfl.HostSpkiHash
+	}
+
+	if data.Lockdown != nil {
+		prfl.Lockdown = *data.Lockdown
+	}
+	if data.SplitInclude != nil {
+		prfl.SplitInclude = filterSplitEntries(data.SplitInclude)
+	}
+	if data.SplitExclude != nil {
+		prfl.SplitExclude = filterSplitEntries(data.SplitExclude)
+	}
+
+	if data.ServerSpkiHash != nil &&
+		!equalStrings(prfl.ServerSpkiHash, data.ServerSpkiHash) {
+
+		prfl.ServerSpkiHash = data.ServerSpkiHash
+		prfl.HostSpkiHash = nil
+		pinChanged = curPrfl != nil
+	}
+
+	return
+}
+
+// adminOptionsChanged returns if the request changes the lockdown or split
+// tunnel options, these options can only be changed by admins
+func adminOptionsChanged(curPrfl *sprofile.Sprofile,
+	data *sprofileData) bool {
+
+	lockdown := false
+	var include, exclude []string
+	if curPrfl != nil {
+		lockdown = curPrfl.Lockdown
+		include = curPrfl.SplitInclude
+		exclude = curPrfl.SplitExclude
+	}
+
+	if data.Lockdown != nil && *data.Lockdown != lockdown {
+		return true
+	}
+	if data.SplitInclude != nil &&
+		!equalStrings(filterSplitEntries(data.SplitInclude), include) {
+
+		return true
+	}
+	if data.SplitExclude != nil &&
+		!equalStrings(filterSplitEntries(data.SplitExclude), exclude) {
+
+		return true
+	}
+
+	return false
+}
+
+func equalStrings(x, y []string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func filterSplitEntries(entries []string) (filtered []string) {
+	filtered = []string{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.ContainsAny(entry, "\"\n") {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	return
+}
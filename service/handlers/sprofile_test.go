@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pritunl/pritunl-client-electron/service/sprofile"
+)
+
+func TestMergeSprofileOptions(t *testing.T) {
+	curPrfl := &sprofile.Sprofile{
+		Id:             "prfl1",
+		Lockdown:       true,
+		SplitInclude:   []string{"firefox"},
+		ServerSpkiHash: []string{"old-hash"},
+		HostSpkiHash: map[string]string{
+			"vpn.example.com": "host-hash",
+		},
+	}
+
+	data := &sprofileData{}
+	err := json.Unmarshal([]byte(`{"id": "prfl1"}`), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prfl := &sprofile.Sprofile{
+		Id: data.Id,
+	}
+	if mergeSprofileOptions(prfl, curPrfl, data) {
+		t.Fatal("handlers: Unexpected pin change")
+	}
+	if !prfl.Lockdown || len(prfl.SplitInclude) != 1 ||
+		len(prfl.ServerSpkiHash) != 1 || prfl.ServerSpkiHash[0] != "old-hash" ||
+		prfl.HostSpkiHash["vpn.example.com"] != "host-hash" {
+
+		t.Fatal("handlers: Omitted options not kept")
+	}
+
+	data = &sprofileData{}
+	err = json.Unmarshal([]byte(`{
+		"id": "prfl1",
+		"lockdown": false,
+		"split_include": [],
+		"server_spki_hash": ["new-hash"]
+	}`), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prfl = &sprofile.Sprofile{
+		Id: data.Id,
+	}
+	if !mergeSprofileOptions(prfl, curPrfl, data) {
+		t.Fatal("handlers: Expected pin change")
+	}
+	if prfl.Lockdown || len(prfl.SplitInclude) != 0 {
+		t.Fatal("handlers: Options from request not applied")
+	}
+	if len(prfl.ServerSpkiHash) != 1 || prfl.ServerSpkiHash[0] != "new-hash" {
+		t.Fatalf("handlers: Pin not rotated %v", prfl.ServerSpkiHash)
+	}
+	if len(prfl.HostSpkiHash) != 0 {
+		t.Fatal("handlers: Host pins not cleared on pin rotation")
+	}
+}
+
+func TestAdminOptionsChanged(t *testing.T) {
+	curPrfl := &sprofile.Sprofile{
+		Id:           "prfl1",
+		Lockdown:     true,
+		SplitInclude: []string{"firefox"},
+	}
+
+	data := &sprofileData{}
+	err := json.Unmarshal([]byte(`{
+		"id": "prfl1",
+		"lockdown": true,
+		"split_include": ["firefox"]
+	}`), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adminOptionsChanged(curPrfl, data) {
+		t.Fatal("handlers: Unchanged options reported as changed")
+	}
+
+	data = &sprofileData{}
+	err = json.Unmarshal([]byte(`{
+		"id": "prfl1",
+		"split_exclude": ["curl"]
+	}`), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !adminOptionsChanged(curPrfl, data) {
+		t.Fatal("handlers: Split change not detected")
+	}
+
+	data = &sprofileData{}
+	err = json.Unmarshal([]byte(`{
+		"id": "prfl2",
+		"lockdown": true
+	}`), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !adminOptionsChanged(nil, data) {
+		t.Fatal("handlers: Lockdown on new profile not detected")
+	}
+}
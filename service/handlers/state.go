@@ -25,7 +25,11 @@ func stateGet(c *gin.Context) {
 	}
 
 	switch runtime.GOOS {
-	case "linux", "darwin":
+	case "linux":
+		data.Wg = true
+
+		break
+	case "darwin":
 		if connection.GetWgPath() != "" && connection.GetWgQuickPath() != "" {
 			data.Wg = true
 		}
@@ -27,6 +27,19 @@ func tokenPut(c *gin.Context) {
 		return
 	}
 
+	data.Profile = utils.FilterStr(data.Profile)
+	if data.Profile == "" {
+		err = &errortypes.ParseError{
+			errors.New("handler: Invalid profile ID"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	if !authorizeProfileCreate(c, data.Profile, "token_update") {
+		return
+	}
+
 	tokn, err := token.Update(
 		data.Profile,
 		data.ServerPublicKey,
@@ -53,7 +66,20 @@ func tokenDelete(c *gin.Context) {
 		return
 	}
 
-	token.Clear(data.Profile)
+	prflId := utils.FilterStr(data.Profile)
+	if prflId == "" {
+		err = &errortypes.ParseError{
+			errors.New("handler: Invalid profile ID"),
+		}
+		utils.AbortWithError(c, 400, err)
+		return
+	}
+
+	if !authorizeProfile(c, prflId, "token_clear") {
+		return
+	}
+
+	token.Clear(prflId)
 
 	c.JSON(200, nil)
 }
@@ -68,6 +94,10 @@ func tokenDelete2(c *gin.Context) {
 		return
 	}
 
+	if !authorizeProfile(c, prflId, "token_clear") {
+		return
+	}
+
 	token.Clear(prflId)
 
 	c.JSON(200, nil)
@@ -0,0 +1,140 @@
+package latency
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+func listenIcmp(ip net.IP) (conn *icmp.PacketConn, privileged bool,
+	err error) {
+
+	if ip.To4() != nil {
+		conn, err = icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+		if err == nil {
+			privileged = true
+			return
+		}
+		conn, err = icmp.ListenPacket("udp4", "0.0.0.0")
+	} else {
+		conn, err = icmp.ListenPacket("ip6:ipv6-icmp", "::")
+		if err == nil {
+			privileged = true
+			return
+		}
+		conn, err = icmp.ListenPacket("udp6", "::")
+	}
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "latency: Failed to open icmp socket"),
+		}
+		return
+	}
+
+	return
+}
+
+func probeIcmp(ip net.IP, timeout time.Duration) (
+	lat time.Duration, err error) {
+
+	conn, privileged, err := listenIcmp(ip)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	token := make([]byte, 16)
+	_, err = rand.Read(token)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "latency: Failed to generate icmp token"),
+		}
+		return
+	}
+
+	var typ icmp.Type
+	var replyTyp icmp.Type
+	proto := 1
+	if ip.To4() != nil {
+		typ = ipv4.ICMPTypeEcho
+		replyTyp = ipv4.ICMPTypeEchoReply
+	} else {
+		typ = ipv6.ICMPTypeEchoRequest
+		replyTyp = ipv6.ICMPTypeEchoReply
+		proto = 58
+	}
+
+	msg := &icmp.Message{
+		Type: typ,
+		Body: &icmp.Echo{
+			ID:   int(token[0])<<8 | int(token[1]),
+			Seq:  1,
+			Data: token,
+		},
+	}
+
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "latency: Failed to marshal icmp message"),
+		}
+		return
+	}
+
+	var dest net.Addr
+	if privileged {
+		dest = &net.IPAddr{IP: ip}
+	} else {
+		dest = &net.UDPAddr{IP: ip}
+	}
+
+	deadline := time.Now().Add(timeout)
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "latency: Failed to set icmp deadline"),
+		}
+		return
+	}
+
+	start := time.Now()
+
+	_, err = conn.WriteTo(data, dest)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "latency: Failed to send icmp echo"),
+		}
+		return
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, e := conn.ReadFrom(buf)
+		if e != nil {
+			err = &errortypes.RequestError{
+				errors.Wrap(e, "latency: Failed to read icmp reply"),
+			}
+			return
+		}
+
+		reply, e := icmp.ParseMessage(proto, buf[:n])
+		if e != nil || reply.Type != replyTyp {
+			continue
+		}
+
+		echo, ok := reply.Body.(*icmp.Echo)
+		if !ok || !bytes.Equal(echo.Data, token) {
+			continue
+		}
+
+		lat = time.Since(start)
+		return
+	}
+}
@@ -0,0 +1,271 @@
+package latency
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	cacheTtl     = 5 * time.Minute
+	cacheFailTtl = 30 * time.Second
+	TcpProbe     = "tcp"
+	UdpProbe     = "udp"
+	IcmpProbe    = "icmp"
+)
+
+var (
+	probeTimeout = 2 * time.Second
+	cache        = map[string]*Result{}
+	cacheLock    = sync.Mutex{}
+)
+
+type Result struct {
+	Addr      string
+	Port      int
+	Proto     string
+	Network   string
+	Method    string
+	Latency   time.Duration
+	Ok        bool
+	Timestamp time.Time
+}
+
+// Target is probed on Port using Proto, a TCP target is online when the
+// port accepts connections and a UDP target when the host answers icmp
+// and the port is not reported closed. When CheckUdpPort is set the
+// target is also offline if that UDP port is reported closed.
+type Target struct {
+	Addrs        []string
+	Port         int
+	Proto        string
+	CheckUdpPort int
+	Method       string
+	Latency      time.Duration
+	Ok           bool
+}
+
+func cacheKey(network, addr string, port int, proto, method string) string {
+	return network + "|" + proto + "|" + method + "|" +
+		net.JoinHostPort(addr, strconv.Itoa(port))
+}
+
+func getCache(network, addr string, port int,
+	proto, method string) *Result {
+
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	res := cache[cacheKey(network, addr, port, proto, method)]
+	if res == nil {
+		return nil
+	}
+
+	ttl := cacheTtl
+	if !res.Ok {
+		ttl = cacheFailTtl
+	}
+	if time.Since(res.Timestamp) > ttl {
+		return nil
+	}
+
+	return res
+}
+
+func setCache(res *Result) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	for key, cached := range cache {
+		if time.Since(cached.Timestamp) > cacheTtl {
+			delete(cache, key)
+		}
+	}
+
+	cache[cacheKey(res.Network, res.Addr, res.Port,
+		res.Proto, res.Method)] = res
+}
+
+func ClearCache() {
+	cacheLock.Lock()
+	cache = map[string]*Result{}
+	cacheLock.Unlock()
+}
+
+// Network returns a key for the current network formed from the local
+// addresses used to reach the internet, no packets are sent
+func Network() string {
+	addr4 := ""
+	conn, err := net.Dial("udp4", "192.0.2.1:9")
+	if err == nil {
+		addr4 = conn.LocalAddr().(*net.UDPAddr).IP.String()
+		conn.Close()
+	}
+
+	addr6 := ""
+	conn, err = net.Dial("udp6", "[2001:db8::1]:9")
+	if err == nil {
+		addr6 = conn.LocalAddr().(*net.UDPAddr).IP.String()
+		conn.Close()
+	}
+
+	return addr4 + "/" + addr6
+}
+
+func probeTcp(addr string, port int, timeout time.Duration) (
+	lat time.Duration, err error) {
+
+	start := time.Now()
+
+	conn, err := net.DialTimeout(
+		"tcp", net.JoinHostPort(addr, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return
+	}
+	lat = time.Since(start)
+	conn.Close()
+
+	return
+}
+
+// Probe checks the port is reachable and measures the latency using only
+// method, TCP targets can be measured with either TcpProbe or IcmpProbe
+// and UDP targets only with IcmpProbe
+func Probe(network, addr string, port int, proto, method string) (
+	res *Result) {
+
+	if proto != UdpProbe {
+		proto = TcpProbe
+	}
+	if proto == UdpProbe {
+		method = IcmpProbe
+	} else if method != IcmpProbe {
+		method = TcpProbe
+	}
+
+	res = getCache(network, addr, port, proto, method)
+	if res != nil {
+		return
+	}
+
+	res = &Result{
+		Addr:    addr,
+		Port:    port,
+		Proto:   proto,
+		Network: network,
+		Method:  method,
+	}
+
+	waiter := sync.WaitGroup{}
+	portOk := false
+	latOk := false
+
+	if proto == TcpProbe {
+		waiter.Add(1)
+		go func() {
+			defer waiter.Done()
+			lat, err := probeTcp(addr, port, probeTimeout)
+			if err != nil {
+				return
+			}
+			portOk = true
+			if method == TcpProbe {
+				latOk = true
+				res.Latency = lat
+			}
+		}()
+	} else {
+		waiter.Add(1)
+		go func() {
+			defer waiter.Done()
+			portOk = !probeUdpClosed(addr, port, probeTimeout)
+		}()
+	}
+
+	if method == IcmpProbe {
+		if ip := net.ParseIP(addr); ip != nil {
+			waiter.Add(1)
+			go func() {
+				defer waiter.Done()
+				lat, err := probeIcmp(ip, probeTimeout)
+				if err != nil {
+					return
+				}
+				latOk = true
+				res.Latency = lat
+			}()
+		}
+	}
+
+	waiter.Wait()
+
+	res.Ok = portOk && latOk
+	if !res.Ok {
+		res.Latency = 0
+	}
+	res.Timestamp = time.Now()
+	setCache(res)
+
+	return
+}
+
+// Sort probes all target addresses in parallel and orders the targets by
+// the lowest measured latency, unreachable targets keep their order. All
+// targets are measured with the same method so timings are comparable,
+// TCP connect time is used unless a UDP target requires icmp.
+func Sort(network string, targets []*Target) {
+	method := TcpProbe
+	for _, target := range targets {
+		if target.Proto == UdpProbe {
+			method = IcmpProbe
+			break
+		}
+	}
+
+	waiter := sync.WaitGroup{}
+
+	for _, target := range targets {
+		target.Ok = false
+		target.Latency = 0
+		target.Method = method
+
+		lock := sync.Mutex{}
+
+		for _, addr := range target.Addrs {
+			waiter.Add(1)
+			go func(target *Target, addr string) {
+				defer waiter.Done()
+
+				res := Probe(network, addr, target.Port,
+					target.Proto, method)
+				if !res.Ok {
+					return
+				}
+
+				if target.CheckUdpPort != 0 && probeUdpClosed(
+					addr, target.CheckUdpPort, probeTimeout) {
+
+					return
+				}
+
+				lock.Lock()
+				if !target.Ok || res.Latency < target.Latency {
+					target.Ok = true
+					target.Latency = res.Latency
+				}
+				lock.Unlock()
+			}(target, addr)
+		}
+	}
+
+	waiter.Wait()
+
+	sort.SliceStable(targets, func(i, j int) bool {
+		if targets[i].Ok != targets[j].Ok {
+			return targets[i].Ok
+		}
+		return targets[i].Latency < targets[j].Latency
+	})
+}
@@ -0,0 +1,149 @@
+package latency
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func listenTcp(t *testing.T) (port int) {
+	t.Helper()
+
+	lstn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		lstn.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := lstn.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	port = lstn.Addr().(*net.TCPAddr).Port
+
+	return
+}
+
+func TestProbeCache(t *testing.T) {
+	ClearCache()
+	port := listenTcp(t)
+
+	res := Probe("test", "127.0.0.1", port, TcpProbe, TcpProbe)
+	if !res.Ok {
+		t.Fatal("latency: Expected local probe to succeed")
+	}
+
+	cached := Probe("test", "127.0.0.1", port, TcpProbe, TcpProbe)
+	if cached != res {
+		t.Fatal("latency: Expected cached probe result")
+	}
+
+	icmp := Probe("test", "127.0.0.1", port, TcpProbe, IcmpProbe)
+	if icmp == res || icmp.Method != IcmpProbe {
+		t.Fatal("latency: Expected separate result for icmp method")
+	}
+
+	other := Probe("other", "127.0.0.1", port, TcpProbe, TcpProbe)
+	if other == res {
+		t.Fatal("latency: Expected separate result for other network")
+	}
+}
+
+func TestSort(t *testing.T) {
+	ClearCache()
+	probeTimeout = 300 * time.Millisecond
+	defer func() {
+		probeTimeout = 2 * time.Second
+	}()
+
+	port := listenTcp(t)
+
+	unreachable := &Target{
+		Addrs: []string{"one.invalid"},
+		Port:  port,
+	}
+	local := &Target{
+		Addrs: []string{"two.invalid", "127.0.0.1"},
+		Port:  port,
+	}
+	unreachable2 := &Target{
+		Addrs: []string{"three.invalid"},
+		Port:  port,
+	}
+
+	start := time.Now()
+	targets := []*Target{unreachable, local, unreachable2}
+	Sort("test", targets)
+
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("latency: Probes not run in parallel")
+	}
+	if targets[0] != local || !local.Ok {
+		t.Fatal("latency: Expected reachable target first")
+	}
+	if targets[1] != unreachable || targets[2] != unreachable2 {
+		t.Fatal("latency: Expected unreachable targets to keep order")
+	}
+	if unreachable.Ok || unreachable2.Ok {
+		t.Fatal("latency: Unexpected reachable target")
+	}
+}
+
+func TestProbeUdpClosed(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	if probeUdpClosed("127.0.0.1", port, 300*time.Millisecond) {
+		t.Fatal("latency: Expected open udp port")
+	}
+
+	closed, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.LocalAddr().(*net.UDPAddr).Port
+	closed.Close()
+
+	if !probeUdpClosed("127.0.0.1", closedPort, 2*time.Second) {
+		t.Fatal("latency: Expected closed udp port")
+	}
+}
+
+func TestSortCheckUdpPort(t *testing.T) {
+	ClearCache()
+	port := listenTcp(t)
+
+	closed, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.LocalAddr().(*net.UDPAddr).Port
+	closed.Close()
+
+	target := &Target{
+		Addrs:        []string{"127.0.0.1"},
+		Port:         port,
+		CheckUdpPort: closedPort,
+	}
+
+	Sort("test", []*Target{target})
+
+	if target.Ok {
+		t.Fatal("latency: Expected target with closed udp port offline")
+	}
+	if target.Method != TcpProbe {
+		t.Fatalf("latency: Unexpected method %s", target.Method)
+	}
+}
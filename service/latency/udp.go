@@ -0,0 +1,44 @@
+package latency
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// probeUdpClosed sends a datagram to the port and reports if the host
+// responded with port unreachable, services such as WireGuard silently
+// drop unknown packets so a timeout indicates the port may be open
+func probeUdpClosed(addr string, port int, timeout time.Duration) bool {
+	conn, err := net.DialTimeout(
+		"udp", net.JoinHostPort(addr, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return false
+	}
+
+	_, err = conn.Write([]byte{0})
+	if err != nil {
+		return isClosedErr(err)
+	}
+
+	buf := make([]byte, 64)
+	_, err = conn.Read(buf)
+	if err != nil {
+		return isClosedErr(err)
+	}
+
+	return false
+}
+
+func isClosedErr(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
@@ -0,0 +1,75 @@
+package lockdown
+
+import (
+	"sync"
+)
+
+var (
+	rules     = map[string]*Rule{}
+	rulesLock = sync.Mutex{}
+)
+
+type Rule struct {
+	Ifaces []string
+	Addrs  []string
+}
+
+func Set(prflId string, ifaces, addrs []string) (err error) {
+	rulesLock.Lock()
+	defer rulesLock.Unlock()
+
+	rules[prflId] = &Rule{
+		Ifaces: ifaces,
+		Addrs:  addrs,
+	}
+
+	err = apply(rules)
+	if err != nil {
+		delete(rules, prflId)
+		return
+	}
+
+	return
+}
+
+func Remove(prflId string) (err error) {
+	rulesLock.Lock()
+	defer rulesLock.Unlock()
+
+	if _, ok := rules[prflId]; !ok {
+		return
+	}
+	delete(rules, prflId)
+
+	if len(rules) == 0 {
+		err = flush()
+	} else {
+		err = apply(rules)
+	}
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func IsActive(prflId string) bool {
+	rulesLock.Lock()
+	_, ok := rules[prflId]
+	rulesLock.Unlock()
+	return ok
+}
+
+func Clear() (err error) {
+	rulesLock.Lock()
+	defer rulesLock.Unlock()
+
+	rules = map[string]*Rule{}
+
+	err = flush()
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -0,0 +1,17 @@
+package lockdown
+
+import (
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+)
+
+func apply(rules map[string]*Rule) (err error) {
+	err = &errortypes.UnknownError{
+		errors.New("lockdown: Lockdown not supported on this platform"),
+	}
+	return
+}
+
+func flush() (err error) {
+	return
+}
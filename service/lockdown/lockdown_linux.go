@@ -0,0 +1,167 @@
+package lockdown
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/dnsproxy"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+)
+
+const (
+	tableName = "pritunl_lockdown"
+)
+
+func getNftPath() (pth string, err error) {
+	pth, _ = exec.LookPath("nft")
+	if pth == "" {
+		err = &errortypes.ExecError{
+			errors.New("lockdown: Failed to find nft command"),
+		}
+		return
+	}
+
+	return
+}
+
+func formatSet(vals []string) string {
+	return "{ " + strings.Join(vals, ", ") + " }"
+}
+
+func apply(rules map[string]*Rule) (err error) {
+	nftPath, err := getNftPath()
+	if err != nil {
+		return
+	}
+
+	ifacesSet := set.NewSet()
+	addrs4Set := set.NewSet()
+	addrs6Set := set.NewSet()
+
+	for _, rule := range rules {
+		for _, iface := range rule.Ifaces {
+			iface = utils.FilterStr(iface)
+			if iface != "" {
+				ifacesSet.Add(fmt.Sprintf("\"%s\"", iface))
+			}
+		}
+
+		for _, addr := range rule.Addrs {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				continue
+			}
+
+			if ip.To4() != nil {
+				addrs4Set.Add(ip.String())
+			} else {
+				addrs6Set.Add(ip.String())
+			}
+		}
+	}
+
+	ifaces := []string{}
+	for iface := range ifacesSet.Iter() {
+		ifaces = append(ifaces, iface.(string))
+	}
+	sort.Strings(ifaces)
+
+	addrs4 := []string{}
+	for addr := range addrs4Set.Iter() {
+		addrs4 = append(addrs4, addr.(string))
+	}
+	sort.Strings(addrs4)
+
+	addrs6 := []string{}
+	for addr := range addrs6Set.Iter() {
+		addrs6 = append(addrs6, addr.(string))
+	}
+	sort.Strings(addrs6)
+
+	dns4 := []string{}
+	dns6 := []string{}
+	for _, server := range dnsproxy.Upstream() {
+		ip := net.ParseIP(server)
+		if ip == nil || ip.IsLoopback() {
+			continue
+		}
+
+		if ip.To4() != nil {
+			dns4 = append(dns4, ip.String())
+		} else {
+			dns6 = append(dns6, ip.String())
+		}
+	}
+	sort.Strings(dns4)
+	sort.Strings(dns6)
+
+	ruleset := fmt.Sprintf("table inet %s\n", tableName)
+	ruleset += fmt.Sprintf("delete table inet %s\n", tableName)
+	ruleset += fmt.Sprintf("table inet %s {\n", tableName)
+	ruleset += "\tchain output {\n"
+	ruleset += "\t\ttype filter hook output priority 0; policy drop;\n"
+	ruleset += "\t\toifname \"lo\" accept\n"
+	if len(ifaces) > 0 {
+		ruleset += fmt.Sprintf("\t\toifname %s accept\n",
+			formatSet(ifaces))
+	}
+	if len(addrs4) > 0 {
+		ruleset += fmt.Sprintf("\t\tip daddr %s accept\n",
+			formatSet(addrs4))
+	}
+	if len(addrs6) > 0 {
+		ruleset += fmt.Sprintf("\t\tip6 daddr %s accept\n",
+			formatSet(addrs6))
+	}
+	if len(dns4) > 0 {
+		ruleset += fmt.Sprintf("\t\tip daddr %s meta l4proto "+
+			"{ tcp, udp } th dport 53 accept\n", formatSet(dns4))
+	}
+	if len(dns6) > 0 {
+		ruleset += fmt.Sprintf("\t\tip6 daddr %s meta l4proto "+
+			"{ tcp, udp } th dport 53 accept\n", formatSet(dns6))
+	}
+	ruleset += "\t\tudp sport 68 udp dport 67 accept\n"
+	ruleset += "\t\tudp sport 546 udp dport 547 accept\n"
+	ruleset += "\t\ticmpv6 type { nd-router-solicit, nd-neighbor-solicit, " +
+		"nd-neighbor-advert } accept\n"
+	ruleset += "\t}\n"
+	ruleset += "}\n"
+
+	_, err = utils.ExecInputOutput(ruleset, nftPath, "-f", "-")
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "lockdown: Failed to apply nftables rules"),
+		}
+		return
+	}
+
+	return
+}
+
+func flush() (err error) {
+	nftPath, err := getNftPath()
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecInputOutput(
+		fmt.Sprintf("table inet %s\ndelete table inet %s\n",
+			tableName, tableName),
+		nftPath, "-f", "-",
+	)
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "lockdown: Failed to remove nftables rules"),
+		}
+		return
+	}
+
+	return
+}
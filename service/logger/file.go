@@ -1,10 +1,6 @@
 package logger
 
 import (
-	"os"
-
-	"github.com/dropbox/godropbox/errors"
-	"github.com/pritunl/pritunl-client-electron/service/errortypes"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -25,50 +21,8 @@ func (s *fileSender) Parse(entry *logrus.Entry) {
 func (s *fileSender) send(entry *logrus.Entry) (err error) {
 	msg := formatPlain(entry)
 
-	file, err := os.OpenFile(utils.GetLogPath(),
-		os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-	if err != nil {
-		err = &errortypes.WriteError{
-			errors.Wrap(err, "logger: Failed to open log file"),
-		}
-		return
-	}
-	defer file.Close()
-
-	stat, err := file.Stat()
-	if err != nil {
-		err = &errortypes.ReadError{
-			errors.Wrap(err, "logger: Failed to stat log file"),
-		}
-		return
-	}
-
-	if stat.Size() >= 200000 {
-		file.Close()
-		os.Remove(utils.GetLogPath2())
-		err = os.Rename(utils.GetLogPath(), utils.GetLogPath2())
-		if err != nil {
-			err = &errortypes.WriteError{
-				errors.Wrap(err, "logger: Failed to rotate log file"),
-			}
-			return
-		}
-
-		file, err = os.OpenFile(utils.GetLogPath(),
-			os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-		if err != nil {
-			err = &errortypes.WriteError{
-				errors.Wrap(err, "logger: Failed to open log file"),
-			}
-			return
-		}
-	}
-
-	_, err = file.Write(msg)
+	err = writeFile(utils.GetLogPath(), msg, getMaxSize(), getMaxFiles())
 	if err != nil {
-		err = &errortypes.WriteError{
-			errors.Wrap(err, "logger: Failed to write to log file"),
-		}
 		return
 	}
 
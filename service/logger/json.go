@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/sirupsen/logrus"
+)
+
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields"`
+}
+
+type jsonSender struct{}
+
+func (s *jsonSender) Init() {}
+
+func (s *jsonSender) Parse(entry *logrus.Entry) {
+	if !config.Config.LogJson {
+		return
+	}
+
+	err := s.send(entry)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("logger: JSON send error")
+	}
+}
+
+func (s *jsonSender) send(entry *logrus.Entry) (err error) {
+	data, err := formatJson(entry)
+	if err != nil {
+		return
+	}
+
+	err = writeFile(utils.GetJsonLogPath(), data,
+		getJsonMaxSize(), getMaxFiles())
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func formatJson(entry *logrus.Entry) (output []byte, err error) {
+	jsonEntry := &Entry{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+		Fields:  map[string]interface{}{},
+	}
+
+	for key, val := range entry.Data {
+		switch valTyp := val.(type) {
+		case error:
+			jsonEntry.Fields[key] = valTyp.Error()
+			break
+		case fmt.Stringer:
+			jsonEntry.Fields[key] = valTyp.String()
+			break
+		default:
+			_, e := json.Marshal(val)
+			if e != nil {
+				jsonEntry.Fields[key] = fmt.Sprintf("%v", val)
+			} else {
+				jsonEntry.Fields[key] = val
+			}
+		}
+	}
+
+	output, err = json.Marshal(jsonEntry)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "logger: Failed to marshal log entry"),
+		}
+		return
+	}
+	output = append(output, '\n')
+
+	return
+}
+
+func init() {
+	senders = append(senders, &jsonSender{})
+}
@@ -0,0 +1,170 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	queryLimit = 1000
+)
+
+type Query struct {
+	Level     string
+	Start     time.Time
+	End       time.Time
+	ProfileId string
+	StateId   string
+	Limit     int
+}
+
+func (q *Query) Match(entry *Entry) bool {
+	if q.Level != "" {
+		minLvl, err := logrus.ParseLevel(q.Level)
+		if err == nil {
+			lvl, err := logrus.ParseLevel(entry.Level)
+			if err != nil || lvl > minLvl {
+				return false
+			}
+		}
+	}
+
+	if !q.Start.IsZero() && entry.Time.Before(q.Start) {
+		return false
+	}
+	if !q.End.IsZero() && entry.Time.After(q.End) {
+		return false
+	}
+
+	if q.ProfileId != "" && entry.Fields["profile_id"] != q.ProfileId {
+		return false
+	}
+	if q.StateId != "" && entry.Fields["state_id"] != q.StateId {
+		return false
+	}
+
+	return true
+}
+
+// entryRing keeps the most recent entries up to the limit so queries
+// over large log files do not hold every matching entry in memory
+type entryRing struct {
+	entries []*Entry
+	start   int
+	limit   int
+}
+
+func (r *entryRing) push(entry *Entry) {
+	if len(r.entries) < r.limit {
+		r.entries = append(r.entries, entry)
+		return
+	}
+
+	r.entries[r.start] = entry
+	r.start = (r.start + 1) % r.limit
+}
+
+func (r *entryRing) list() (entries []*Entry) {
+	entries = make([]*Entry, 0, len(r.entries))
+	entries = append(entries, r.entries[r.start:]...)
+	entries = append(entries, r.entries[:r.start]...)
+	return
+}
+
+func newEntryRing(limit int) *entryRing {
+	return &entryRing{
+		entries: []*Entry{},
+		limit:   limit,
+	}
+}
+
+func queryReader(reader io.Reader, query *Query, ring *entryRing) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	for scanner.Scan() {
+		entry := &Entry{}
+		err := json.Unmarshal(scanner.Bytes(), entry)
+		if err != nil {
+			continue
+		}
+
+		if query.Match(entry) {
+			ring.push(entry)
+		}
+	}
+}
+
+func queryFile(pth string, compressed bool, query *Query,
+	ring *entryRing) (err error) {
+
+	file, err := os.Open(pth)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "logger: Failed to open log file"),
+		}
+		return
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if compressed {
+		gzReader, e := gzip.NewReader(file)
+		if e != nil {
+			err = &errortypes.ReadError{
+				errors.Wrap(e, "logger: Failed to read compressed log file"),
+			}
+			return
+		}
+		defer gzReader.Close()
+
+		reader = gzReader
+	}
+
+	queryReader(reader, query, ring)
+
+	return
+}
+
+func queryPath(pth string, query *Query) (entries []*Entry, err error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = queryLimit
+	}
+	ring := newEntryRing(limit)
+
+	for i := getMaxFiles(); i >= 1; i-- {
+		err = queryFile(rotatedPath(pth, i), true, query, ring)
+		if err != nil {
+			return
+		}
+	}
+
+	err = queryFile(pth, false, query, ring)
+	if err != nil {
+		return
+	}
+
+	entries = ring.list()
+
+	return
+}
+
+// QueryLog returns the most recent JSON log entries matching the query,
+// oldest first, rotated files are included
+func QueryLog(query *Query) (entries []*Entry, err error) {
+	return queryPath(utils.GetJsonLogPath(), query)
+}
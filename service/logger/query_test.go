@@ -0,0 +1,131 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func writeTestEntry(t *testing.T, pth string, maxSize int,
+	tm time.Time, level logrus.Level, fields logrus.Fields) {
+
+	entry := &logrus.Entry{
+		Time:    tm,
+		Level:   level,
+		Message: "test: Entry",
+		Data:    fields,
+	}
+
+	data, err := formatJson(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFile(pth, data, maxSize, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryPath(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "test.json.log")
+	start := time.Now().Add(-time.Hour)
+
+	for i := 0; i < 20; i++ {
+		fields := logrus.Fields{
+			"profile_id": "prfl1",
+			"state_id":   "state1",
+		}
+		if i%2 == 1 {
+			fields["state_id"] = "state2"
+		}
+
+		level := logrus.InfoLevel
+		if i%5 == 0 {
+			level = logrus.ErrorLevel
+		}
+
+		writeTestEntry(t, pth, 1000, start.Add(time.Duration(i)*time.Minute),
+			level, fields)
+	}
+
+	_, err := os.Stat(rotatedPath(pth, 1))
+	if err != nil {
+		t.Fatalf("expected rotated log file %s", err)
+	}
+
+	entries, err := queryPath(pth, &Query{
+		ProfileId: "prfl1",
+		StateId:   "state2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 10 {
+		t.Fatalf("unexpected entry count %d", len(entries))
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Time.Before(entries[i-1].Time) {
+			t.Fatal("entries not in order")
+		}
+	}
+
+	entries, err = queryPath(pth, &Query{
+		Level: "error",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("unexpected error entry count %d", len(entries))
+	}
+
+	entries, err = queryPath(pth, &Query{
+		Start: start.Add(15 * time.Minute),
+		Limit: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("unexpected limited entry count %d", len(entries))
+	}
+	if entries[0].Time.Unix() != start.Add(18*time.Minute).Unix() ||
+		entries[1].Time.Unix() != start.Add(19*time.Minute).Unix() {
+
+		t.Fatal("expected most recent entries")
+	}
+}
+
+func TestFormatJsonError(t *testing.T) {
+	errTest := errors.New("test error")
+
+	entry := &logrus.Entry{
+		Time:    time.Now(),
+		Level:   logrus.WarnLevel,
+		Message: "test: Entry",
+		Data: logrus.Fields{
+			"error": errTest,
+		},
+	}
+
+	data, err := formatJson(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ring := newEntryRing(queryLimit)
+	queryReader(bytes.NewReader(data), &Query{}, ring)
+	entries := ring.list()
+	if len(entries) != 1 {
+		t.Fatalf("unexpected entry count %d", len(entries))
+	}
+	if entries[0].Fields["error"] != errTest.Error() {
+		t.Fatalf("unexpected error field %v", entries[0].Fields["error"])
+	}
+}
@@ -0,0 +1,179 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+)
+
+const (
+	logMaxSize     = 200000
+	jsonLogMaxSize = 10000000
+	logMaxFiles    = 5
+)
+
+func getMaxSize() int {
+	if config.Config.LogMaxSize > 0 {
+		return config.Config.LogMaxSize
+	}
+	return logMaxSize
+}
+
+func getJsonMaxSize() int {
+	if config.Config.LogJsonMaxSize > 0 {
+		return config.Config.LogJsonMaxSize
+	}
+	return jsonLogMaxSize
+}
+
+func getMaxFiles() int {
+	if config.Config.LogMaxFiles > 0 {
+		return config.Config.LogMaxFiles
+	}
+	return logMaxFiles
+}
+
+func rotatedPath(pth string, num int) string {
+	return fmt.Sprintf("%s.%d.gz", pth, num)
+}
+
+func compressFile(srcPth, dstPth string) (err error) {
+	src, err := os.Open(srcPth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "logger: Failed to open rotated log file"),
+		}
+		return
+	}
+	defer src.Close()
+
+	tmpPth := dstPth + ".tmp"
+	dst, err := os.OpenFile(tmpPth,
+		os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "logger: Failed to create compressed log file"),
+		}
+		return
+	}
+	defer os.Remove(tmpPth)
+
+	writer := gzip.NewWriter(dst)
+
+	_, err = io.Copy(writer, src)
+	if err != nil {
+		dst.Close()
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "logger: Failed to compress log file"),
+		}
+		return
+	}
+
+	err = writer.Close()
+	if err != nil {
+		dst.Close()
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "logger: Failed to compress log file"),
+		}
+		return
+	}
+
+	err = dst.Close()
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "logger: Failed to close compressed log file"),
+		}
+		return
+	}
+
+	err = os.Rename(tmpPth, dstPth)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "logger: Failed to move compressed log file"),
+		}
+		return
+	}
+
+	_ = os.Remove(srcPth)
+
+	return
+}
+
+func rotateFile(pth string, maxFiles int) (err error) {
+	_ = os.Remove(rotatedPath(pth, maxFiles))
+	for i := maxFiles - 1; i >= 1; i-- {
+		_ = os.Rename(rotatedPath(pth, i), rotatedPath(pth, i+1))
+	}
+
+	tmpPth := pth + ".1"
+	err = os.Rename(pth, tmpPth)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "logger: Failed to rotate log file"),
+		}
+		return
+	}
+
+	err = compressFile(tmpPth, rotatedPath(pth, 1))
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func writeFile(pth string, data []byte, maxSize, maxFiles int) (
+	err error) {
+
+	file, err := os.OpenFile(pth, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "logger: Failed to open log file"),
+		}
+		return
+	}
+	defer func() {
+		file.Close()
+	}()
+
+	stat, err := file.Stat()
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "logger: Failed to stat log file"),
+		}
+		return
+	}
+
+	if stat.Size() >= int64(maxSize) {
+		file.Close()
+
+		err = rotateFile(pth, maxFiles)
+		if err != nil {
+			return
+		}
+
+		file, err = os.OpenFile(pth,
+			os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "logger: Failed to open log file"),
+			}
+			return
+		}
+	}
+
+	_, err = file.Write(data)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "logger: Failed to write to log file"),
+		}
+		return
+	}
+
+	return
+}
@@ -18,10 +18,12 @@ import (
 	"github.com/pritunl/pritunl-client-electron/service/config"
 	"github.com/pritunl/pritunl-client-electron/service/connection"
 	"github.com/pritunl/pritunl-client-electron/service/constants"
+	"github.com/pritunl/pritunl-client-electron/service/dnsproxy"
 	"github.com/pritunl/pritunl-client-electron/service/event"
 	"github.com/pritunl/pritunl-client-electron/service/logger"
 	"github.com/pritunl/pritunl-client-electron/service/router"
 	"github.com/pritunl/pritunl-client-electron/service/setup"
+	"github.com/pritunl/pritunl-client-electron/service/token"
 	"github.com/pritunl/pritunl-client-electron/service/tuntap"
 	"github.com/pritunl/pritunl-client-electron/service/update"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
@@ -93,6 +95,14 @@ func main() {
 		"version": constants.Version,
 	}).Info("main: Service starting")
 
+	err = dnsproxy.Restore()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("main: Failed to restore system DNS configuration")
+		err = nil
+	}
+
 	go update.Check()
 
 	defer func() {
@@ -115,6 +125,14 @@ func main() {
 		panic(err)
 	}
 
+	err = token.Load()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("main: Failed to load tokens")
+		err = nil
+	}
+
 	err = autoclean.CheckAndClean()
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
@@ -137,6 +155,16 @@ func main() {
 		}
 	}
 
+	if config.Config.EnableDnsProxy {
+		err = dnsproxy.Start()
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("main: Failed to start DNS proxy")
+			err = nil
+		}
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 
 	watch.StartWatch()
@@ -191,6 +219,7 @@ func main() {
 	}()
 
 	connection.WatchSystemProfiles()
+	connection.WatchManagedProfiles()
 
 	if winsvc.IsWindowsService() {
 		service := winsvc.New()
@@ -233,6 +262,8 @@ func main() {
 		conn.StopWait()
 	}
 
+	dnsproxy.Stop()
+
 	if runtime.GOOS == "darwin" {
 		_ = utils.ClearScutilConnKeys()
 		_ = utils.RestoreScutilDns(true)
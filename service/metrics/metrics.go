@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	counters       = []*Counter{}
+	collectors     = []func(w *Writer){}
+	registerLock   = sync.Mutex{}
+	labelEscaper   = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+	ConnectAttempt = NewCounter(
+		"pritunl_client_connect_attempts_total",
+		"Connection attempts by mode.",
+		"mode",
+	)
+	ConnectFailure = NewCounter(
+		"pritunl_client_connect_failures_total",
+		"Connection failures by reason.",
+		"reason",
+	)
+	PingRetry = NewCounter(
+		"pritunl_client_ping_retries_total",
+		"WireGuard keepalive ping retries.",
+	)
+	PingFailure = NewCounter(
+		"pritunl_client_ping_failures_total",
+		"WireGuard keepalive pings that exhausted all retries.",
+	)
+	SprofileSync = NewCounter(
+		"pritunl_client_sprofile_sync_total",
+		"System profile sync requests by result.",
+		"result",
+	)
+	WakeReconnect = NewCounter(
+		"pritunl_client_wake_reconnects_total",
+		"Reconnects triggered by system wake detection.",
+	)
+)
+
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+	lock   sync.Mutex
+	values map[string]float64
+}
+
+func (c *Counter) Add(val float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\x00")
+
+	c.lock.Lock()
+	c.values[key] += val
+	c.lock.Unlock()
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) write(w *Writer) {
+	w.Header(c.name, c.help, "counter")
+
+	c.lock.Lock()
+	keys := []string{}
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		labels := []string{}
+		if len(c.labels) > 0 {
+			labelValues := strings.Split(key, "\x00")
+			for i, label := range c.labels {
+				if i < len(labelValues) {
+					labels = append(labels, label, labelValues[i])
+				}
+			}
+		}
+
+		w.Sample(c.name, c.values[key], labels...)
+	}
+	c.lock.Unlock()
+}
+
+type Writer struct {
+	buf bytes.Buffer
+}
+
+func (w *Writer) Header(name, help, typ string) {
+	w.buf.WriteString(fmt.Sprintf("# HELP %s %s\n", name, help))
+	w.buf.WriteString(fmt.Sprintf("# TYPE %s %s\n", name, typ))
+}
+
+func (w *Writer) Sample(name string, val float64, labels ...string) {
+	w.buf.WriteString(name)
+
+	if len(labels) > 1 {
+		w.buf.WriteString("{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteString(",")
+			}
+			w.buf.WriteString(labels[i])
+			w.buf.WriteString("=\"")
+			w.buf.WriteString(labelEscaper.Replace(labels[i+1]))
+			w.buf.WriteString("\"")
+		}
+		w.buf.WriteString("}")
+	}
+
+	w.buf.WriteString(" ")
+	w.buf.WriteString(strconv.FormatFloat(val, 'g', -1, 64))
+	w.buf.WriteString("\n")
+}
+
+func NewCounter(name, help string, labels ...string) (c *Counter) {
+	c = &Counter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: map[string]float64{},
+	}
+
+	if len(labels) == 0 {
+		c.values[""] = 0
+	}
+
+	registerLock.Lock()
+	counters = append(counters, c)
+	registerLock.Unlock()
+
+	return
+}
+
+func Register(collector func(w *Writer)) {
+	registerLock.Lock()
+	collectors = append(collectors, collector)
+	registerLock.Unlock()
+}
+
+func Export() []byte {
+	w := &Writer{}
+
+	registerLock.Lock()
+	cntrs := counters
+	colls := collectors
+	registerLock.Unlock()
+
+	for _, collector := range colls {
+		collector(w)
+	}
+
+	for _, counter := range cntrs {
+		counter.write(w)
+	}
+
+	return w.buf.Bytes()
+}
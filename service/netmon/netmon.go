@@ -0,0 +1,66 @@
+package netmon
+
+import (
+	"runtime/debug"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	debounce = 3 * time.Second
+	changed  = make(chan bool, 1)
+)
+
+func notify() {
+	select {
+	case changed <- true:
+	default:
+	}
+}
+
+func run(handler func()) {
+	defer func() {
+		panc := recover()
+		if panc != nil {
+			logrus.WithFields(logrus.Fields{
+				"trace": string(debug.Stack()),
+				"panic": panc,
+			}).Error("netmon: Network monitor panic")
+			time.Sleep(10 * time.Second)
+			go run(handler)
+		}
+	}()
+
+	for {
+		<-changed
+
+		timer := time.NewTimer(debounce)
+		for waiting := true; waiting; {
+			select {
+			case <-changed:
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(debounce)
+			case <-timer.C:
+				waiting = false
+			}
+		}
+
+		handler()
+	}
+}
+
+// Start subscribes to network changes and calls handler once changes
+// have settled for the debounce period
+func Start(handler func()) (err error) {
+	err = subscribe()
+	if err != nil {
+		return
+	}
+
+	go run(handler)
+
+	return
+}
@@ -0,0 +1,146 @@
+package netmon
+
+import (
+	"fmt"
+	"net"
+	"runtime/debug"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+func watch(linkChan chan netlink.LinkUpdate, addrChan chan netlink.AddrUpdate,
+	routeChan chan netlink.RouteUpdate, done chan struct{}) {
+
+	defer func() {
+		panc := recover()
+		if panc != nil {
+			logrus.WithFields(logrus.Fields{
+				"trace": string(debug.Stack()),
+				"panic": panc,
+			}).Error("netmon: Netlink watch panic")
+		}
+
+		close(done)
+
+		for {
+			time.Sleep(5 * time.Second)
+
+			err := subscribe()
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": err,
+				}).Error("netmon: Failed to resubscribe to netlink")
+				continue
+			}
+
+			notify()
+			return
+		}
+	}()
+
+	for {
+		select {
+		case _, ok := <-linkChan:
+			if !ok {
+				return
+			}
+		case _, ok := <-addrChan:
+			if !ok {
+				return
+			}
+		case _, ok := <-routeChan:
+			if !ok {
+				return
+			}
+		}
+
+		notify()
+	}
+}
+
+func subscribe() (err error) {
+	done := make(chan struct{})
+	linkChan := make(chan netlink.LinkUpdate, 32)
+	addrChan := make(chan netlink.AddrUpdate, 32)
+	routeChan := make(chan netlink.RouteUpdate, 32)
+
+	errHandler := func(e error) {
+		logrus.WithFields(logrus.Fields{
+			"error": e,
+		}).Warn("netmon: Netlink subscription error")
+	}
+
+	err = netlink.LinkSubscribeWithOptions(linkChan, done,
+		netlink.LinkSubscribeOptions{
+			ErrorCallback: errHandler,
+		})
+	if err != nil {
+		close(done)
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "netmon: Failed to subscribe to links"),
+		}
+		return
+	}
+
+	err = netlink.AddrSubscribeWithOptions(addrChan, done,
+		netlink.AddrSubscribeOptions{
+			ErrorCallback: errHandler,
+		})
+	if err != nil {
+		close(done)
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "netmon: Failed to subscribe to addresses"),
+		}
+		return
+	}
+
+	err = netlink.RouteSubscribeWithOptions(routeChan, done,
+		netlink.RouteSubscribeOptions{
+			ErrorCallback: errHandler,
+		})
+	if err != nil {
+		close(done)
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "netmon: Failed to subscribe to routes"),
+		}
+		return
+	}
+
+	go watch(linkChan, addrChan, routeChan, done)
+
+	return
+}
+
+// Path returns the interface, gateway and source address used to reach
+// the destination, packets with the mark bypass tunnel policy routing
+func Path(dest net.IP, mark int) (path string, err error) {
+	routes, err := netlink.RouteGetWithOptions(dest,
+		&netlink.RouteGetOptions{
+			Mark: uint32(mark),
+		})
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrapf(err, "netmon: Failed to get route to '%s'", dest),
+		}
+		return
+	}
+
+	if len(routes) == 0 {
+		return
+	}
+	route := routes[0]
+
+	iface := ""
+	link, e := netlink.LinkByIndex(route.LinkIndex)
+	if e == nil {
+		iface = link.Attrs().Name
+	}
+
+	path = fmt.Sprintf("%s/%s/%s", iface, route.Gw, route.Src)
+
+	return
+}
@@ -0,0 +1,35 @@
+package netmon
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDebounce(t *testing.T) {
+	debounce = 200 * time.Millisecond
+	defer func() {
+		debounce = 3 * time.Second
+	}()
+
+	count := int32(0)
+	go run(func() {
+		atomic.AddInt32(&count, 1)
+	})
+
+	for i := 0; i < 5; i++ {
+		notify()
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if atomic.LoadInt32(&count) != 0 {
+		t.Fatal("netmon: Handler called before changes settled")
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	if atomic.LoadInt32(&count) != 1 {
+		t.Fatalf("netmon: Expected one handler call, got %d",
+			atomic.LoadInt32(&count))
+	}
+}
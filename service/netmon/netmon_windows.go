@@ -0,0 +1,19 @@
+package netmon
+
+import (
+	"net"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+)
+
+func subscribe() (err error) {
+	err = &errortypes.ExecError{
+		errors.New("netmon: Not implemented"),
+	}
+	return
+}
+
+func Path(dest net.IP, mark int) (path string, err error) {
+	return
+}
@@ -0,0 +1,96 @@
+package peercred
+
+import (
+	"context"
+	"net"
+	"os/user"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+type contextKey struct{}
+
+type Cred struct {
+	Uid int
+	Gid int
+	Pid int
+}
+
+func (c *Cred) UidStr() string {
+	return strconv.Itoa(c.Uid)
+}
+
+func (c *Cred) GidStr() string {
+	return strconv.Itoa(c.Gid)
+}
+
+// InGroup checks the primary and supplementary groups of the peer user,
+// the group can be a group name or gid
+func (c *Cred) InGroup(group string) bool {
+	if group == "" {
+		return false
+	}
+
+	gid := group
+	if _, err := strconv.Atoi(group); err != nil {
+		grp, e := user.LookupGroup(group)
+		if e != nil {
+			return false
+		}
+		gid = grp.Gid
+	}
+
+	if gid == c.GidStr() {
+		return true
+	}
+
+	usr, err := user.LookupId(c.UidStr())
+	if err != nil {
+		return false
+	}
+
+	gids, err := usr.GroupIds()
+	if err != nil {
+		return false
+	}
+
+	for _, userGid := range gids {
+		if userGid == gid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ConnContext stores the peer credentials of unix socket connections in
+// the connection context for use with http.Server, connections with
+// unreadable credentials are given an unknown uid
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+
+	cred, err := getCred(unixConn)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("peercred: Failed to read socket peer credentials")
+
+		cred = &Cred{
+			Uid: -1,
+			Gid: -1,
+		}
+	} else if cred == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, contextKey{}, cred)
+}
+
+func FromContext(ctx context.Context) (cred *Cred) {
+	cred, _ = ctx.Value(contextKey{}).(*Cred)
+	return
+}
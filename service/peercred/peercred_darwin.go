@@ -0,0 +1,50 @@
+package peercred
+
+import (
+	"net"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"golang.org/x/sys/unix"
+)
+
+func getCred(conn *net.UnixConn) (cred *Cred, err error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "peercred: Failed to get raw connection"),
+		}
+		return
+	}
+
+	var xucred *unix.Xucred
+	var pid int
+	var credErr error
+	err = rawConn.Control(func(fd uintptr) {
+		xucred, credErr = unix.GetsockoptXucred(int(fd),
+			unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+		if credErr == nil {
+			pid, _ = unix.GetsockoptInt(int(fd),
+				unix.SOL_LOCAL, unix.LOCAL_PEERPID)
+		}
+	})
+	if err == nil {
+		err = credErr
+	}
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "peercred: Failed to get peer credentials"),
+		}
+		return
+	}
+
+	cred = &Cred{
+		Uid: int(xucred.Uid),
+		Pid: pid,
+	}
+	if xucred.Ngroups > 0 {
+		cred.Gid = int(xucred.Groups[0])
+	}
+
+	return
+}
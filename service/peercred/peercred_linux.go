@@ -0,0 +1,43 @@
+package peercred
+
+import (
+	"net"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"golang.org/x/sys/unix"
+)
+
+func getCred(conn *net.UnixConn) (cred *Cred, err error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "peercred: Failed to get raw connection"),
+		}
+		return
+	}
+
+	var ucred *unix.Ucred
+	var credErr error
+	err = rawConn.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd),
+			unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err == nil {
+		err = credErr
+	}
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "peercred: Failed to get peer credentials"),
+		}
+		return
+	}
+
+	cred = &Cred{
+		Uid: int(ucred.Uid),
+		Gid: int(ucred.Gid),
+		Pid: int(ucred.Pid),
+	}
+
+	return
+}
@@ -0,0 +1,62 @@
+package peercred
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestConnContext(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("peercred: Peer credentials not supported")
+	}
+
+	pth := filepath.Join(t.TempDir(), "test.sock")
+
+	listener, err := net.Listen("unix", pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, e := net.Dial("unix", pth)
+		if e == nil {
+			defer conn.Close()
+			buf := make([]byte, 1)
+			_, _ = conn.Read(buf)
+		}
+	}()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx := ConnContext(context.Background(), conn)
+
+	cred := FromContext(ctx)
+	if cred == nil {
+		t.Fatal("peercred: Missing peer credentials")
+	}
+	if cred.Uid != os.Getuid() {
+		t.Fatalf("peercred: Unexpected uid %d", cred.Uid)
+	}
+	if runtime.GOOS == "linux" && cred.Pid != os.Getpid() {
+		t.Fatalf("peercred: Unexpected pid %d", cred.Pid)
+	}
+	if !cred.InGroup(cred.GidStr()) {
+		t.Fatal("peercred: Expected primary group membership")
+	}
+	if cred.InGroup("") {
+		t.Fatal("peercred: Unexpected empty group membership")
+	}
+
+	if FromContext(ConnContext(context.Background(), nil)) != nil {
+		t.Fatal("peercred: Unexpected credentials for non unix conn")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/pritunl/pritunl-client-electron/service/errortypes"
 	"github.com/pritunl/pritunl-client-electron/service/handlers"
+	"github.com/pritunl/pritunl-client-electron/service/peercred"
 )
 
 type Router struct {
@@ -101,6 +102,7 @@ func (r *Router) Init() {
 		ReadTimeout:    300 * time.Second,
 		WriteTimeout:   300 * time.Second,
 		MaxHeaderBytes: 4096,
+		ConnContext:    peercred.ConnContext,
 	}
 
 	return
@@ -0,0 +1,84 @@
+package splittun
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	configs     = map[string]*Config{}
+	configsLock = sync.Mutex{}
+)
+
+type Config struct {
+	Iface      string
+	Include    []string
+	Exclude    []string
+	DnsServers []string
+	Owner      string
+}
+
+// restricted returns if the profile is owned by a non root user, only
+// processes of the owner are split and systemd units are ignored
+func (c *Config) restricted() bool {
+	return c.Owner != "" && c.Owner != "0"
+}
+
+func IsUnit(entry string) bool {
+	return strings.HasSuffix(entry, ".service") ||
+		strings.HasSuffix(entry, ".scope") ||
+		strings.HasSuffix(entry, ".slice")
+}
+
+func getIds() (prflIds []string) {
+	prflIds = []string{}
+	for prflId := range configs {
+		prflIds = append(prflIds, prflId)
+	}
+	sort.Strings(prflIds)
+	return
+}
+
+func Set(prflId string, conf *Config) (err error) {
+	configsLock.Lock()
+	defer configsLock.Unlock()
+
+	configs[prflId] = conf
+
+	err = apply()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func Remove(prflId string) (err error) {
+	configsLock.Lock()
+	defer configsLock.Unlock()
+
+	if _, ok := configs[prflId]; !ok {
+		return
+	}
+	delete(configs, prflId)
+
+	err = release(prflId)
+	if err != nil {
+		return
+	}
+
+	err = apply()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func IsActive(prflId string) bool {
+	configsLock.Lock()
+	_, ok := configs[prflId]
+	configsLock.Unlock()
+	return ok
+}
@@ -0,0 +1,721 @@
+package splittun
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	cgroupRoot   = "/sys/fs/cgroup"
+	cgroupBase   = "pritunl"
+	tableName    = "pritunl_split"
+	markBase     = 0x5c00
+	tableBase    = 52820
+	tableRange   = 512
+	bypassTable  = tableBase + tableRange - 1
+	rulePriority = 100
+)
+
+var (
+	watchOnce   = sync.Once{}
+	unitStates  = map[string]string{}
+	origCgroups = map[string]map[int]string{}
+)
+
+type unitCgroup struct {
+	path  string
+	level int
+}
+
+func getCgroupName(prflId, kind string) string {
+	return cgroupBase + "/" + utils.FilterStr(prflId) + "_" + kind
+}
+
+func getUnitCgroup(unit string) (cgroup *unitCgroup) {
+	output, err := utils.ExecOutput(
+		"systemctl", "show", "-p", "ControlGroup", "--value", unit)
+	if err != nil {
+		return
+	}
+
+	pth := strings.Trim(strings.TrimSpace(output), "/")
+	if pth == "" {
+		return
+	}
+
+	cgroup = &unitCgroup{
+		path:  pth,
+		level: len(strings.Split(pth, "/")),
+	}
+	return
+}
+
+func getUnitState(unit string) string {
+	cgroup := getUnitCgroup(unit)
+	if cgroup == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%s:%d", cgroup.path, getInode(cgroup.path))
+}
+
+func getInode(pth string) uint64 {
+	info, err := os.Stat(filepath.Join(cgroupRoot, pth))
+	if err != nil {
+		return 0
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+
+	return stat.Ino
+}
+
+func checkCgroup2() (err error) {
+	exists, err := utils.Exists(
+		filepath.Join(cgroupRoot, "cgroup.controllers"))
+	if err != nil {
+		return
+	}
+
+	if !exists {
+		err = &errortypes.ReadError{
+			errors.New("splittun: Split tunneling requires cgroup v2"),
+		}
+		return
+	}
+
+	return
+}
+
+func mkCgroup(name string) (err error) {
+	pth := filepath.Join(cgroupRoot, name)
+
+	err = os.MkdirAll(pth, 0755)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrapf(err, "splittun: Failed to create cgroup '%s'",
+				name),
+		}
+		return
+	}
+
+	return
+}
+
+func getProcCgroup(cgroupData string) string {
+	for _, line := range strings.Split(cgroupData, "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return strings.Trim(line[3:], "/")
+		}
+	}
+	return ""
+}
+
+func moveProc(cgroup string, pid int) (err error) {
+	err = ioutil.WriteFile(
+		filepath.Join(cgroupRoot, cgroup, "cgroup.procs"),
+		[]byte(strconv.Itoa(pid)),
+		0644,
+	)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrapf(err, "splittun: Failed to move process to '%s'",
+				cgroup),
+		}
+		return
+	}
+
+	return
+}
+
+// rmCgroup returns each process to the cgroup it was moved from, falling
+// back to the root cgroup if the original no longer accepts processes
+func rmCgroup(name string) {
+	pth := filepath.Join(cgroupRoot, name)
+	orig := origCgroups[name]
+	delete(origCgroups, name)
+
+	data, err := ioutil.ReadFile(filepath.Join(pth, "cgroup.procs"))
+	if err == nil {
+		for _, pidStr := range strings.Fields(string(data)) {
+			pid, e := strconv.Atoi(pidStr)
+			if e != nil {
+				continue
+			}
+
+			cgroup, ok := orig[pid]
+			if ok && cgroup != "" {
+				e = moveProc(cgroup, pid)
+				if e == nil {
+					continue
+				}
+
+				logrus.WithFields(logrus.Fields{
+					"pid":    pid,
+					"cgroup": cgroup,
+					"error":  e,
+				}).Warn("splittun: Failed to restore process cgroup")
+			}
+
+			_ = moveProc("", pid)
+		}
+	}
+
+	_ = os.Remove(pth)
+}
+
+func pruneOrigCgroups() {
+	for _, procs := range origCgroups {
+		for pid := range procs {
+			exists, _ := utils.Exists(fmt.Sprintf("/proc/%d", pid))
+			if !exists {
+				delete(procs, pid)
+			}
+		}
+	}
+}
+
+func clearRouting() {
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		rules, err := netlink.RuleList(family)
+		if err == nil {
+			for _, rule := range rules {
+				if rule.Table >= tableBase &&
+					rule.Table < tableBase+tableRange {
+
+					_ = netlink.RuleDel(&rule)
+				}
+			}
+		}
+
+		routes, err := netlink.RouteListFiltered(
+			family,
+			&netlink.Route{
+				Table: unix.RT_TABLE_UNSPEC,
+			},
+			netlink.RT_FILTER_TABLE,
+		)
+		if err != nil {
+			continue
+		}
+
+		for _, route := range routes {
+			if route.Table >= tableBase &&
+				route.Table < tableBase+tableRange {
+
+				_ = netlink.RouteDel(&route)
+			}
+		}
+	}
+}
+
+func addRule(mark, table int) (err error) {
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		rule := netlink.NewRule()
+		rule.Family = family
+		rule.Mark = uint32(mark)
+		rule.Table = table
+		rule.Priority = rulePriority
+
+		err = netlink.RuleAdd(rule)
+		if err != nil && err != unix.EEXIST {
+			err = &errortypes.ExecError{
+				errors.Wrap(err, "splittun: Failed to add fwmark rule"),
+			}
+			return
+		}
+		err = nil
+	}
+
+	return
+}
+
+func setIncludeRoutes(link netlink.Link, table int) (err error) {
+	err = netlink.RouteReplace(&netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst: &net.IPNet{
+			IP:   net.IPv4zero,
+			Mask: net.CIDRMask(0, 32),
+		},
+		Table: table,
+	})
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "splittun: Failed to add include route"),
+		}
+		return
+	}
+
+	_ = netlink.RouteReplace(&netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst: &net.IPNet{
+			IP:   net.IPv6zero,
+			Mask: net.CIDRMask(0, 128),
+		},
+		Table: table,
+	})
+
+	return
+}
+
+func addDnsRule(server string, table int) (err error) {
+	ip := net.ParseIP(server)
+	if ip == nil {
+		return
+	}
+
+	rule := netlink.NewRule()
+	if ip.To4() != nil {
+		rule.Family = netlink.FAMILY_V4
+		rule.Dst = &net.IPNet{
+			IP:   ip.To4(),
+			Mask: net.CIDRMask(32, 32),
+		}
+	} else {
+		rule.Family = netlink.FAMILY_V6
+		rule.Dst = &net.IPNet{
+			IP:   ip,
+			Mask: net.CIDRMask(128, 128),
+		}
+	}
+	rule.Table = table
+	rule.Priority = rulePriority + 1
+
+	err = netlink.RuleAdd(rule)
+	if err != nil && err != unix.EEXIST {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "splittun: Failed to add dns rule"),
+		}
+		return
+	}
+	err = nil
+
+	return
+}
+
+func addBypassRule(table int) (err error) {
+	mask := uint32(0xffffffff)
+
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		rule := netlink.NewRule()
+		rule.Family = family
+		rule.Mark = 0
+		rule.Mask = &mask
+		rule.UIDRange = netlink.NewRuleUIDRange(1, 0xfffffffe)
+		rule.Table = table
+		rule.Priority = rulePriority + 2
+
+		err = netlink.RuleAdd(rule)
+		if err != nil && err != unix.EEXIST {
+			err = &errortypes.ExecError{
+				errors.Wrap(err, "splittun: Failed to add bypass rule"),
+			}
+			return
+		}
+		err = nil
+	}
+
+	return
+}
+
+func setExcludeRoutes(table int, links ...netlink.Link) (err error) {
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		routes, e := netlink.RouteListFiltered(
+			family,
+			&netlink.Route{
+				Table: unix.RT_TABLE_MAIN,
+			},
+			netlink.RT_FILTER_TABLE,
+		)
+		if e != nil {
+			err = &errortypes.ReadError{
+				errors.Wrap(e, "splittun: Failed to read main routes"),
+			}
+			return
+		}
+
+	routesLoop:
+		for _, route := range routes {
+			for _, link := range links {
+				if route.LinkIndex == link.Attrs().Index {
+					continue routesLoop
+				}
+			}
+
+			route.Table = table
+			_ = netlink.RouteReplace(&route)
+		}
+	}
+
+	return
+}
+
+func apply() (err error) {
+	clearRouting()
+	unitStates = map[string]string{}
+
+	if len(configs) == 0 {
+		err = flushNft()
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	err = checkCgroup2()
+	if err != nil {
+		return
+	}
+
+	err = mkCgroup(cgroupBase)
+	if err != nil {
+		return
+	}
+
+	markRules := ""
+	natRules := ""
+	inclLinks := []netlink.Link{}
+
+	for i, prflId := range getIds() {
+		conf := configs[prflId]
+		inclMark := markBase + i*2
+		exclMark := inclMark + 1
+		inclTable := tableBase + i*2
+		exclTable := inclTable + 1
+
+		iface := utils.FilterStr(conf.Iface)
+		if iface == "" {
+			continue
+		}
+
+		link, e := netlink.LinkByName(iface)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"profile_id": prflId,
+				"iface":      iface,
+				"error":      e,
+			}).Warn("splittun: Skipping profile with missing interface")
+			continue
+		}
+
+		for _, kind := range []string{"include", "exclude"} {
+			entries := conf.Include
+			mark := inclMark
+			if kind == "exclude" {
+				entries = conf.Exclude
+				mark = exclMark
+			}
+
+			if len(entries) == 0 {
+				continue
+			}
+
+			cgroupName := getCgroupName(prflId, kind)
+			err = mkCgroup(cgroupName)
+			if err != nil {
+				return
+			}
+
+			markRules += fmt.Sprintf(
+				"\t\tsocket cgroupv2 level 2 \"%s\" meta mark set 0x%x\n",
+				cgroupName, mark)
+
+			for _, entry := range entries {
+				if !IsUnit(entry) || conf.restricted() {
+					continue
+				}
+
+				cgroup := getUnitCgroup(entry)
+				if cgroup == nil {
+					unitStates[entry] = ""
+					continue
+				}
+				unitStates[entry] = fmt.Sprintf("%s:%d",
+					cgroup.path, getInode(cgroup.path))
+
+				markRules += fmt.Sprintf(
+					"\t\tsocket cgroupv2 level %d \"%s\" "+
+						"meta mark set 0x%x\n",
+					cgroup.level, cgroup.path, mark)
+			}
+
+			if kind == "include" {
+				err = setIncludeRoutes(link, inclTable)
+				if err != nil {
+					return
+				}
+
+				err = addRule(inclMark, inclTable)
+				if err != nil {
+					return
+				}
+
+				for _, server := range conf.DnsServers {
+					err = addDnsRule(server, inclTable)
+					if err != nil {
+						return
+					}
+				}
+
+				inclLinks = append(inclLinks, link)
+
+				natRules += fmt.Sprintf(
+					"\t\tmeta mark 0x%x oifname \"%s\" masquerade\n",
+					inclMark, iface)
+			} else {
+				err = setExcludeRoutes(exclTable, link)
+				if err != nil {
+					return
+				}
+
+				err = addRule(exclMark, exclTable)
+				if err != nil {
+					return
+				}
+
+				natRules += fmt.Sprintf(
+					"\t\tmeta mark 0x%x oifname != \"%s\" masquerade\n",
+					exclMark, iface)
+			}
+		}
+	}
+
+	// Unmarked traffic from included profiles is steered around the
+	// tunnel using the main routes without the tunnel interfaces. Root
+	// traffic is left on the main table so the service can still reach
+	// the server. Traffic to the tunnel dns servers is matched first so
+	// system resolvers such as systemd-resolved can reach them.
+	if len(inclLinks) > 0 {
+		err = setExcludeRoutes(bypassTable, inclLinks...)
+		if err != nil {
+			return
+		}
+
+		err = addBypassRule(bypassTable)
+		if err != nil {
+			return
+		}
+	}
+
+	ruleset := fmt.Sprintf("table inet %s\n", tableName)
+	ruleset += fmt.Sprintf("delete table inet %s\n", tableName)
+	ruleset += fmt.Sprintf("table inet %s {\n", tableName)
+	ruleset += "\tchain output {\n"
+	ruleset += "\t\ttype route hook output priority mangle; policy accept;\n"
+	ruleset += markRules
+	ruleset += "\t}\n"
+	ruleset += "\tchain postrouting {\n"
+	ruleset += "\t\ttype nat hook postrouting priority srcnat; " +
+		"policy accept;\n"
+	ruleset += natRules
+	ruleset += "\t}\n"
+	ruleset += "}\n"
+
+	err = execNft(ruleset)
+	if err != nil {
+		return
+	}
+
+	watchOnce.Do(func() {
+		go watch()
+	})
+
+	return
+}
+
+func release(prflId string) (err error) {
+	rmCgroup(getCgroupName(prflId, "include"))
+	rmCgroup(getCgroupName(prflId, "exclude"))
+	return
+}
+
+func execNft(ruleset string) (err error) {
+	nftPath, _ := exec.LookPath("nft")
+	if nftPath == "" {
+		err = &errortypes.ExecError{
+			errors.New("splittun: Failed to find nft command"),
+		}
+		return
+	}
+
+	_, err = utils.ExecInputOutput(ruleset, nftPath, "-f", "-")
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "splittun: Failed to apply nftables rules"),
+		}
+		return
+	}
+
+	return
+}
+
+func flushNft() (err error) {
+	nftPath, _ := exec.LookPath("nft")
+	if nftPath == "" {
+		return
+	}
+
+	err = execNft(fmt.Sprintf("table inet %s\ndelete table inet %s\n",
+		tableName, tableName))
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func matchExe(entry, exe string) bool {
+	if strings.Contains(entry, "/") {
+		return entry == exe
+	}
+	return entry == filepath.Base(exe)
+}
+
+// isUserScope returns if the cgroup is a scope in a user session,
+// processes managed by systemd units are left in the unit cgroup so
+// systemd keeps tracking them, these are split using the unit name
+func isUserScope(cgroup string) bool {
+	return strings.HasPrefix(cgroup, "user.slice/") &&
+		strings.HasSuffix(cgroup, ".scope")
+}
+
+func getProcUid(pid int) string {
+	info, err := os.Stat(fmt.Sprintf("/proc/%d", pid))
+	if err != nil {
+		return ""
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+
+	return strconv.Itoa(int(stat.Uid))
+}
+
+func assignProcs() {
+	pruneOrigCgroups()
+
+	pids, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return
+	}
+
+	for _, pidDir := range pids {
+		pid, e := strconv.Atoi(pidDir.Name())
+		if e != nil || pid <= 1 {
+			continue
+		}
+
+		exe, e := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+		if e != nil || exe == "" {
+			continue
+		}
+		uid := getProcUid(pid)
+
+		for _, prflId := range getIds() {
+			conf := configs[prflId]
+			if conf.restricted() && conf.Owner != uid {
+				continue
+			}
+
+			for _, kind := range []string{"include", "exclude"} {
+				entries := conf.Include
+				if kind == "exclude" {
+					entries = conf.Exclude
+				}
+
+				for _, entry := range entries {
+					if IsUnit(entry) || !matchExe(entry, exe) {
+						continue
+					}
+
+					cgroupName := getCgroupName(prflId, kind)
+					cgroupData, _ := ioutil.ReadFile(
+						fmt.Sprintf("/proc/%d/cgroup", pid))
+					if strings.Contains(string(cgroupData), cgroupName) {
+						continue
+					}
+
+					procCgroup := getProcCgroup(string(cgroupData))
+					if !isUserScope(procCgroup) {
+						continue
+					}
+
+					e = moveProc(cgroupName, pid)
+					if e != nil {
+						continue
+					}
+
+					if origCgroups[cgroupName] == nil {
+						origCgroups[cgroupName] = map[int]string{}
+					}
+					origCgroups[cgroupName][pid] = procCgroup
+				}
+			}
+		}
+	}
+}
+
+func unitsChanged() bool {
+	for unit, state := range unitStates {
+		if getUnitState(unit) != state {
+			return true
+		}
+	}
+	return false
+}
+
+func watch() {
+	defer func() {
+		panc := recover()
+		if panc != nil {
+			logrus.WithFields(logrus.Fields{
+				"trace": string(debug.Stack()),
+				"panic": panc,
+			}).Error("splittun: Watch panic")
+		}
+	}()
+
+	for i := 0; ; i++ {
+		time.Sleep(2 * time.Second)
+
+		configsLock.Lock()
+		if len(configs) == 0 {
+			configsLock.Unlock()
+			continue
+		}
+
+		assignProcs()
+
+		if i%5 == 0 && unitsChanged() {
+			err := apply()
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": err,
+				}).Error("splittun: Failed to update unit rules")
+			}
+		}
+		configsLock.Unlock()
+	}
+}
@@ -0,0 +1,21 @@
+package splittun
+
+import (
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+)
+
+func apply() (err error) {
+	if len(configs) == 0 {
+		return
+	}
+
+	err = &errortypes.ExecError{
+		errors.New("splittun: Not implemented"),
+	}
+	return
+}
+
+func release(prflId string) (err error) {
+	return
+}
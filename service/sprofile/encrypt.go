@@ -0,0 +1,142 @@
+package sprofile
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	confPrefix = "$pritunl$1$"
+	confInfo   = "pritunl-client-profile-store"
+)
+
+func deriveKey(secret string) (key *[32]byte, err error) {
+	key = &[32]byte{}
+	_, err = io.ReadFull(
+		hkdf.New(sha256.New, []byte(secret), nil, []byte(confInfo)),
+		key[:],
+	)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "sprofile: Failed to derive profile key"),
+		}
+		return
+	}
+
+	return
+}
+
+// getKeys returns the profile store key followed by any fallback keys,
+// the enclave key is preferred and the profile secret is generated on
+// first use when no enclave key is available
+func getKeys() (keys []*[32]byte, err error) {
+	secrets := []string{}
+
+	if config.Config.EnclavePrivateKey != "" {
+		secrets = append(secrets, config.Config.EnclavePrivateKey)
+	}
+
+	if config.Config.ProfileSecret == "" {
+		secret, e := utils.RandStrComplex(64)
+		if e != nil {
+			err = e
+			return
+		}
+
+		config.Config.ProfileSecret = secret
+		err = config.Save()
+		if err != nil {
+			return
+		}
+	}
+	secrets = append(secrets, config.Config.ProfileSecret)
+
+	for _, secret := range secrets {
+		key, e := deriveKey(secret)
+		if e != nil {
+			err = e
+			return
+		}
+		keys = append(keys, key)
+	}
+
+	return
+}
+
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(confPrefix))
+}
+
+func encryptConf(data []byte, key *[32]byte) (encData []byte, err error) {
+	var nonce [24]byte
+	_, err = rand.Read(nonce[:])
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "sprofile: Failed to generate nonce"),
+		}
+		return
+	}
+
+	encrypted := secretbox.Seal(nonce[:], data, &nonce, key)
+
+	encData = []byte(confPrefix +
+		base64.StdEncoding.EncodeToString(encrypted))
+
+	return
+}
+
+// decryptConf returns the plaintext conf and the index of the key that
+// opened it, plaintext files are returned unchanged with index -1
+func decryptConf(encData []byte, keys []*[32]byte) (
+	data []byte, keyIndex int, err error) {
+
+	if !isEncrypted(encData) {
+		data = encData
+		keyIndex = -1
+		return
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(string(
+		bytes.TrimSpace(encData[len(confPrefix):])))
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "sprofile: Failed to decode profile conf"),
+		}
+		return
+	}
+
+	if len(encrypted) < 24 {
+		err = &errortypes.ParseError{
+			errors.New("sprofile: Profile conf truncated"),
+		}
+		return
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], encrypted[:24])
+
+	for i, key := range keys {
+		plain, ok := secretbox.Open(nil, encrypted[24:], &nonce, key)
+		if ok {
+			data = plain
+			keyIndex = i
+			return
+		}
+	}
+
+	err = &errortypes.ReadError{
+		errors.New("sprofile: Failed to decrypt profile conf, " +
+			"profile key unavailable"),
+	}
+	return
+}
@@ -0,0 +1,118 @@
+package sprofile
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/pritunl/pritunl-client-electron/service/config"
+)
+
+func setTestSecrets(t *testing.T, enclave, secret string) {
+	t.Helper()
+
+	prevEnclave := config.Config.EnclavePrivateKey
+	prevSecret := config.Config.ProfileSecret
+	t.Cleanup(func() {
+		config.Config.EnclavePrivateKey = prevEnclave
+		config.Config.ProfileSecret = prevSecret
+	})
+
+	config.Config.EnclavePrivateKey = enclave
+	config.Config.ProfileSecret = secret
+}
+
+func TestEncryptConf(t *testing.T) {
+	setTestSecrets(t, "", "secret")
+
+	keys, err := getKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("sprofile: Expected 1 key, got %d", len(keys))
+	}
+
+	data, err := json.Marshal(&Sprofile{
+		Id:       "test",
+		Password: "password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encData, err := encryptConf(data, keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncrypted(encData) || bytes.Contains(encData, []byte("password")) {
+		t.Fatal("sprofile: Profile conf not encrypted")
+	}
+
+	plain, keyIndex, err := decryptConf(encData, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyIndex != 0 || !bytes.Equal(plain, data) {
+		t.Fatal("sprofile: Profile conf decrypt mismatch")
+	}
+
+	plain, keyIndex, err = decryptConf(data, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyIndex != -1 || !bytes.Equal(plain, data) {
+		t.Fatal("sprofile: Expected plaintext profile conf passthrough")
+	}
+}
+
+func TestEncryptConfRekey(t *testing.T) {
+	setTestSecrets(t, "", "secret")
+
+	keys, err := getKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(`{"id":"test"}`)
+	encData, err := encryptConf(data, keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.Config.EnclavePrivateKey = "enclave"
+
+	keys, err = getKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("sprofile: Expected 2 keys, got %d", len(keys))
+	}
+
+	_, keyIndex, err := decryptConf(encData, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyIndex != 1 {
+		t.Fatalf("sprofile: Expected fallback key, got %d", keyIndex)
+	}
+
+	encData, err = encryptConf(data, keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.Config.EnclavePrivateKey = "other"
+	config.Config.ProfileSecret = "other"
+
+	keys, err = getKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = decryptConf(encData, keys)
+	if err == nil {
+		t.Fatal("sprofile: Expected decrypt error with unknown key")
+	}
+}
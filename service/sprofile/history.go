@@ -0,0 +1,107 @@
+package sprofile
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+)
+
+const (
+	historyMax = 200
+)
+
+var (
+	historyLock = sync.Mutex{}
+)
+
+type Session struct {
+	Id         string   `json:"id"`
+	Mode       string   `json:"mode"`
+	Start      int64    `json:"start"`
+	End        int64    `json:"end"`
+	Connected  int64    `json:"connected"`
+	Remote     string   `json:"remote"`
+	ClientAddr string   `json:"client_addr"`
+	ServerAddr string   `json:"server_addr"`
+	RxBytes    int64    `json:"rx_bytes"`
+	TxBytes    int64    `json:"tx_bytes"`
+	Auth       string   `json:"auth"`
+	Reason     string   `json:"reason"`
+	Events     []string `json:"events"`
+}
+
+func (s *Sprofile) readHistory() (sessions []*Session, err error) {
+	sessions = []*Session{}
+
+	data, err := ioutil.ReadFile(s.BasePath() + ".history")
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "sprofile: Failed to read history file"),
+		}
+		return
+	}
+
+	err = json.Unmarshal(data, &sessions)
+	if err != nil {
+		sessions = []*Session{}
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "sprofile: Failed to parse history file"),
+		}
+		return
+	}
+
+	return
+}
+
+func (s *Sprofile) GetHistory() (sessions []*Session, err error) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	sessions, err = s.readHistory()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (s *Sprofile) PushHistory(sess *Session) (err error) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	sessions, err := s.readHistory()
+	if err != nil {
+		sessions = []*Session{}
+		err = nil
+	}
+
+	sessions = append(sessions, sess)
+	if len(sessions) > historyMax {
+		sessions = sessions[len(sessions)-historyMax:]
+	}
+
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "sprofile: Failed to marshal history"),
+		}
+		return
+	}
+
+	err = utils.CreateWrite(s.BasePath()+".history", string(data), 0600)
+	if err != nil {
+		return
+	}
+
+	return
+}
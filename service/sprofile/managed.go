@@ -0,0 +1,538 @@
+package sprofile
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	managedClient = &http.Client{
+		Timeout: 15 * time.Second,
+	}
+	managedClientInsecure = &http.Client{
+		Transport: &http.Transport{
+			TLSHandshakeTimeout: 10 * time.Second,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+		Timeout: 15 * time.Second,
+	}
+)
+
+type Manifest struct {
+	Path           string                 `json:"-" yaml:"-"`
+	Hash           string                 `json:"-" yaml:"-"`
+	Uri            string                 `json:"uri" yaml:"uri"`
+	Ovpn           string                 `json:"ovpn" yaml:"ovpn"`
+	Conf           map[string]interface{} `json:"conf" yaml:"conf"`
+	State          *bool                  `json:"state" yaml:"state"`
+	Mode           string                 `json:"mode" yaml:"mode"`
+	DisableDns     *bool                  `json:"disable_dns" yaml:"disable_dns"`
+	DisableGateway *bool                  `json:"disable_gateway" yaml:"disable_gateway"`
+	ForceDns       *bool                  `json:"force_dns" yaml:"force_dns"`
+	Lockdown       *bool                  `json:"lockdown" yaml:"lockdown"`
+	SplitInclude   []string               `json:"split_include" yaml:"split_include"`
+	SplitExclude   []string               `json:"split_exclude" yaml:"split_exclude"`
+}
+
+func (m *Manifest) profileId(key string) string {
+	hash := sha256.Sum256([]byte(filepath.Base(m.Path) + ":" + key))
+	return fmt.Sprintf("%x", hash[:16])
+}
+
+func (m *Manifest) state(sprfl *Sprofile) bool {
+	if m.State != nil {
+		return *m.State
+	}
+	return !sprfl.Disabled
+}
+
+func (m *Manifest) apply(sprfl *Sprofile) (changed bool) {
+	if sprfl.ManagedPath != m.Path || sprfl.ManagedHash != m.Hash {
+		sprfl.ManagedPath = m.Path
+		sprfl.ManagedHash = m.Hash
+		changed = true
+	}
+
+	if m.Mode != "" && sprfl.LastMode != m.Mode {
+		sprfl.LastMode = m.Mode
+		changed = true
+	}
+
+	if m.State != nil && sprfl.Disabled != !*m.State {
+		sprfl.Disabled = !*m.State
+		changed = true
+	}
+
+	if m.DisableDns != nil && sprfl.DisableDns != *m.DisableDns {
+		sprfl.DisableDns = *m.DisableDns
+		changed = true
+	}
+
+	if m.DisableGateway != nil &&
+		sprfl.DisableGateway != *m.DisableGateway {
+
+		sprfl.DisableGateway = *m.DisableGateway
+		changed = true
+	}
+
+	if m.ForceDns != nil && sprfl.ForceDns != *m.ForceDns {
+		sprfl.ForceDns = *m.ForceDns
+		changed = true
+	}
+
+	if m.Lockdown != nil && sprfl.Lockdown != *m.Lockdown {
+		sprfl.Lockdown = *m.Lockdown
+		changed = true
+	}
+
+	if m.SplitInclude != nil &&
+		strings.Join(sprfl.SplitInclude, "\n") !=
+			strings.Join(m.SplitInclude, "\n") {
+
+		sprfl.SplitInclude = m.SplitInclude
+		changed = true
+	}
+
+	if m.SplitExclude != nil &&
+		strings.Join(sprfl.SplitExclude, "\n") !=
+			strings.Join(m.SplitExclude, "\n") {
+
+		sprfl.SplitExclude = m.SplitExclude
+		changed = true
+	}
+
+	return
+}
+
+func (m *Manifest) fetchUri() (datas map[string]string, err error) {
+	uri := strings.Replace(m.Uri, "pritunl://", "https://", 1)
+	uri = strings.Replace(uri, "/k/", "/ku/", 1)
+
+	uriParsed, err := url.Parse(uri)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "sprofile: Failed to parse managed profile uri"),
+		}
+		return
+	}
+
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Managed profile request error"),
+		}
+		return
+	}
+
+	req.Header.Set("User-Agent", "pritunl")
+
+	client := managedClient
+	if net.ParseIP(uriParsed.Hostname()) != nil {
+		client = managedClientInsecure
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "sprofile: Managed profile request failed"),
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		err = &errortypes.RequestError{
+			errors.Newf("sprofile: Managed profile uri error %d",
+				resp.StatusCode),
+		}
+		return
+	}
+
+	datas = map[string]string{}
+	err = json.NewDecoder(resp.Body).Decode(&datas)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "sprofile: Failed to parse uri response body"),
+		}
+		return
+	}
+
+	return
+}
+
+func (m *Manifest) Profiles() (sprfls []*Sprofile, err error) {
+	sprfls = []*Sprofile{}
+
+	if m.Uri != "" {
+		datas, e := m.fetchUri()
+		if e != nil {
+			err = e
+			return
+		}
+
+		keys := []string{}
+		for key := range datas {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			sprfl, e := parseProfileData(datas[key])
+			if e != nil {
+				err = e
+				return
+			}
+
+			sprfl.Id = m.profileId(key)
+			m.apply(sprfl)
+			sprfls = append(sprfls, sprfl)
+		}
+	} else if m.Ovpn != "" {
+		sprfl, e := parseProfileData(m.Ovpn)
+		if e != nil {
+			err = e
+			return
+		}
+
+		if m.Conf != nil {
+			confData, e := json.Marshal(m.Conf)
+			if e != nil {
+				err = &errortypes.ParseError{
+					errors.Wrap(e, "sprofile: Failed to marshal manifest conf"),
+				}
+				return
+			}
+
+			e = json.Unmarshal(confData, sprfl)
+			if e != nil {
+				err = &errortypes.ParseError{
+					errors.Wrap(e, "sprofile: Failed to parse manifest conf"),
+				}
+				return
+			}
+		}
+
+		sprfl.Id = m.profileId("")
+		m.apply(sprfl)
+		sprfls = append(sprfls, sprfl)
+	} else {
+		err = &errortypes.ParseError{
+			errors.New("sprofile: Manifest missing uri or ovpn"),
+		}
+		return
+	}
+
+	return
+}
+
+func parseProfileData(data string) (sprfl *Sprofile, err error) {
+	sprfl = &Sprofile{}
+
+	jsonData := ""
+	jsonFound := false
+	jsonLoaded := false
+
+	dataLines := strings.Split(data, "\n")
+	data = ""
+	for _, line := range dataLines {
+		if !jsonLoaded && !jsonFound && line == "#{" {
+			jsonFound = true
+			jsonLoaded = true
+		}
+
+		if jsonFound && strings.HasPrefix(line, "#") {
+			if line == "#}" {
+				jsonFound = false
+			}
+			jsonData += strings.Replace(line, "#", "", 1)
+		} else {
+			data += line + "\n"
+		}
+	}
+
+	if jsonLoaded {
+		err = json.Unmarshal([]byte(jsonData), sprfl)
+		if err != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(err, "sprofile: Failed to parse profile conf data"),
+			}
+			return
+		}
+	}
+
+	sprfl.OvpnData = data
+
+	return
+}
+
+func GetManagedPath() string {
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(utils.GetWinDrive(), "ProgramData",
+			"Pritunl", "profiles.d")
+	case "darwin":
+		return filepath.Join("/", "etc", "pritunl-client", "profiles.d")
+	case "linux":
+		return filepath.Join("/", "etc", "pritunl-client", "profiles.d")
+	default:
+		panic("profile: Not implemented")
+	}
+}
+
+func ReadManifest(pth string) (mnfst *Manifest, err error) {
+	data, err := ioutil.ReadFile(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "sprofile: Failed to read manifest"),
+		}
+		return
+	}
+
+	hash := sha256.Sum256(data)
+	mnfst = &Manifest{
+		Path: pth,
+		Hash: fmt.Sprintf("%x", hash),
+	}
+
+	if strings.HasSuffix(pth, ".json") {
+		err = json.Unmarshal(data, mnfst)
+	} else {
+		err = yaml.Unmarshal(data, mnfst)
+	}
+	if err != nil {
+		mnfst = nil
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "sprofile: Failed to parse manifest"),
+		}
+		return
+	}
+
+	return
+}
+
+func readManifests(dirPth string) (mnfsts []*Manifest, err error) {
+	mnfsts = []*Manifest{}
+
+	files, err := ioutil.ReadDir(dirPth)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "sprofile: Failed to read managed directory"),
+		}
+		return
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || strings.HasPrefix(name, ".") ||
+			!(strings.HasSuffix(name, ".yaml") ||
+				strings.HasSuffix(name, ".yml") ||
+				strings.HasSuffix(name, ".json")) {
+
+			continue
+		}
+
+		mnfst, e := ReadManifest(filepath.Join(dirPth, name))
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"path":  filepath.Join(dirPth, name),
+				"error": e,
+			}).Error("sprofile: Failed to read managed profile manifest")
+
+			// Keep existing profiles from unreadable manifests
+			mnfsts = append(mnfsts, &Manifest{
+				Path: filepath.Join(dirPth, name),
+			})
+			continue
+		}
+
+		mnfsts = append(mnfsts, mnfst)
+	}
+
+	return
+}
+
+// ManagedSignature returns a value that changes when any file in the
+// managed profiles directory is added, removed or modified.
+func ManagedSignature() string {
+	files, err := ioutil.ReadDir(GetManagedPath())
+	if err != nil {
+		return ""
+	}
+
+	sig := ""
+	for _, file := range files {
+		sig += fmt.Sprintf("%s:%d:%d;", file.Name(), file.Size(),
+			file.ModTime().UnixNano())
+	}
+
+	return sig
+}
+
+// ReconcileManaged commits profiles declared in the managed directory and
+// returns the ids of managed profiles whose manifest has been removed.
+// Profiles without a manifest path are never modified.
+func ReconcileManaged() (removed []string, err error) {
+	removed = []string{}
+
+	mnfsts, err := readManifests(GetManagedPath())
+	if err != nil {
+		return
+	}
+
+	sprfls, err := GetAll()
+	if err != nil {
+		return
+	}
+
+	existing := map[string]*Sprofile{}
+	byPath := map[string][]*Sprofile{}
+	for _, sprfl := range sprfls {
+		if sprfl.ManagedPath == "" {
+			continue
+		}
+		existing[sprfl.Id] = sprfl
+		byPath[sprfl.ManagedPath] = append(byPath[sprfl.ManagedPath], sprfl)
+	}
+
+	seen := map[string]bool{}
+	states := map[string]bool{}
+
+	for _, mnfst := range mnfsts {
+		current := byPath[mnfst.Path]
+
+		if mnfst.Hash == "" {
+			for _, sprfl := range current {
+				seen[sprfl.Id] = true
+			}
+			continue
+		}
+
+		unchanged := len(current) > 0
+		for _, sprfl := range current {
+			if sprfl.ManagedHash != mnfst.Hash {
+				unchanged = false
+				break
+			}
+		}
+
+		if unchanged {
+			for _, sprfl := range current {
+				seen[sprfl.Id] = true
+
+				if mnfst.apply(sprfl) {
+					e := sprfl.Commit()
+					if e != nil {
+						err = e
+						return
+					}
+				}
+			}
+			continue
+		}
+
+		newSprfls, e := mnfst.Profiles()
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"path":  mnfst.Path,
+				"error": e,
+			}).Error("sprofile: Failed to load managed profile")
+
+			for _, sprfl := range current {
+				seen[sprfl.Id] = true
+			}
+			continue
+		}
+
+		for _, sprfl := range newSprfls {
+			curSprfl := existing[sprfl.Id]
+			if curSprfl != nil {
+				if sprfl.RegistrationKey == "" {
+					sprfl.RegistrationKey = curSprfl.RegistrationKey
+				}
+				if len(sprfl.ServerSpkiHash) == 0 {
+					sprfl.ServerSpkiHash = curSprfl.ServerSpkiHash
+				}
+				sprfl.HostSpkiHash = curSprfl.HostSpkiHash
+				if mnfst.Mode == "" {
+					sprfl.LastMode = curSprfl.LastMode
+				}
+			}
+
+			e = sprfl.Commit()
+			if e != nil {
+				err = e
+				return
+			}
+
+			seen[sprfl.Id] = true
+			states[sprfl.Id] = mnfst.state(sprfl)
+
+			logrus.WithFields(logrus.Fields{
+				"profile_id": sprfl.Id,
+				"path":       mnfst.Path,
+				"state":      states[sprfl.Id],
+			}).Info("sprofile: Managed profile updated")
+		}
+	}
+
+	for prflId := range existing {
+		if !seen[prflId] {
+			removed = append(removed, prflId)
+		}
+	}
+
+	err = Reload()
+	if err != nil {
+		return
+	}
+
+	for prflId, state := range states {
+		setState(prflId, state)
+	}
+
+	return
+}
+
+func setState(prflId string, state bool) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	prflsCache := []*Sprofile{}
+
+	for _, prfl := range cache {
+		if prfl.Id == prflId {
+			prfl.State = state
+			if !state {
+				prfl.Interactive = false
+			}
+		}
+		prflsCache = append(prflsCache, prfl)
+	}
+
+	cache = prflsCache
+}
@@ -0,0 +1,160 @@
+package sprofile
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testProfileData = `client
+remote 198.51.100.1 1194 udp
+#{
+#  "name": "test-profile",
+#  "server": "test-server",
+#  "disable_dns": false,
+#  "disabled": true
+#}
+`
+
+func writeManifest(t *testing.T, name, data string) (pth string) {
+	t.Helper()
+
+	pth = filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(pth, []byte(data), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+func TestManifestOvpn(t *testing.T) {
+	pth := writeManifest(t, "office.yaml", `
+state: true
+mode: wg
+disable_dns: true
+split_include:
+  - firefox
+conf:
+  organization: test-org
+ovpn: |
+`+indent(testProfileData))
+
+	mnfst, err := ReadManifest(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sprfls, err := mnfst.Profiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sprfls) != 1 {
+		t.Fatalf("sprofile: Expected 1 profile, got %d", len(sprfls))
+	}
+	sprfl := sprfls[0]
+
+	if sprfl.Id != mnfst.profileId("") || len(sprfl.Id) != 32 {
+		t.Fatalf("sprofile: Unexpected profile id %s", sprfl.Id)
+	}
+	if sprfl.Name != "test-profile" || sprfl.Organization != "test-org" {
+		t.Fatalf("sprofile: Unexpected profile conf %s %s",
+			sprfl.Name, sprfl.Organization)
+	}
+	if strings.Contains(sprfl.OvpnData, "#") ||
+		!strings.Contains(sprfl.OvpnData, "remote 198.51.100.1") {
+
+		t.Fatalf("sprofile: Unexpected ovpn data %q", sprfl.OvpnData)
+	}
+	if !sprfl.DisableDns || sprfl.Disabled || sprfl.LastMode != "wg" {
+		t.Fatal("sprofile: Manifest overrides not applied")
+	}
+	if len(sprfl.SplitInclude) != 1 || sprfl.SplitInclude[0] != "firefox" {
+		t.Fatal("sprofile: Manifest split include not applied")
+	}
+	if sprfl.ManagedPath != pth || sprfl.ManagedHash != mnfst.Hash {
+		t.Fatal("sprofile: Managed path not set")
+	}
+	if !mnfst.state(sprfl) {
+		t.Fatal("sprofile: Expected managed profile state")
+	}
+
+	if mnfst.apply(sprfl) {
+		t.Fatal("sprofile: Unexpected change on second apply")
+	}
+	sprfl.DisableDns = false
+	if !mnfst.apply(sprfl) || !sprfl.DisableDns {
+		t.Fatal("sprofile: Expected override to be reapplied")
+	}
+}
+
+func TestManifestUri(t *testing.T) {
+	reqPath := ""
+	srv := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			reqPath = r.URL.Path
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"one.ovpn": testProfileData,
+				"two.ovpn": testProfileData,
+			})
+		},
+	))
+	defer srv.Close()
+
+	uri := strings.Replace(srv.URL, "https://", "pritunl://", 1) + "/k/abc"
+	pth := writeManifest(t, "fleet.json",
+		`{"uri": "`+uri+`", "disable_gateway": true}`)
+
+	mnfst, err := ReadManifest(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sprfls, err := mnfst.Profiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reqPath != "/ku/abc" {
+		t.Fatalf("sprofile: Unexpected request path %s", reqPath)
+	}
+	if len(sprfls) != 2 {
+		t.Fatalf("sprofile: Expected 2 profiles, got %d", len(sprfls))
+	}
+	if sprfls[0].Id != mnfst.profileId("one.ovpn") ||
+		sprfls[1].Id != mnfst.profileId("two.ovpn") {
+
+		t.Fatal("sprofile: Unexpected managed profile ids")
+	}
+	for _, sprfl := range sprfls {
+		if !sprfl.DisableGateway {
+			t.Fatal("sprofile: Manifest override not applied")
+		}
+		if mnfst.state(sprfl) {
+			t.Fatal("sprofile: Expected state from profile conf")
+		}
+	}
+}
+
+func TestManifestInvalid(t *testing.T) {
+	pth := writeManifest(t, "empty.yaml", "mode: wg\n")
+
+	mnfst, err := ReadManifest(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = mnfst.Profiles()
+	if err == nil {
+		t.Fatal("sprofile: Expected error for manifest without source")
+	}
+}
+
+func indent(data string) string {
+	lines := strings.Split(strings.TrimRight(data, "\n"), "\n")
+	return "  " + strings.Join(lines, "\n  ") + "\n"
+}
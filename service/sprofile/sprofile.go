@@ -4,7 +4,6 @@ import (
 	"crypto/hmac"
 	"crypto/sha512"
 	"crypto/subtle"
-	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -17,25 +16,26 @@ import (
 	"time"
 
 	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/certpin"
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/credential"
 	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/event"
+	"github.com/pritunl/pritunl-client-electron/service/metrics"
 	"github.com/pritunl/pritunl-client-electron/service/platform"
 	"github.com/pritunl/pritunl-client-electron/service/types"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/sirupsen/logrus"
 )
 
-var (
-	clientSyncInsecure = &http.Client{
+func newSyncClient(pin *certpin.Pin) *http.Client {
+	return &http.Client{
 		Transport: &http.Transport{
-			TLSHandshakeTimeout: 5 * time.Second,
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-				MinVersion:         tls.VersionTLS12,
-				MaxVersion:         tls.VersionTLS13,
-			},
+			DialTLSContext: pin.DialTls,
 		},
 		Timeout: 5 * time.Second,
 	}
-)
+}
 
 type SyncData struct {
 	Signature string `json:"signature"`
@@ -66,6 +66,18 @@ type Sprofile struct {
 	DisableDns         bool                        `json:"disable_dns"`
 	RestrictClient     bool                        `json:"restrict_client"`
 	ForceDns           bool                        `json:"force_dns"`
+	Lockdown           bool                        `json:"lockdown"`
+	SplitInclude       []string                    `json:"split_include"`
+	SplitExclude       []string                    `json:"split_exclude"`
+	PreConnectHook     string                      `json:"pre_connect_hook"`
+	PostConnectHook    string                      `json:"post_connect_hook"`
+	PreDisconnectHook  string                      `json:"pre_disconnect_hook"`
+	PostDisconnectHook string                      `json:"post_disconnect_hook"`
+	HookTimeout        int                         `json:"hook_timeout"`
+	ReconnectPolicy    *types.ReconnectPolicy      `json:"reconnect_policy"`
+	CredentialHelper   string                      `json:"credential_helper"`
+	Owner              string                      `json:"owner"`
+	OwnerGroup         string                      `json:"owner_group"`
 	SsoAuth            bool                        `json:"sso_auth"`
 	PasswordMode       string                      `json:"password_mode"`
 	Token              bool                        `json:"token"`
@@ -78,8 +90,12 @@ type Sprofile struct {
 	SyncToken          string                      `json:"sync_token"`
 	ServerPublicKey    []string                    `json:"server_public_key"`
 	ServerBoxPublicKey string                      `json:"server_box_public_key"`
+	ServerSpkiHash     []string                    `json:"server_spki_hash"`
+	HostSpkiHash       map[string]string           `json:"host_spki_hash"`
 	RegistrationKey    string                      `json:"registration_key"`
 	OvpnData           string                      `json:"ovpn_data"`
+	ManagedPath        string                      `json:"managed_path"`
+	ManagedHash        string                      `json:"managed_hash"`
 	Path               string                      `json:"-"`
 	Password           string                      `json:"password"`
 	AuthErrorCount     int                         `json:"-"`
@@ -108,6 +124,18 @@ type SprofileClient struct {
 	DisableDns         bool                        `json:"disable_dns"`
 	RestrictClient     bool                        `json:"restrict_client"`
 	ForceDns           bool                        `json:"force_dns"`
+	Lockdown           bool                        `json:"lockdown"`
+	SplitInclude       []string                    `json:"split_include"`
+	SplitExclude       []string                    `json:"split_exclude"`
+	PreConnectHook     string                      `json:"pre_connect_hook"`
+	PostConnectHook    string                      `json:"post_connect_hook"`
+	PreDisconnectHook  string                      `json:"pre_disconnect_hook"`
+	PostDisconnectHook string                      `json:"post_disconnect_hook"`
+	HookTimeout        int                         `json:"hook_timeout"`
+	ReconnectPolicy    *types.ReconnectPolicy      `json:"reconnect_policy"`
+	CredentialHelper   string                      `json:"credential_helper"`
+	Owner              string                      `json:"owner"`
+	OwnerGroup         string                      `json:"owner_group"`
 	SsoAuth            bool                        `json:"sso_auth"`
 	PasswordMode       string                      `json:"password_mode"`
 	Token              bool                        `json:"token"`
@@ -120,8 +148,11 @@ type SprofileClient struct {
 	SyncToken          string                      `json:"sync_token"`
 	ServerPublicKey    []string                    `json:"server_public_key"`
 	ServerBoxPublicKey string                      `json:"server_box_public_key"`
+	ServerSpkiHash     []string                    `json:"server_spki_hash"`
+	HostSpkiHash       map[string]string           `json:"host_spki_hash"`
 	RegistrationKey    string                      `json:"registration_key"`
 	OvpnData           string                      `json:"ovpn_data"`
+	Managed            bool                        `json:"managed"`
 }
 
 func (s *Sprofile) BasePath() string {
@@ -129,6 +160,16 @@ func (s *Sprofile) BasePath() string {
 	return filepath.Join(prflsPath, s.Id)
 }
 
+func (s *Sprofile) CredentialRequest() *credential.Request {
+	return &credential.Request{
+		ProfileId:    s.Id,
+		Organization: s.Organization,
+		User:         s.User,
+		Server:       s.Server,
+		PasswordMode: s.PasswordMode,
+	}
+}
+
 func (s *Sprofile) Client() (sprflc *SprofileClient) {
 	sprflc = &SprofileClient{
 		Id:                 s.Id,
@@ -153,6 +194,18 @@ func (s *Sprofile) Client() (sprflc *SprofileClient) {
 		DisableDns:         s.DisableDns,
 		RestrictClient:     s.RestrictClient,
 		ForceDns:           s.ForceDns,
+		Lockdown:           s.Lockdown,
+		SplitInclude:       s.SplitInclude,
+		SplitExclude:       s.SplitExclude,
+		PreConnectHook:     s.PreConnectHook,
+		PostConnectHook:    s.PostConnectHook,
+		PreDisconnectHook:  s.PreDisconnectHook,
+		PostDisconnectHook: s.PostDisconnectHook,
+		HookTimeout:        s.HookTimeout,
+		ReconnectPolicy:    s.ReconnectPolicy,
+		CredentialHelper:   s.CredentialHelper,
+		Owner:              s.Owner,
+		OwnerGroup:         s.OwnerGroup,
 		SsoAuth:            s.SsoAuth,
 		PasswordMode:       s.PasswordMode,
 		Token:              s.Token,
@@ -165,8 +218,11 @@ func (s *Sprofile) Client() (sprflc *SprofileClient) {
 		SyncToken:          s.SyncToken,
 		ServerPublicKey:    s.ServerPublicKey,
 		ServerBoxPublicKey: s.ServerBoxPublicKey,
+		ServerSpkiHash:     s.ServerSpkiHash,
+		HostSpkiHash:       s.HostSpkiHash,
 		RegistrationKey:    s.RegistrationKey,
 		OvpnData:           s.OvpnData,
+		Managed:            s.ManagedPath != "",
 	}
 
 	return
@@ -189,6 +245,22 @@ func (s *Sprofile) Copy() (sprfl *Sprofile) {
 		}
 	}
 
+	var serverSpkiHash []string
+	if s.ServerSpkiHash != nil {
+		serverSpkiHash = []string{}
+		for _, hash := range s.ServerSpkiHash {
+			serverSpkiHash = append(serverSpkiHash, hash)
+		}
+	}
+
+	var hostSpkiHash map[string]string
+	if s.HostSpkiHash != nil {
+		hostSpkiHash = map[string]string{}
+		for host, hash := range s.HostSpkiHash {
+			hostSpkiHash[host] = hash
+		}
+	}
+
 	sprfl = &Sprofile{
 		Id:                 s.Id,
 		Name:               s.Name,
@@ -213,6 +285,18 @@ func (s *Sprofile) Copy() (sprfl *Sprofile) {
 		DisableDns:         s.DisableDns,
 		RestrictClient:     s.RestrictClient,
 		ForceDns:           s.ForceDns,
+		Lockdown:           s.Lockdown,
+		SplitInclude:       s.SplitInclude,
+		SplitExclude:       s.SplitExclude,
+		PreConnectHook:     s.PreConnectHook,
+		PostConnectHook:    s.PostConnectHook,
+		PreDisconnectHook:  s.PreDisconnectHook,
+		PostDisconnectHook: s.PostDisconnectHook,
+		HookTimeout:        s.HookTimeout,
+		ReconnectPolicy:    s.ReconnectPolicy,
+		CredentialHelper:   s.CredentialHelper,
+		Owner:              s.Owner,
+		OwnerGroup:         s.OwnerGroup,
 		SsoAuth:            s.SsoAuth,
 		PasswordMode:       s.PasswordMode,
 		Token:              s.Token,
@@ -225,8 +309,12 @@ func (s *Sprofile) Copy() (sprfl *Sprofile) {
 		SyncToken:          s.SyncToken,
 		ServerPublicKey:    serverPublicKey,
 		ServerBoxPublicKey: s.ServerBoxPublicKey,
+		ServerSpkiHash:     serverSpkiHash,
+		HostSpkiHash:       hostSpkiHash,
 		RegistrationKey:    s.RegistrationKey,
 		OvpnData:           s.OvpnData,
+		ManagedPath:        s.ManagedPath,
+		ManagedHash:        s.ManagedHash,
 		Path:               s.Path,
 		Password:           s.Password,
 		AuthErrorCount:     s.AuthErrorCount,
@@ -406,6 +494,9 @@ func (s *Sprofile) syncUpdate(data string) (updated bool, err error) {
 		s.SyncHash = confData.SyncHash
 		s.ServerPublicKey = confData.ServerPublicKey
 		s.ServerBoxPublicKey = confData.ServerBoxPublicKey
+		if len(confData.ServerSpkiHash) > 0 {
+			s.ServerSpkiHash = confData.ServerSpkiHash
+		}
 	}
 
 	if strings.Contains(s.OvpnData, "key-direction") &&
@@ -519,7 +610,23 @@ func (s *Sprofile) syncProfile(host string) (updated bool, err error) {
 	req.Header.Set("Auth-Signature", sig)
 	req.Header.Set("User-Agent", "pritunl")
 
-	res, err := clientSyncInsecure.Do(req)
+	pin := certpin.New(s.ServerSpkiHash, s.HostSpkiHash)
+	pin.OnMismatch = func(pinHost, hash string) {
+		logrus.WithFields(logrus.Fields{
+			"profile_id": s.Id,
+			"host":       pinHost,
+			"hash":       hash,
+		}).Error("sprofile: Sync server certificate does not match pin")
+
+		evt := &event.Event{
+			Type:      "cert_mismatch",
+			Data:      s.Client(),
+			ProfileId: s.Id,
+		}
+		evt.Init()
+	}
+
+	res, err := newSyncClient(pin).Do(req)
 	if err != nil {
 		err = &errortypes.RequestError{
 			errors.Wrap(err, "sprofile: Sync profile connection error"),
@@ -528,6 +635,16 @@ func (s *Sprofile) syncProfile(host string) (updated bool, err error) {
 	}
 	defer res.Body.Close()
 
+	hostHashes := pin.HostHashes()
+	if len(s.ServerSpkiHash) == 0 && len(hostHashes) != len(s.HostSpkiHash) {
+		s.HostSpkiHash = hostHashes
+
+		err = s.Commit()
+		if err != nil {
+			return
+		}
+	}
+
 	if res.StatusCode == 480 {
 		return
 	}
@@ -580,9 +697,11 @@ func (s *Sprofile) Sync() (updated bool, err error) {
 
 		updated, err = s.syncProfile(syncHost)
 		if err != nil {
+			metrics.SprofileSync.Inc("failure")
 			continue
 		}
 
+		metrics.SprofileSync.Inc("success")
 		break
 	}
 
@@ -599,6 +718,17 @@ func (s *Sprofile) Commit() (err error) {
 
 	pth := filepath.Join(prflsPath, s.Id+".conf")
 
+	err = s.write(pth)
+	if err != nil {
+		return
+	}
+
+	cacheStale = true
+
+	return
+}
+
+func (s *Sprofile) write(pth string) (err error) {
 	data, err := json.Marshal(s)
 	if err != nil {
 		err = &errortypes.ParseError{
@@ -607,13 +737,24 @@ func (s *Sprofile) Commit() (err error) {
 		return
 	}
 
+	if !config.Config.ProfilePlaintext {
+		keys, e := getKeys()
+		if e != nil {
+			err = e
+			return
+		}
+
+		data, err = encryptConf(data, keys[0])
+		if err != nil {
+			return
+		}
+	}
+
 	err = utils.CreateWrite(pth, string(data), 0600)
 	if err != nil {
 		return
 	}
 
-	cacheStale = true
-
 	return
 }
 
@@ -621,10 +762,14 @@ func (s *Sprofile) Delete() (err error) {
 	prflPth := s.BasePath() + ".conf"
 	logPth1 := s.BasePath() + ".log"
 	logPth2 := s.BasePath() + ".log.1"
+	histPth := s.BasePath() + ".history"
+	toknPth := s.BasePath() + ".token"
 
 	_ = utils.Remove(prflPth)
 	_ = utils.Remove(logPth1)
 	_ = utils.Remove(logPth2)
+	_ = utils.Remove(histPth)
+	_ = utils.Remove(toknPth)
 
 	return
 }
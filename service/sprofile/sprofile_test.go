@@ -0,0 +1,112 @@
+package sprofile
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pritunl/pritunl-client-electron/service/fakeserver"
+)
+
+func newTestSprofile(t *testing.T) (srv *fakeserver.Server, sprfl *Sprofile) {
+	t.Helper()
+
+	srv, err := fakeserver.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	sprfl = &Sprofile{
+		Id:             "test",
+		OrganizationId: srv.OrgId,
+		UserId:         srv.UserId,
+		ServerId:       srv.ServerId,
+		SyncHosts:      []string{srv.URL()},
+		SyncToken:      srv.SyncToken,
+		SyncSecret:     srv.SyncSecret,
+		SyncHash:       "hash",
+		ServerSpkiHash: []string{srv.SpkiHash()},
+	}
+
+	return
+}
+
+func TestSyncNotModified(t *testing.T) {
+	srv, sprfl := newTestSprofile(t)
+	srv.SyncStatus = 480
+
+	updated, err := sprfl.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated {
+		t.Fatal("sprofile: Unexpected update")
+	}
+
+	reqs := srv.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("sprofile: Expected 1 request, got %d", len(reqs))
+	}
+
+	pth := fmt.Sprintf("/key/sync/%s/%s/%s/hash",
+		srv.OrgId, srv.UserId, srv.ServerId)
+	if reqs[0].Method != "GET" || reqs[0].Path != pth {
+		t.Fatalf("sprofile: Unexpected request %s %s",
+			reqs[0].Method, reqs[0].Path)
+	}
+}
+
+func TestSyncEmpty(t *testing.T) {
+	srv, sprfl := newTestSprofile(t)
+
+	updated, err := sprfl.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated {
+		t.Fatal("sprofile: Unexpected update")
+	}
+	if len(srv.Requests()) != 1 {
+		t.Fatal("sprofile: Sync request not sent")
+	}
+}
+
+func TestSyncSignatureMismatch(t *testing.T) {
+	srv, sprfl := newTestSprofile(t)
+	srv.SyncConf = "client\nremote 127.0.0.1 1194\n"
+	srv.BadSignature = true
+
+	updated, err := sprfl.Sync()
+	if err == nil {
+		t.Fatal("sprofile: Expected signature error")
+	}
+	if updated {
+		t.Fatal("sprofile: Unexpected update")
+	}
+}
+
+func TestSyncRequestSignature(t *testing.T) {
+	srv, sprfl := newTestSprofile(t)
+	sprfl.SyncSecret = "invalid"
+
+	_, err := sprfl.Sync()
+	if err == nil {
+		t.Fatal("sprofile: Expected request error")
+	}
+	if len(srv.Requests()) != 0 {
+		t.Fatal("sprofile: Server accepted invalid signature")
+	}
+}
+
+func TestSyncPinMismatch(t *testing.T) {
+	srv, sprfl := newTestSprofile(t)
+	sprfl.ServerSpkiHash = []string{"invalid"}
+
+	_, err := sprfl.Sync()
+	if err == nil {
+		t.Fatal("sprofile: Expected certificate error")
+	}
+	if len(srv.Requests()) != 0 {
+		t.Fatal("sprofile: Request sent to mismatched server")
+	}
+}
@@ -11,7 +11,10 @@ import (
 	"sync"
 
 	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/certpin"
+	"github.com/pritunl/pritunl-client-electron/service/config"
 	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/types"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -83,6 +86,187 @@ func SetAuthErrorCount(prflId string, errorCount int) {
 	cache = prflsCache
 }
 
+func SetHostSpkiHash(prflId, host, hash string) (err error) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	prflsCache := []*Sprofile{}
+
+	for _, prfl := range cache {
+		if prfl.Id == prflId {
+			prfl = prfl.Copy()
+			if prfl.HostSpkiHash == nil {
+				prfl.HostSpkiHash = map[string]string{}
+			}
+			prfl.HostSpkiHash[host] = hash
+
+			err = prfl.Commit()
+			if err != nil {
+				return
+			}
+		}
+		prflsCache = append(prflsCache, prfl)
+	}
+
+	cache = prflsCache
+
+	return
+}
+
+func SetSplit(prflId string, include, exclude []string) (err error) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	prflsCache := []*Sprofile{}
+
+	for _, prfl := range cache {
+		if prfl.Id == prflId {
+			prfl = prfl.Copy()
+			prfl.SplitInclude = include
+			prfl.SplitExclude = exclude
+
+			err = prfl.Commit()
+			if err != nil {
+				return
+			}
+		}
+		prflsCache = append(prflsCache, prfl)
+	}
+
+	cache = prflsCache
+
+	return
+}
+
+func SetLockdown(prflId string, lockdown bool) (err error) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	prflsCache := []*Sprofile{}
+
+	for _, prfl := range cache {
+		if prfl.Id == prflId {
+			prfl = prfl.Copy()
+			prfl.Lockdown = lockdown
+
+			err = prfl.Commit()
+			if err != nil {
+				return
+			}
+		}
+		prflsCache = append(prflsCache, prfl)
+	}
+
+	cache = prflsCache
+
+	return
+}
+
+func SetHooks(prflId string, preConnect, postConnect, preDisconnect,
+	postDisconnect string, timeout int) (err error) {
+
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	prflsCache := []*Sprofile{}
+
+	for _, prfl := range cache {
+		if prfl.Id == prflId {
+			prfl = prfl.Copy()
+			prfl.PreConnectHook = preConnect
+			prfl.PostConnectHook = postConnect
+			prfl.PreDisconnectHook = preDisconnect
+			prfl.PostDisconnectHook = postDisconnect
+			prfl.HookTimeout = timeout
+
+			err = prfl.Commit()
+			if err != nil {
+				return
+			}
+		}
+		prflsCache = append(prflsCache, prfl)
+	}
+
+	cache = prflsCache
+
+	return
+}
+
+func SetReconnectPolicy(prflId string,
+	policy *types.ReconnectPolicy) (err error) {
+
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	prflsCache := []*Sprofile{}
+
+	for _, prfl := range cache {
+		if prfl.Id == prflId {
+			prfl = prfl.Copy()
+			prfl.ReconnectPolicy = policy
+
+			err = prfl.Commit()
+			if err != nil {
+				return
+			}
+		}
+		prflsCache = append(prflsCache, prfl)
+	}
+
+	cache = prflsCache
+
+	return
+}
+
+func SetCredentialHelper(prflId, helper string) (err error) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	prflsCache := []*Sprofile{}
+
+	for _, prfl := range cache {
+		if prfl.Id == prflId {
+			prfl = prfl.Copy()
+			prfl.CredentialHelper = helper
+
+			err = prfl.Commit()
+			if err != nil {
+				return
+			}
+		}
+		prflsCache = append(prflsCache, prfl)
+	}
+
+	cache = prflsCache
+
+	return
+}
+
+func SetOwner(prflId, owner, ownerGroup string) (err error) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	prflsCache := []*Sprofile{}
+
+	for _, prfl := range cache {
+		if prfl.Id == prflId {
+			prfl = prfl.Copy()
+			prfl.Owner = owner
+			prfl.OwnerGroup = ownerGroup
+
+			err = prfl.Commit()
+			if err != nil {
+				return
+			}
+		}
+		prflsCache = append(prflsCache, prfl)
+	}
+
+	cache = prflsCache
+
+	return
+}
+
 func GetPath() string {
 	switch runtime.GOOS {
 	case "windows":
@@ -154,9 +338,15 @@ func Remove(prflId string) {
 	prflsPath := GetPath()
 	prflPth := filepath.Join(prflsPath, fmt.Sprintf("%s.conf", prflId))
 	logPth := filepath.Join(prflsPath, fmt.Sprintf("%s.log", prflId))
+	histPth := filepath.Join(prflsPath, fmt.Sprintf("%s.history", prflId))
+	toknPth := filepath.Join(prflsPath, fmt.Sprintf("%s.token", prflId))
 
 	_ = os.Remove(prflPth)
 	_ = os.Remove(logPth)
+	_ = os.Remove(histPth)
+	_ = os.Remove(toknPth)
+
+	certpin.Clear(prflId)
 
 	cacheStale = true
 }
@@ -186,6 +376,11 @@ func Reload() (err error) {
 		return
 	}
 
+	keys, err := getKeys()
+	if err != nil {
+		return
+	}
+
 	for _, file := range files {
 		name := file.Name()
 		pth := filepath.Join(prflsPath, name)
@@ -203,6 +398,16 @@ func Reload() (err error) {
 			continue
 		}
 
+		data, keyIndex, e := decryptConf(data, keys)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"path":  pth,
+				"error": e,
+			}).Error("sprofile: Failed to decrypt profile configuration, " +
+				"restore the profile key or remove and reimport the profile")
+			continue
+		}
+
 		prfl := &Sprofile{
 			Path: pth,
 		}
@@ -219,6 +424,23 @@ func Reload() (err error) {
 			continue
 		}
 
+		if (config.Config.ProfilePlaintext && keyIndex != -1) ||
+			(!config.Config.ProfilePlaintext && keyIndex != 0) {
+
+			e = prfl.write(pth)
+			if e != nil {
+				logrus.WithFields(logrus.Fields{
+					"path":  pth,
+					"error": e,
+				}).Error("sprofile: Failed to migrate profile configuration")
+			} else {
+				logrus.WithFields(logrus.Fields{
+					"path":      pth,
+					"encrypted": !config.Config.ProfilePlaintext,
+				}).Info("sprofile: Migrated profile configuration")
+			}
+		}
+
 		if !initialized {
 			prfl.State = !prfl.Disabled
 		} else {
@@ -238,6 +460,27 @@ func Reload() (err error) {
 	return
 }
 
+// Rekey rewrites all profile configurations with the current profile key,
+// called after the enclave key changes, returns the last error after
+// attempting all profiles
+func Rekey() (err error) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	for _, prfl := range cache {
+		e := prfl.write(filepath.Join(GetPath(), prfl.Id+".conf"))
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"profile_id": prfl.Id,
+				"error":      e,
+			}).Error("sprofile: Failed to rekey profile configuration")
+			err = e
+		}
+	}
+
+	return
+}
+
 func ClearLog(prflId string) (err error) {
 	prflsPath := GetPath()
 	pth := filepath.Join(prflsPath, fmt.Sprintf("%s.log", prflId))
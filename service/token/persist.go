@@ -0,0 +1,301 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/platform"
+	"github.com/pritunl/pritunl-client-electron/service/sprofile"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	tokenExt  = ".token"
+	tokenInfo = "pritunl-client-token-store"
+)
+
+var (
+	diskLock = sync.Mutex{}
+)
+
+type tokenData struct {
+	Profile            string    `json:"profile"`
+	ServerPublicKey    string    `json:"server_public_key"`
+	ServerBoxPublicKey string    `json:"server_box_public_key"`
+	Token              string    `json:"token"`
+	Timestamp          time.Time `json:"timestamp"`
+	Ttl                int       `json:"ttl"`
+	Valid              bool      `json:"valid"`
+}
+
+// getKeyHash returns a hash of the server keys, tokens are stored per
+// profile and server key so a rotated server key does not reuse a token
+func getKeyHash(pubKey, pubBoxKey string) string {
+	hash := sha256.Sum256([]byte(pubKey + "\n" + pubBoxKey))
+	return hex.EncodeToString(hash[:8])
+}
+
+func getTokenName(profile, pubKey, pubBoxKey string) string {
+	return profile + "." + getKeyHash(pubKey, pubBoxKey) + tokenExt
+}
+
+func getTokenPath(profile, pubKey, pubBoxKey string) string {
+	return filepath.Join(sprofile.GetPath(),
+		getTokenName(profile, pubKey, pubBoxKey))
+}
+
+// removeFiles removes the stored tokens for the profile, the token file
+// for the name in keep is not removed
+func removeFiles(profile, keep string) {
+	prflsPath := sprofile.GetPath()
+
+	pths, _ := filepath.Glob(filepath.Join(prflsPath, profile+".*"+tokenExt))
+	pths = append(pths, filepath.Join(prflsPath, profile+tokenExt))
+
+	for _, pth := range pths {
+		if filepath.Base(pth) == keep {
+			continue
+		}
+		_ = os.Remove(pth)
+	}
+}
+
+func getKey() (key *[32]byte, err error) {
+	secret := config.Config.EnclavePrivateKey
+	if secret == "" {
+		secret = config.Config.TokenSecret
+	}
+
+	if secret == "" {
+		secret, err = utils.RandStrComplex(64)
+		if err != nil {
+			return
+		}
+
+		config.Config.TokenSecret = secret
+		err = config.Save()
+		if err != nil {
+			return
+		}
+	}
+
+	key = &[32]byte{}
+	_, err = io.ReadFull(
+		hkdf.New(sha256.New, []byte(secret), nil, []byte(tokenInfo)),
+		key[:],
+	)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "token: Failed to derive store key"),
+		}
+		return
+	}
+
+	return
+}
+
+func save(tokn *Token) (err error) {
+	diskLock.Lock()
+	defer diskLock.Unlock()
+
+	data, err := json.Marshal(&tokenData{
+		Profile:            tokn.Profile,
+		ServerPublicKey:    tokn.ServerPublicKey,
+		ServerBoxPublicKey: tokn.ServerBoxPublicKey,
+		Token:              tokn.Token,
+		Timestamp:          tokn.Timestamp,
+		Ttl:                tokn.Ttl,
+		Valid:              tokn.Valid,
+	})
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "token: Failed to marshal token"),
+		}
+		return
+	}
+
+	key, err := getKey()
+	if err != nil {
+		return
+	}
+
+	var nonce [24]byte
+	_, err = rand.Read(nonce[:])
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "token: Failed to generate nonce"),
+		}
+		return
+	}
+
+	encrypted := secretbox.Seal(nonce[:], data, &nonce, key)
+
+	err = platform.MkdirSecure(sprofile.GetPath())
+	if err != nil {
+		return
+	}
+
+	err = utils.CreateWrite(
+		getTokenPath(tokn.Profile, tokn.ServerPublicKey,
+			tokn.ServerBoxPublicKey),
+		base64.StdEncoding.EncodeToString(encrypted),
+		0600,
+	)
+	if err != nil {
+		return
+	}
+
+	removeFiles(tokn.Profile, getTokenName(tokn.Profile,
+		tokn.ServerPublicKey, tokn.ServerBoxPublicKey))
+
+	return
+}
+
+func load(pth string, key *[32]byte) (tokn *Token, err error) {
+	encData, err := ioutil.ReadFile(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "token: Failed to read token file"),
+		}
+		return
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(
+		strings.TrimSpace(string(encData)))
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "token: Failed to decode token file"),
+		}
+		return
+	}
+
+	if len(encrypted) < 24 {
+		err = &errortypes.ParseError{
+			errors.New("token: Token file truncated"),
+		}
+		return
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], encrypted[:24])
+
+	data, ok := secretbox.Open(nil, encrypted[24:], &nonce, key)
+	if !ok {
+		err = &errortypes.ParseError{
+			errors.New("token: Failed to decrypt token file"),
+		}
+		return
+	}
+
+	toknData := &tokenData{}
+	err = json.Unmarshal(data, toknData)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "token: Failed to unmarshal token"),
+		}
+		return
+	}
+
+	tokn = &Token{
+		Profile:            toknData.Profile,
+		ServerPublicKey:    toknData.ServerPublicKey,
+		ServerBoxPublicKey: toknData.ServerBoxPublicKey,
+		Token:              toknData.Token,
+		Timestamp:          toknData.Timestamp,
+		Ttl:                toknData.Ttl,
+		Valid:              toknData.Valid,
+	}
+
+	return
+}
+
+func remove(profile string) {
+	diskLock.Lock()
+	defer diskLock.Unlock()
+
+	removeFiles(profile, "")
+}
+
+func Load() (err error) {
+	diskLock.Lock()
+	defer diskLock.Unlock()
+
+	prflsPath := sprofile.GetPath()
+
+	files, err := ioutil.ReadDir(prflsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "token: Failed to read profiles directory"),
+		}
+		return
+	}
+
+	key, err := getKey()
+	if err != nil {
+		return
+	}
+
+	loaded := map[string]*Token{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), tokenExt) {
+			continue
+		}
+
+		pth := filepath.Join(prflsPath, file.Name())
+
+		tokn, e := load(pth, key)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"path":  pth,
+				"error": e,
+			}).Warn("token: Discarding unreadable token")
+
+			_ = os.Remove(pth)
+			continue
+		}
+
+		if tokn.Profile == "" || file.Name() != getTokenName(
+			tokn.Profile, tokn.ServerPublicKey, tokn.ServerBoxPublicKey) ||
+			utils.SinceAbs(tokn.Timestamp) >
+				time.Duration(tokn.Ttl)*time.Second {
+
+			_ = os.Remove(pth)
+			continue
+		}
+
+		loaded[tokn.Profile] = tokn
+	}
+
+	storeLock.Lock()
+	for profile, tokn := range loaded {
+		store[profile] = tokn
+	}
+	storeLock.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"count": len(loaded),
+	}).Info("token: Loaded tokens")
+
+	return
+}
@@ -33,6 +33,8 @@ func (t *Token) Init() (err error) {
 	t.Token = token
 	t.Timestamp = time.Now()
 
+	t.commit()
+
 	return
 }
 
@@ -51,9 +53,30 @@ func (t *Token) Reset() (err error) {
 	t.Token = token
 	t.Timestamp = time.Now()
 
+	t.commit()
+
 	return
 }
 
+func (t *Token) Validate() {
+	if t.Valid {
+		return
+	}
+
+	t.Valid = true
+	t.commit()
+}
+
+func (t *Token) commit() {
+	err := save(t)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"profile": t.Profile,
+			"error":   err,
+		}).Error("token: Failed to store token")
+	}
+}
+
 func (t *Token) Update() (expired bool, err error) {
 	if utils.SinceAbs(t.Timestamp) > time.Duration(t.Ttl)*time.Second {
 		expired = true
@@ -2,6 +2,8 @@ package token
 
 import (
 	"sync"
+
+	"github.com/sirupsen/logrus"
 )
 
 var (
@@ -18,13 +20,24 @@ func Get(profile, pubKey, pubBoxKey string) *Token {
 	tokn := store[profile]
 	storeLock.Unlock()
 
-	if tokn != nil && pubKey == tokn.ServerPublicKey &&
-		pubBoxKey == tokn.ServerBoxPublicKey {
+	if tokn == nil {
+		return nil
+	}
+
+	if pubKey != tokn.ServerPublicKey ||
+		pubBoxKey != tokn.ServerBoxPublicKey {
+
+		storeLock.Lock()
+		if store[profile] == tokn {
+			delete(store, profile)
+		}
+		storeLock.Unlock()
 
-		return tokn
+		remove(profile)
+		return nil
 	}
 
-	return nil
+	return tokn
 }
 
 func Update(profile, pubKey, pubBoxKey string, ttl int) (
@@ -50,11 +63,15 @@ func Update(profile, pubKey, pubBoxKey string, ttl int) (
 
 	tokn.Ttl = ttl
 
-	_, err = tokn.Update()
+	expired, err := tokn.Update()
 	if err != nil {
 		return
 	}
 
+	if !expired {
+		tokn.commit()
+	}
+
 	return
 }
 
@@ -62,4 +79,30 @@ func Clear(profile string) {
 	storeLock.Lock()
 	delete(store, profile)
 	storeLock.Unlock()
+
+	remove(profile)
+}
+
+// Rekey rewrites all stored tokens with the current store key, returns
+// the last error after attempting all tokens
+func Rekey() (err error) {
+	storeLock.Lock()
+	tokns := []*Token{}
+	for _, tokn := range store {
+		tokns = append(tokns, tokn)
+	}
+	storeLock.Unlock()
+
+	for _, tokn := range tokns {
+		e := save(tokn)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"profile": tokn.Profile,
+				"error":   e,
+			}).Error("token: Failed to rekey token")
+			err = e
+		}
+	}
+
+	return
 }
@@ -0,0 +1,190 @@
+package tpm
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"runtime"
+	"strings"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+)
+
+const (
+	BackendTpm      = "tpm"
+	BackendPkcs11   = "pkcs11"
+	BackendSoftware = "software"
+)
+
+type KeyStatus struct {
+	Backend   string `json:"backend"`
+	PublicKey string `json:"public_key"`
+	Locked    bool   `json:"locked"`
+	Error     string `json:"error"`
+}
+
+func ValidBackend(backend string) bool {
+	switch backend {
+	case "", BackendTpm, BackendPkcs11, BackendSoftware:
+		return true
+	default:
+		return false
+	}
+}
+
+func Backend() string {
+	return getBackend(config.Config.DeviceKeyBackend)
+}
+
+func getBackend(backend string) string {
+	switch backend {
+	case BackendPkcs11:
+		return BackendPkcs11
+	case BackendSoftware:
+		return BackendSoftware
+	default:
+		return BackendTpm
+	}
+}
+
+// GetCaller returns the device key backend selected in the config
+func GetCaller() (caller TpmCaller) {
+	return getCaller(Backend())
+}
+
+func getCaller(backend string) (caller TpmCaller) {
+	switch backend {
+	case BackendPkcs11:
+		caller = &Pkcs11{}
+	case BackendSoftware:
+		caller = &Software{}
+	default:
+		if runtime.GOOS == "darwin" && !config.Config.ForceLocalTpm {
+			caller = &Remote{}
+		} else {
+			caller = &Tpm{}
+		}
+	}
+
+	return
+}
+
+func GetStatus() (status *KeyStatus) {
+	status = &KeyStatus{
+		Backend: Backend(),
+	}
+
+	if status.Backend == BackendSoftware && !softwareUnlocked() &&
+		config.Config.DeviceKeyPassPath == "" {
+
+		status.Locked = true
+		return
+	}
+
+	caller := GetCaller()
+
+	err := caller.Open(config.Config.EnclavePrivateKey)
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+	defer caller.Close()
+
+	status.PublicKey, err = caller.PublicKey()
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+
+	return
+}
+
+// Enroll creates the device key for the backend, an empty backend uses
+// the configured backend. Existing software keys are only replaced with
+// force and pkcs11 keys are reused. The config is not modified.
+func Enroll(backend, passphrase string, force bool) (
+	pubKey64 string, err error) {
+
+	if backend == "" {
+		backend = Backend()
+	} else {
+		backend = getBackend(backend)
+	}
+
+	switch backend {
+	case BackendSoftware:
+		pubKey64, err = EnrollSoftware(passphrase, force)
+	case BackendPkcs11:
+		pubKey64, err = EnrollPkcs11()
+	default:
+		caller := getCaller(backend)
+
+		err = caller.Open(config.Config.EnclavePrivateKey)
+		if err != nil {
+			return
+		}
+		defer caller.Close()
+
+		pubKey64, err = caller.PublicKey()
+	}
+
+	return
+}
+
+// readPassFile reads the secret stored in the device_key_pass_path file,
+// this is the software key passphrase or the PKCS#11 PIN. Keeping secrets
+// in a separate file allows them to be kept out of the config file.
+func readPassFile() (pass string, err error) {
+	pth := config.Config.DeviceKeyPassPath
+	if pth == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "tpm: Failed to read device key passphrase"),
+		}
+		return
+	}
+
+	pass = strings.TrimRight(string(data), "\r\n")
+	return
+}
+
+func marshalPublicKey(pubKey *ecdsa.PublicKey) (pubKey64 string,
+	err error) {
+
+	bytesPub, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "tpm: Failed to marshal pub key"),
+		}
+		return
+	}
+
+	pubKey64 = base64.RawStdEncoding.EncodeToString(bytesPub)
+	return
+}
+
+func signEcdsa(key *ecdsa.PrivateKey, data []byte) (sig64 string,
+	err error) {
+
+	hash := sha256.Sum256(data)
+
+	sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "tpm: Failed to sign data"),
+		}
+		return
+	}
+
+	sig64 = base64.RawStdEncoding.EncodeToString(sig)
+	return
+}
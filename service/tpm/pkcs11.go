@@ -0,0 +1,403 @@
+//go:build cgo
+
+package tpm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"sync"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/miekg/pkcs11"
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+)
+
+const (
+	pkcs11DefaultLabel = "pritunl-device"
+)
+
+var (
+	pkcs11Lock    = sync.Mutex{}
+	pkcs11P256Oid = []byte{
+		0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07,
+	}
+)
+
+type Pkcs11 struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	privKey pkcs11.ObjectHandle
+	key64   string
+	locked  bool
+}
+
+func (t *Pkcs11) Open(privKey64 string) (err error) {
+	err = t.open()
+	if err != nil {
+		return
+	}
+
+	pubKey, privKey, err := t.findKey()
+	if err != nil {
+		t.Close()
+		return
+	}
+
+	if privKey == 0 {
+		t.Close()
+		err = &errortypes.NotFoundError{
+			errors.New("tpm: PKCS#11 device key not found, enroll first"),
+		}
+		return
+	}
+
+	t.privKey = privKey
+	t.key64, err = t.publicKey(pubKey)
+	if err != nil {
+		t.Close()
+		return
+	}
+
+	return
+}
+
+func (t *Pkcs11) Close() {
+	if t.ctx != nil {
+		if t.session != 0 {
+			_ = t.ctx.Logout(t.session)
+			_ = t.ctx.CloseSession(t.session)
+			t.session = 0
+		}
+		_ = t.ctx.Finalize()
+		t.ctx.Destroy()
+		t.ctx = nil
+	}
+
+	if t.locked {
+		t.locked = false
+		pkcs11Lock.Unlock()
+	}
+}
+
+func (t *Pkcs11) PublicKey() (pubKey64 string, err error) {
+	pubKey64 = t.key64
+	return
+}
+
+func (t *Pkcs11) Sign(data []byte) (privKey64, sig64 string, err error) {
+	hash := sha256.Sum256(data)
+
+	err = t.ctx.SignInit(t.session, []*pkcs11.Mechanism{
+		pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil),
+	}, t.privKey)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "tpm: Failed to init PKCS#11 sign"),
+		}
+		return
+	}
+
+	rawSig, err := t.ctx.Sign(t.session, hash[:])
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "tpm: Failed to sign data with PKCS#11"),
+		}
+		return
+	}
+
+	if len(rawSig) == 0 || len(rawSig)%2 != 0 {
+		err = &errortypes.ParseError{
+			errors.New("tpm: Invalid PKCS#11 signature length"),
+		}
+		return
+	}
+
+	half := len(rawSig) / 2
+	sig, err := asn1.Marshal(struct {
+		R *big.Int
+		S *big.Int
+	}{
+		R: new(big.Int).SetBytes(rawSig[:half]),
+		S: new(big.Int).SetBytes(rawSig[half:]),
+	})
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "tpm: Failed to marshal PKCS#11 signature"),
+		}
+		return
+	}
+
+	sig64 = base64.RawStdEncoding.EncodeToString(sig)
+
+	return
+}
+
+func (t *Pkcs11) open() (err error) {
+	module := config.Config.Pkcs11Module
+	if module == "" {
+		err = &errortypes.ReadError{
+			errors.New("tpm: PKCS#11 module not configured"),
+		}
+		return
+	}
+
+	pkcs11Lock.Lock()
+	t.locked = true
+
+	t.ctx = pkcs11.New(module)
+	if t.ctx == nil {
+		t.Close()
+		err = &errortypes.ReadError{
+			errors.Newf("tpm: Failed to load PKCS#11 module '%s'", module),
+		}
+		return
+	}
+
+	err = t.ctx.Initialize()
+	if err != nil {
+		t.ctx.Destroy()
+		t.ctx = nil
+		t.Close()
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "tpm: Failed to initialize PKCS#11 module"),
+		}
+		return
+	}
+
+	slot, err := t.findSlot()
+	if err != nil {
+		t.Close()
+		return
+	}
+
+	t.session, err = t.ctx.OpenSession(slot,
+		pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		t.Close()
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "tpm: Failed to open PKCS#11 session"),
+		}
+		return
+	}
+
+	pin := config.Config.Pkcs11Pin
+	if pin == "" {
+		pin, err = readPassFile()
+		if err != nil {
+			t.Close()
+			return
+		}
+	}
+
+	if pin != "" {
+		err = t.ctx.Login(t.session, pkcs11.CKU_USER, pin)
+		if err != nil {
+			if e, ok := err.(pkcs11.Error); !ok ||
+				e != pkcs11.CKR_USER_ALREADY_LOGGED_IN {
+
+				t.Close()
+				err = &errortypes.ReadError{
+					errors.Wrap(err, "tpm: Failed to login to PKCS#11 token"),
+				}
+				return
+			}
+			err = nil
+		}
+	}
+
+	return
+}
+
+func (t *Pkcs11) findSlot() (slot uint, err error) {
+	slots, err := t.ctx.GetSlotList(true)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "tpm: Failed to list PKCS#11 slots"),
+		}
+		return
+	}
+
+	for _, slotId := range slots {
+		if config.Config.Pkcs11Token == "" {
+			slot = slotId
+			return
+		}
+
+		info, e := t.ctx.GetTokenInfo(slotId)
+		if e != nil {
+			continue
+		}
+
+		if info.Label == config.Config.Pkcs11Token {
+			slot = slotId
+			return
+		}
+	}
+
+	err = &errortypes.NotFoundError{
+		errors.New("tpm: Failed to find PKCS#11 token"),
+	}
+	return
+}
+
+func (t *Pkcs11) label() string {
+	if config.Config.Pkcs11KeyLabel != "" {
+		return config.Config.Pkcs11KeyLabel
+	}
+	return pkcs11DefaultLabel
+}
+
+func (t *Pkcs11) findObject(class uint) (obj pkcs11.ObjectHandle,
+	err error) {
+
+	err = t.ctx.FindObjectsInit(t.session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, t.label()),
+	})
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "tpm: Failed to search PKCS#11 objects"),
+		}
+		return
+	}
+
+	objs, _, err := t.ctx.FindObjects(t.session, 1)
+	_ = t.ctx.FindObjectsFinal(t.session)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "tpm: Failed to find PKCS#11 objects"),
+		}
+		return
+	}
+
+	if len(objs) > 0 {
+		obj = objs[0]
+	}
+
+	return
+}
+
+func (t *Pkcs11) findKey() (pubKey, privKey pkcs11.ObjectHandle,
+	err error) {
+
+	pubKey, err = t.findObject(pkcs11.CKO_PUBLIC_KEY)
+	if err != nil {
+		return
+	}
+
+	privKey, err = t.findObject(pkcs11.CKO_PRIVATE_KEY)
+	if err != nil {
+		return
+	}
+
+	if pubKey == 0 {
+		privKey = 0
+	}
+
+	return
+}
+
+func (t *Pkcs11) publicKey(obj pkcs11.ObjectHandle) (pubKey64 string,
+	err error) {
+
+	attrs, err := t.ctx.GetAttributeValue(t.session, obj,
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		})
+	if err != nil || len(attrs) == 0 {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "tpm: Failed to read PKCS#11 public key"),
+		}
+		return
+	}
+
+	point := attrs[0].Value
+	var unwrapped []byte
+	rest, e := asn1.Unmarshal(point, &unwrapped)
+	if e == nil && len(rest) == 0 {
+		point = unwrapped
+	}
+
+	x, y := elliptic.Unmarshal(elliptic.P256(), point)
+	if x == nil {
+		err = &errortypes.ParseError{
+			errors.New("tpm: Invalid PKCS#11 public key point"),
+		}
+		return
+	}
+
+	pubKey64, err = marshalPublicKey(&ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     x,
+		Y:     y,
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// EnrollPkcs11 generates the device key pair on the configured token if
+// one with the key label does not already exist
+func EnrollPkcs11() (pubKey64 string, err error) {
+	t := &Pkcs11{}
+
+	err = t.open()
+	if err != nil {
+		return
+	}
+	defer t.Close()
+
+	pubKey, privKey, err := t.findKey()
+	if err != nil {
+		return
+	}
+
+	if privKey == 0 {
+		label := t.label()
+
+		pubKey, _, err = t.ctx.GenerateKeyPair(t.session,
+			[]*pkcs11.Mechanism{
+				pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil),
+			},
+			[]*pkcs11.Attribute{
+				pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+				pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+				pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+				pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+				pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, pkcs11P256Oid),
+				pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+			},
+			[]*pkcs11.Attribute{
+				pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+				pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+				pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+				pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+				pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+				pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+				pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+				pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+			},
+		)
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "tpm: Failed to generate PKCS#11 key"),
+			}
+			return
+		}
+	}
+
+	pubKey64, err = t.publicKey(pubKey)
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -0,0 +1,37 @@
+//go:build !cgo
+
+package tpm
+
+import (
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+)
+
+type Pkcs11 struct{}
+
+func (t *Pkcs11) Open(privKey64 string) (err error) {
+	err = &errortypes.ReadError{
+		errors.New("tpm: PKCS#11 not supported in this build"),
+	}
+	return
+}
+
+func (t *Pkcs11) Close() {}
+
+func (t *Pkcs11) PublicKey() (pubKey64 string, err error) {
+	return
+}
+
+func (t *Pkcs11) Sign(data []byte) (privKey64, sig64 string, err error) {
+	err = &errortypes.ReadError{
+		errors.New("tpm: PKCS#11 not supported in this build"),
+	}
+	return
+}
+
+func EnrollPkcs11() (pubKey64 string, err error) {
+	err = &errortypes.ReadError{
+		errors.New("tpm: PKCS#11 not supported in this build"),
+	}
+	return
+}
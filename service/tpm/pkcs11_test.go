@@ -0,0 +1,60 @@
+//go:build cgo
+
+package tpm
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pritunl/pritunl-client-electron/service/config"
+)
+
+// Run with SoftHSM by setting PKCS11_TEST_MODULE, PKCS11_TEST_TOKEN and
+// PKCS11_TEST_PIN to an initialized token
+func TestPkcs11(t *testing.T) {
+	module := os.Getenv("PKCS11_TEST_MODULE")
+	if module == "" {
+		t.Skip("PKCS11_TEST_MODULE not set")
+	}
+
+	config.Config.DeviceKeyBackend = BackendPkcs11
+	config.Config.Pkcs11Module = module
+	config.Config.Pkcs11Token = os.Getenv("PKCS11_TEST_TOKEN")
+	config.Config.Pkcs11Pin = os.Getenv("PKCS11_TEST_PIN")
+	config.Config.Pkcs11KeyLabel = "pritunl-test"
+	defer func() {
+		config.Config.DeviceKeyBackend = ""
+		config.Config.Pkcs11Module = ""
+		config.Config.Pkcs11Token = ""
+		config.Config.Pkcs11Pin = ""
+		config.Config.Pkcs11KeyLabel = ""
+	}()
+
+	pubKey64, err := Enroll("", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKey64Again, err := Enroll("", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pubKey64Again != pubKey64 {
+		t.Fatal("tpm: Expected existing PKCS#11 key to be reused")
+	}
+
+	caller := GetCaller()
+	err = caller.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer caller.Close()
+
+	data := []byte("device auth data")
+	_, sig64, err := caller.Sign(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifySig(t, pubKey64, sig64, data)
+}
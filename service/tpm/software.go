@@ -0,0 +1,367 @@
+package tpm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/config"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/pritunl/pritunl-client-electron/service/utils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	softwareKeyVersion = 1
+	softwareKeyN       = 32768
+	softwareKeyR       = 8
+	softwareKeyP       = 1
+)
+
+var (
+	softwareKey     *ecdsa.PrivateKey
+	softwareKeyLock = sync.Mutex{}
+)
+
+type softwareKeyData struct {
+	Version   int    `json:"version"`
+	PublicKey string `json:"public_key"`
+	Salt      []byte `json:"salt"`
+	N         int    `json:"n"`
+	R         int    `json:"r"`
+	P         int    `json:"p"`
+	Nonce     []byte `json:"nonce"`
+	Data      []byte `json:"data"`
+}
+
+type Software struct {
+	key   *ecdsa.PrivateKey
+	key64 string
+}
+
+func (t *Software) Open(privKey64 string) (err error) {
+	softwareKeyLock.Lock()
+	key := softwareKey
+	softwareKeyLock.Unlock()
+
+	if key == nil {
+		if config.Config.DeviceKeyPassPath == "" {
+			err = &errortypes.ReadError{
+				errors.New("tpm: Software device key is locked"),
+			}
+			return
+		}
+
+		passphrase, e := readPassFile()
+		if e != nil {
+			err = e
+			return
+		}
+
+		key, err = unlockSoftwareKey(getSoftwareKeyPath(), passphrase)
+		if err != nil {
+			return
+		}
+	}
+
+	t.key = key
+	t.key64, err = marshalPublicKey(&key.PublicKey)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (t *Software) Close() {
+	t.key = nil
+}
+
+func (t *Software) PublicKey() (pubKey64 string, err error) {
+	pubKey64 = t.key64
+	return
+}
+
+func (t *Software) Sign(data []byte) (privKey64, sig64 string, err error) {
+	sig64, err = signEcdsa(t.key, data)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func getSoftwareKeyPath() string {
+	if config.Config.DeviceKeyPath != "" {
+		return config.Config.DeviceKeyPath
+	}
+
+	return filepath.Join(filepath.Dir(config.GetPath()),
+		"pritunl-device-key.json")
+}
+
+func deriveSoftwareKey(passphrase string, data *softwareKeyData) (
+	key *[32]byte, err error) {
+
+	keyByt, err := scrypt.Key([]byte(passphrase), data.Salt,
+		data.N, data.R, data.P, 32)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "tpm: Failed to derive device key passphrase"),
+		}
+		return
+	}
+
+	key = &[32]byte{}
+	copy(key[:], keyByt)
+
+	return
+}
+
+func writeSoftwareKey(pth, passphrase string, privKey *ecdsa.PrivateKey) (
+	err error) {
+
+	privByt, err := x509.MarshalECPrivateKey(privKey)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "tpm: Failed to marshal device key"),
+		}
+		return
+	}
+
+	pubKey64, err := marshalPublicKey(&privKey.PublicKey)
+	if err != nil {
+		return
+	}
+
+	data := &softwareKeyData{
+		Version:   softwareKeyVersion,
+		PublicKey: pubKey64,
+		Salt:      make([]byte, 32),
+		N:         softwareKeyN,
+		R:         softwareKeyR,
+		P:         softwareKeyP,
+	}
+
+	_, err = rand.Read(data.Salt)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "tpm: Failed to generate salt"),
+		}
+		return
+	}
+
+	key, err := deriveSoftwareKey(passphrase, data)
+	if err != nil {
+		return
+	}
+
+	var nonce [24]byte
+	_, err = rand.Read(nonce[:])
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "tpm: Failed to generate nonce"),
+		}
+		return
+	}
+
+	data.Nonce = nonce[:]
+	data.Data = secretbox.Seal(nil, privByt, &nonce, key)
+
+	output, err := json.Marshal(data)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "tpm: Failed to marshal device key file"),
+		}
+		return
+	}
+
+	err = utils.ExistsMkdir(filepath.Dir(pth), 0755)
+	if err != nil {
+		return
+	}
+
+	tmpPth := pth + ".tmp"
+	err = ioutil.WriteFile(tmpPth, output, 0600)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "tpm: Failed to write device key file"),
+		}
+		return
+	}
+
+	err = os.Rename(tmpPth, pth)
+	if err != nil {
+		_ = os.Remove(tmpPth)
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "tpm: Failed to move device key file"),
+		}
+		return
+	}
+
+	return
+}
+
+func backupSoftwareKey(pth string) (err error) {
+	bakPth := fmt.Sprintf("%s.%d.bak", pth, time.Now().Unix())
+
+	err = os.Rename(pth, bakPth)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "tpm: Failed to backup device key file"),
+		}
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"path":        pth,
+		"backup_path": bakPth,
+	}).Warn("tpm: Replacing existing device key")
+
+	return
+}
+
+func unlockSoftwareKey(pth, passphrase string) (
+	privKey *ecdsa.PrivateKey, err error) {
+
+	output, err := ioutil.ReadFile(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "tpm: Failed to read device key file"),
+		}
+		return
+	}
+
+	data := &softwareKeyData{}
+	err = json.Unmarshal(output, data)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "tpm: Failed to parse device key file"),
+		}
+		return
+	}
+
+	if data.Version != softwareKeyVersion || len(data.Nonce) != 24 {
+		err = &errortypes.ParseError{
+			errors.New("tpm: Unknown device key file version"),
+		}
+		return
+	}
+
+	key, err := deriveSoftwareKey(passphrase, data)
+	if err != nil {
+		return
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], data.Nonce)
+
+	privByt, ok := secretbox.Open(nil, data.Data, &nonce, key)
+	if !ok {
+		err = &errortypes.ReadError{
+			errors.New("tpm: Invalid device key passphrase"),
+		}
+		return
+	}
+
+	privKey, err = x509.ParseECPrivateKey(privByt)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "tpm: Failed to parse device key"),
+		}
+		return
+	}
+
+	softwareKeyLock.Lock()
+	softwareKey = privKey
+	softwareKeyLock.Unlock()
+
+	return
+}
+
+func softwareUnlocked() bool {
+	softwareKeyLock.Lock()
+	defer softwareKeyLock.Unlock()
+
+	return softwareKey != nil
+}
+
+// EnrollSoftware generates a new software device key encrypted with the
+// passphrase, the key remains unlocked until the service restarts. An
+// existing key file is only replaced with force and is first moved to a
+// timestamped backup.
+func EnrollSoftware(passphrase string, force bool) (
+	pubKey64 string, err error) {
+
+	if passphrase == "" {
+		err = &errortypes.ParseError{
+			errors.New("tpm: Device key passphrase required"),
+		}
+		return
+	}
+
+	pth := getSoftwareKeyPath()
+
+	exists, err := utils.Exists(pth)
+	if err != nil {
+		return
+	}
+
+	if exists {
+		if !force {
+			err = &errortypes.WriteError{
+				errors.New("tpm: Device key already exists"),
+			}
+			return
+		}
+
+		err = backupSoftwareKey(pth)
+		if err != nil {
+			return
+		}
+	}
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "tpm: Failed to generate device key"),
+		}
+		return
+	}
+
+	err = writeSoftwareKey(pth, passphrase, privKey)
+	if err != nil {
+		return
+	}
+
+	softwareKeyLock.Lock()
+	softwareKey = privKey
+	softwareKeyLock.Unlock()
+
+	pubKey64, err = marshalPublicKey(&privKey.PublicKey)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func UnlockSoftware(passphrase string) (err error) {
+	_, err = unlockSoftwareKey(getSoftwareKeyPath(), passphrase)
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -0,0 +1,165 @@
+package tpm
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	"github.com/pritunl/pritunl-client-electron/service/config"
+)
+
+func verifySig(t *testing.T, pubKey64, sig64 string, data []byte) {
+	pubByt, err := base64.RawStdEncoding.DecodeString(pubKey64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKeyInf, err := x509.ParsePKIXPublicKey(pubByt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKey, ok := pubKeyInf.(*ecdsa.PublicKey)
+	if !ok {
+		t.Fatal("tpm: Unexpected public key type")
+	}
+
+	sig, err := base64.RawStdEncoding.DecodeString(sig64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := sha256.Sum256(data)
+	if !ecdsa.VerifyASN1(pubKey, hash[:], sig) {
+		t.Fatal("tpm: Signature verification failed")
+	}
+}
+
+func TestSoftware(t *testing.T) {
+	config.Config.DeviceKeyBackend = BackendSoftware
+	config.Config.DeviceKeyPath = filepath.Join(
+		t.TempDir(), "device-key.json")
+	defer func() {
+		config.Config.DeviceKeyBackend = ""
+		config.Config.DeviceKeyPath = ""
+		softwareKey = nil
+	}()
+
+	_, err := EnrollSoftware("", false)
+	if err == nil {
+		t.Fatal("tpm: Expected passphrase error")
+	}
+
+	pubKey64, err := Enroll("", "test-passphrase", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	softwareKey = nil
+
+	caller := GetCaller()
+	err = caller.Open("")
+	if err == nil {
+		t.Fatal("tpm: Expected locked key error")
+	}
+
+	status := GetStatus()
+	if !status.Locked {
+		t.Fatal("tpm: Expected locked status")
+	}
+
+	err = UnlockSoftware("wrong-passphrase")
+	if err == nil {
+		t.Fatal("tpm: Expected invalid passphrase error")
+	}
+
+	err = UnlockSoftware("test-passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = caller.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer caller.Close()
+
+	openPubKey64, err := caller.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if openPubKey64 != pubKey64 {
+		t.Fatal("tpm: Public key mismatch after unlock")
+	}
+
+	data := []byte("device auth data")
+	privKey64, sig64, err := caller.Sign(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if privKey64 != "" {
+		t.Fatal("tpm: Unexpected private key from software backend")
+	}
+
+	verifySig(t, pubKey64, sig64, data)
+}
+
+func TestSoftwareReplace(t *testing.T) {
+	config.Config.DeviceKeyPath = filepath.Join(
+		t.TempDir(), "device-key.json")
+	defer func() {
+		config.Config.DeviceKeyPath = ""
+		softwareKey = nil
+	}()
+
+	pubKey64, err := Enroll(BackendSoftware, "test-passphrase", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Backend() != BackendTpm {
+		t.Fatal("tpm: Enroll modified configured backend")
+	}
+
+	_, err = Enroll(BackendSoftware, "test-passphrase", false)
+	if err == nil {
+		t.Fatal("tpm: Expected existing key error")
+	}
+
+	softwareKey = nil
+	_, err = unlockSoftwareKey(config.Config.DeviceKeyPath, "test-passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newPubKey64, err := Enroll(BackendSoftware, "new-passphrase", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newPubKey64 == pubKey64 {
+		t.Fatal("tpm: Expected new device key")
+	}
+
+	bakPths, err := filepath.Glob(config.Config.DeviceKeyPath + ".*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bakPths) != 1 {
+		t.Fatalf("tpm: Unexpected backup count %d", len(bakPths))
+	}
+
+	privKey, err := unlockSoftwareKey(bakPths[0], "test-passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bakPubKey64, err := marshalPublicKey(&privKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bakPubKey64 != pubKey64 {
+		t.Fatal("tpm: Backup key mismatch")
+	}
+}
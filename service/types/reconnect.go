@@ -0,0 +1,19 @@
+package types
+
+type ReconnectRule struct {
+	Disabled    bool `json:"disabled"`
+	Immediate   bool `json:"immediate"`
+	Backoff     int  `json:"backoff"`
+	BackoffMax  int  `json:"backoff_max"`
+	MaxAttempts int  `json:"max_attempts"`
+}
+
+type ReconnectPolicy struct {
+	Backoff     int                       `json:"backoff"`
+	BackoffMax  int                       `json:"backoff_max"`
+	Multiplier  float64                   `json:"multiplier"`
+	Jitter      float64                   `json:"jitter"`
+	MaxAttempts int                       `json:"max_attempts"`
+	Window      int                       `json:"window"`
+	Rules       map[string]*ReconnectRule `json:"rules"`
+}
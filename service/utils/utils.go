@@ -907,18 +907,18 @@ func GetLogPath() (pth string) {
 	return
 }
 
-func GetLogPath2() (pth string) {
+func GetJsonLogPath() (pth string) {
 	switch runtime.GOOS {
 	case "windows":
 		pth = filepath.Join(GetWinDrive(), "ProgramData", "Pritunl")
 
 		_ = platform.MkdirReadSecure(pth)
 
-		pth = filepath.Join(pth, "pritunl-client.log.1")
+		pth = filepath.Join(pth, "pritunl-client.json.log")
 		break
 	case "linux", "darwin":
 		pth = filepath.Join(string(filepath.Separator),
-			"var", "log", "pritunl-client.log.1")
+			"var", "log", "pritunl-client.json.log")
 		break
 	default:
 		panic("profile: Not implemented")
@@ -13,6 +13,8 @@ import (
 	"github.com/pritunl/pritunl-client-electron/service/config"
 	"github.com/pritunl/pritunl-client-electron/service/connection"
 	"github.com/pritunl/pritunl-client-electron/service/event"
+	"github.com/pritunl/pritunl-client-electron/service/metrics"
+	"github.com/pritunl/pritunl-client-electron/service/netmon"
 	"github.com/pritunl/pritunl-client-electron/service/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -127,6 +129,7 @@ func wakeWatch() {
 
 				logrus.Warn("watch: Wakeup restarting...")
 
+				metrics.WakeReconnect.Inc()
 				connection.RestartProfiles(false)
 			} else {
 				restartLock.Unlock()
@@ -313,4 +316,16 @@ func StartWatch() {
 	} else {
 		go dnsWatch()
 	}
+	if runtime.GOOS == "linux" {
+		if config.Config.DisableNetWatch {
+			logrus.Info("watch: Network watch disabled")
+		} else {
+			err := netmon.Start(connection.HandleNetworkChange)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": err,
+				}).Error("watch: Failed to start network watch")
+			}
+		}
+	}
 }
@@ -0,0 +1,197 @@
+package wireguard
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+var (
+	userspaceDevices     = map[string]*device.Device{}
+	userspaceDevicesLock = sync.Mutex{}
+)
+
+func getUserspace(iface string) (dev *device.Device) {
+	userspaceDevicesLock.Lock()
+	dev = userspaceDevices[iface]
+	userspaceDevicesLock.Unlock()
+	return
+}
+
+func startUserspace(iface string, mtu int) (err error) {
+	tunDev, err := tun.CreateTUN(iface, mtu)
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrapf(err, "wireguard: Failed to create tun '%s'", iface),
+		}
+		return
+	}
+
+	logger := &device.Logger{
+		Verbosef: device.DiscardLogf,
+		Errorf: func(format string, args ...interface{}) {
+			logrus.WithFields(logrus.Fields{
+				"iface": iface,
+				"error": fmt.Sprintf(format, args...),
+			}).Error("wireguard: Userspace device error")
+		},
+	}
+
+	dev := device.NewDevice(tunDev, conn.NewDefaultBind(), logger)
+
+	userspaceDevicesLock.Lock()
+	userspaceDevices[iface] = dev
+	userspaceDevicesLock.Unlock()
+
+	return
+}
+
+func stopUserspace(iface string) (ok bool) {
+	userspaceDevicesLock.Lock()
+	dev := userspaceDevices[iface]
+	delete(userspaceDevices, iface)
+	userspaceDevicesLock.Unlock()
+
+	if dev == nil {
+		return
+	}
+
+	dev.Close()
+	ok = true
+
+	return
+}
+
+func configureUserspace(iface string, conf wgtypes.Config) (err error) {
+	dev := getUserspace(iface)
+	if dev == nil {
+		err = &errortypes.NotFoundError{
+			errors.Newf("wireguard: Userspace device '%s' not found", iface),
+		}
+		return
+	}
+
+	uapiConf := []string{}
+	if conf.PrivateKey != nil {
+		uapiConf = append(uapiConf,
+			"private_key="+hex.EncodeToString(conf.PrivateKey[:]))
+	}
+	if conf.FirewallMark != nil {
+		uapiConf = append(uapiConf,
+			"fwmark="+strconv.Itoa(*conf.FirewallMark))
+	}
+	if conf.ReplacePeers {
+		uapiConf = append(uapiConf, "replace_peers=true")
+	}
+
+	for _, peer := range conf.Peers {
+		uapiConf = append(uapiConf,
+			"public_key="+hex.EncodeToString(peer.PublicKey[:]))
+		if peer.Endpoint != nil {
+			uapiConf = append(uapiConf, "endpoint="+peer.Endpoint.String())
+		}
+		if peer.ReplaceAllowedIPs {
+			uapiConf = append(uapiConf, "replace_allowed_ips=true")
+		}
+		for _, allowedIp := range peer.AllowedIPs {
+			uapiConf = append(uapiConf, "allowed_ip="+allowedIp.String())
+		}
+	}
+
+	err = dev.IpcSet(strings.Join(uapiConf, "\n") + "\n")
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrapf(err, "wireguard: Failed to configure device '%s'",
+				iface),
+		}
+		return
+	}
+
+	err = dev.Up()
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrapf(err, "wireguard: Failed to start device '%s'",
+				iface),
+		}
+		return
+	}
+
+	return
+}
+
+func getPeerUserspace(dev *device.Device, iface, publicKey string) (
+	peer *Peer, err error) {
+
+	key, err := wgtypes.ParseKey(publicKey)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "wireguard: Failed to parse public key"),
+		}
+		return
+	}
+	keyHex := hex.EncodeToString(key[:])
+
+	output, err := dev.IpcGet()
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrapf(err, "wireguard: Failed to read device '%s'",
+				iface),
+		}
+		return
+	}
+
+	match := false
+	var handshakeSec int64
+	for _, line := range strings.Split(output, "\n") {
+		lineSpl := strings.SplitN(line, "=", 2)
+		if len(lineSpl) != 2 {
+			continue
+		}
+		val := lineSpl[1]
+
+		if lineSpl[0] == "public_key" {
+			match = val == keyHex
+			if match {
+				peer = &Peer{
+					PublicKey: publicKey,
+				}
+			}
+			continue
+		}
+
+		if !match {
+			continue
+		}
+
+		switch lineSpl[0] {
+		case "last_handshake_time_sec":
+			handshakeSec, _ = strconv.ParseInt(val, 10, 64)
+			break
+		case "last_handshake_time_nsec":
+			handshakeNsec, _ := strconv.ParseInt(val, 10, 64)
+			if handshakeSec != 0 || handshakeNsec != 0 {
+				peer.LastHandshake = time.Unix(handshakeSec, handshakeNsec)
+			}
+			break
+		case "rx_bytes":
+			peer.ReceiveBytes, _ = strconv.ParseInt(val, 10, 64)
+			break
+		case "tx_bytes":
+			peer.TransmitBytes, _ = strconv.ParseInt(val, 10, 64)
+			break
+		}
+	}
+
+	return
+}
@@ -0,0 +1,47 @@
+package wireguard
+
+import (
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+type Route struct {
+	Network string
+	Metric  int
+}
+
+type Config struct {
+	Iface      string
+	PrivateKey string
+	PublicKey  string
+	Endpoint   string
+	Mtu        int
+	Addresses  []string
+	Routes     []*Route
+	Userspace  bool
+}
+
+type Peer struct {
+	PublicKey     string
+	LastHandshake time.Time
+	ReceiveBytes  int64
+	TransmitBytes int64
+}
+
+func GenerateKey() (privateKey, publicKey string, err error) {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "wireguard: Failed to generate private key"),
+		}
+		return
+	}
+
+	privateKey = key.String()
+	publicKey = key.PublicKey().String()
+
+	return
+}
@@ -0,0 +1,507 @@
+package wireguard
+
+import (
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const (
+	defaultMtu = 1420
+	tableBase  = 51820
+	tableRange = 1000
+)
+
+var (
+	ruleLock = sync.Mutex{}
+)
+
+func getTable(link netlink.Link) int {
+	return tableBase + link.Attrs().Index%tableRange
+}
+
+func GetMark(iface string) int {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return 0
+	}
+	return getTable(link)
+}
+
+func parseAddr(addr string) (ipAddr *netlink.Addr, err error) {
+	if !strings.Contains(addr, "/") {
+		if strings.Contains(addr, ":") {
+			addr += "/128"
+		} else {
+			addr += "/32"
+		}
+	}
+
+	ipAddr, err = netlink.ParseAddr(addr)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrapf(err, "wireguard: Failed to parse address '%s'",
+				addr),
+		}
+		return
+	}
+
+	return
+}
+
+func Configure(conf *Config) (err error) {
+	_ = Clear(conf.Iface)
+
+	privateKey, err := wgtypes.ParseKey(conf.PrivateKey)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "wireguard: Failed to parse private key"),
+		}
+		return
+	}
+
+	publicKey, err := wgtypes.ParseKey(conf.PublicKey)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "wireguard: Failed to parse public key"),
+		}
+		return
+	}
+
+	endpoint, err := net.ResolveUDPAddr("udp", conf.Endpoint)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrapf(err, "wireguard: Failed to resolve endpoint '%s'",
+				conf.Endpoint),
+		}
+		return
+	}
+
+	routes := []*netlink.Route{}
+	allowedIps := []net.IPNet{}
+	defaultRoute4 := false
+	defaultRoute6 := false
+	for _, route := range conf.Routes {
+		_, network, e := net.ParseCIDR(route.Network)
+		if e != nil {
+			err = &errortypes.ParseError{
+				errors.Wrapf(e, "wireguard: Failed to parse route '%s'",
+					route.Network),
+			}
+			return
+		}
+
+		allowedIps = append(allowedIps, *network)
+
+		ones, _ := network.Mask.Size()
+		if ones == 0 {
+			if network.IP.To4() != nil {
+				defaultRoute4 = true
+			} else {
+				defaultRoute6 = true
+			}
+			continue
+		}
+
+		routes = append(routes, &netlink.Route{
+			Dst:      network,
+			Priority: route.Metric,
+		})
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		x, _ := routes[i].Dst.Mask.Size()
+		y, _ := routes[j].Dst.Mask.Size()
+		return x > y
+	})
+
+	mtu := conf.Mtu
+	if mtu == 0 {
+		mtu = defaultMtu
+	}
+
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = conf.Iface
+	attrs.MTU = mtu
+
+	if conf.Userspace {
+		err = startUserspace(conf.Iface, mtu)
+		if err != nil {
+			return
+		}
+	} else {
+		err = netlink.LinkAdd(&netlink.Wireguard{
+			LinkAttrs: attrs,
+		})
+		if err != nil {
+			err = &errortypes.ExecError{
+				errors.Wrapf(err, "wireguard: Failed to create interface '%s'",
+					conf.Iface),
+			}
+			return
+		}
+	}
+
+	link, err := netlink.LinkByName(conf.Iface)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrapf(err, "wireguard: Failed to find interface '%s'",
+				conf.Iface),
+		}
+		return
+	}
+
+	table := getTable(link)
+
+	deviceConf := wgtypes.Config{
+		PrivateKey:   &privateKey,
+		ReplacePeers: true,
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:         publicKey,
+				Endpoint:          endpoint,
+				ReplaceAllowedIPs: true,
+				AllowedIPs:        allowedIps,
+			},
+		},
+	}
+	if defaultRoute4 || defaultRoute6 {
+		deviceConf.FirewallMark = &table
+	}
+
+	if conf.Userspace {
+		err = configureUserspace(conf.Iface, deviceConf)
+		if err != nil {
+			return
+		}
+	} else {
+		err = configureDevice(conf.Iface, deviceConf)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, addr := range conf.Addresses {
+		ipAddr, e := parseAddr(addr)
+		if e != nil {
+			err = e
+			return
+		}
+
+		err = netlink.AddrReplace(link, ipAddr)
+		if err != nil {
+			err = &errortypes.ExecError{
+				errors.Wrapf(err, "wireguard: Failed to add address '%s'",
+					addr),
+			}
+			return
+		}
+	}
+
+	err = netlink.LinkSetUp(link)
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrapf(err, "wireguard: Failed to set interface '%s' up",
+				conf.Iface),
+		}
+		return
+	}
+
+	for _, route := range routes {
+		route.LinkIndex = link.Attrs().Index
+		if route.Dst.IP.To4() != nil {
+			route.Scope = netlink.SCOPE_LINK
+		}
+
+		err = netlink.RouteReplace(route)
+		if err != nil {
+			err = &errortypes.ExecError{
+				errors.Wrapf(err, "wireguard: Failed to add route '%s'",
+					route.Dst.String()),
+			}
+			return
+		}
+	}
+
+	if defaultRoute4 {
+		err = setDefaultRoute(link, table, unix.AF_INET)
+		if err != nil {
+			return
+		}
+	}
+
+	if defaultRoute6 {
+		err = setDefaultRoute(link, table, unix.AF_INET6)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func SetPeer(conf *Config) (err error) {
+	publicKey, err := wgtypes.ParseKey(conf.PublicKey)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "wireguard: Failed to parse public key"),
+		}
+		return
+	}
+
+	endpoint, err := net.ResolveUDPAddr("udp", conf.Endpoint)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrapf(err, "wireguard: Failed to resolve endpoint '%s'",
+				conf.Endpoint),
+		}
+		return
+	}
+
+	allowedIps := []net.IPNet{}
+	for _, route := range conf.Routes {
+		_, network, e := net.ParseCIDR(route.Network)
+		if e != nil {
+			err = &errortypes.ParseError{
+				errors.Wrapf(e, "wireguard: Failed to parse route '%s'",
+					route.Network),
+			}
+			return
+		}
+
+		allowedIps = append(allowedIps, *network)
+	}
+
+	deviceConf := wgtypes.Config{
+		ReplacePeers: true,
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:         publicKey,
+				Endpoint:          endpoint,
+				ReplaceAllowedIPs: true,
+				AllowedIPs:        allowedIps,
+			},
+		},
+	}
+
+	if getUserspace(conf.Iface) != nil {
+		err = configureUserspace(conf.Iface, deviceConf)
+		if err != nil {
+			return
+		}
+	} else {
+		err = configureDevice(conf.Iface, deviceConf)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func configureDevice(iface string, conf wgtypes.Config) (err error) {
+	client, err := wgctrl.New()
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "wireguard: Failed to open wgctrl client"),
+		}
+		return
+	}
+	defer client.Close()
+
+	err = client.ConfigureDevice(iface, conf)
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrapf(err, "wireguard: Failed to configure device '%s'",
+				iface),
+		}
+		return
+	}
+
+	return
+}
+
+func setDefaultRoute(link netlink.Link, table, family int) (err error) {
+	ruleLock.Lock()
+	defer ruleLock.Unlock()
+
+	dst := &net.IPNet{
+		IP:   net.IPv4zero,
+		Mask: net.CIDRMask(0, 32),
+	}
+	if family == unix.AF_INET6 {
+		dst = &net.IPNet{
+			IP:   net.IPv6zero,
+			Mask: net.CIDRMask(0, 128),
+		}
+	}
+
+	err = netlink.RouteReplace(&netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       dst,
+		Table:     table,
+	})
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "wireguard: Failed to add default route"),
+		}
+		return
+	}
+
+	rule := netlink.NewRule()
+	rule.Family = family
+	rule.Invert = true
+	rule.Mark = uint32(table)
+	rule.Table = table
+
+	err = netlink.RuleAdd(rule)
+	if err != nil && err != unix.EEXIST {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "wireguard: Failed to add fwmark rule"),
+		}
+		return
+	}
+	err = nil
+
+	rule = netlink.NewRule()
+	rule.Family = family
+	rule.Table = unix.RT_TABLE_MAIN
+	rule.SuppressPrefixlen = 0
+
+	err = netlink.RuleAdd(rule)
+	if err != nil && err != unix.EEXIST {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "wireguard: Failed to add suppress rule"),
+		}
+		return
+	}
+	err = nil
+
+	if family == unix.AF_INET {
+		_ = ioutil.WriteFile(
+			"/proc/sys/net/ipv4/conf/all/src_valid_mark",
+			[]byte("1"),
+			0644,
+		)
+	}
+
+	return
+}
+
+func clearRules(table int) {
+	ruleLock.Lock()
+	defer ruleLock.Unlock()
+
+	for _, family := range []int{unix.AF_INET, unix.AF_INET6} {
+		rules, err := netlink.RuleList(family)
+		if err != nil {
+			continue
+		}
+
+		active := false
+		for _, rule := range rules {
+			if rule.Table == table {
+				_ = netlink.RuleDel(&rule)
+			} else if rule.Table >= tableBase &&
+				rule.Table < tableBase+tableRange {
+
+				active = true
+			}
+		}
+
+		if active {
+			continue
+		}
+
+		for _, rule := range rules {
+			if rule.Table == unix.RT_TABLE_MAIN &&
+				rule.SuppressPrefixlen == 0 {
+
+				_ = netlink.RuleDel(&rule)
+			}
+		}
+	}
+}
+
+func Clear(iface string) (err error) {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			stopUserspace(iface)
+			err = nil
+			return
+		}
+
+		err = &errortypes.ReadError{
+			errors.Wrapf(err, "wireguard: Failed to find interface '%s'",
+				iface),
+		}
+		return
+	}
+
+	if !stopUserspace(iface) {
+		err = netlink.LinkDel(link)
+		if err != nil {
+			err = &errortypes.ExecError{
+				errors.Wrapf(err,
+					"wireguard: Failed to delete interface '%s'", iface),
+			}
+			return
+		}
+	}
+
+	clearRules(getTable(link))
+
+	return
+}
+
+func GetPeer(iface, publicKey string) (peer *Peer, err error) {
+	dev := getUserspace(iface)
+	if dev != nil {
+		peer, err = getPeerUserspace(dev, iface, publicKey)
+		return
+	}
+
+	client, err := wgctrl.New()
+	if err != nil {
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "wireguard: Failed to open wgctrl client"),
+		}
+		return
+	}
+	defer client.Close()
+
+	device, err := client.Device(iface)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrapf(err, "wireguard: Failed to read device '%s'",
+				iface),
+		}
+		return
+	}
+
+	for _, devicePeer := range device.Peers {
+		if devicePeer.PublicKey.String() != publicKey {
+			continue
+		}
+
+		peer = &Peer{
+			PublicKey:     publicKey,
+			LastHandshake: devicePeer.LastHandshakeTime,
+			ReceiveBytes:  devicePeer.ReceiveBytes,
+			TransmitBytes: devicePeer.TransmitBytes,
+		}
+		return
+	}
+
+	return
+}
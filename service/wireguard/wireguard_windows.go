@@ -0,0 +1,35 @@
+package wireguard
+
+import (
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-client-electron/service/errortypes"
+)
+
+func Configure(conf *Config) (err error) {
+	err = &errortypes.ExecError{
+		errors.New("wireguard: Not implemented"),
+	}
+	return
+}
+
+func SetPeer(conf *Config) (err error) {
+	err = &errortypes.ExecError{
+		errors.New("wireguard: Not implemented"),
+	}
+	return
+}
+
+func Clear(iface string) (err error) {
+	return
+}
+
+func GetMark(iface string) int {
+	return 0
+}
+
+func GetPeer(iface, publicKey string) (peer *Peer, err error) {
+	err = &errortypes.ReadError{
+		errors.New("wireguard: Not implemented"),
+	}
+	return
+}